@@ -0,0 +1,298 @@
+package main
+
+import (
+	"io"
+
+	"gitlab.com/stone.code/scov/internal/tool"
+)
+
+// The HTML report does not reference any external resources, so that it can
+// be viewed without network access.  The stylesheet provides the subset of
+// the layout, table, and button styles from Pure CSS (https://purecss.io/)
+// that are used by the report.
+const cssAsset = `html { font-family: sans-serif; line-height: 1.15; -webkit-text-size-adjust: 100%; }
+body { margin: 0; }
+h1 { font-size: 2em; margin: .67em 0; }
+a { background-color: transparent; }
+table { border-collapse: collapse; border-spacing: 0; }
+td, th { padding: 0; }
+button, input, select { font-family: inherit; font-size: 100%; margin: 0; }
+
+.pure-g { display: flex; flex-flow: row wrap; align-content: flex-start; }
+.pure-u, .pure-u-1, .pure-u-md-1-2 { display: inline-block; vertical-align: top; box-sizing: border-box; }
+.pure-u-1 { width: 100%; }
+@media screen and (min-width: 48em) {
+	.pure-u-md-1-2 { width: 50%; }
+}
+
+.pure-table { border-collapse: collapse; border-spacing: 0; empty-cells: show; border: 1px solid #cbcbcb; }
+.pure-table td, .pure-table th { border-left: 1px solid #cbcbcb; border-width: 0 0 0 1px; font-size: inherit; margin: 0; overflow: visible; padding: .5em 1em; }
+.pure-table thead { background-color: #e0e0e0; color: #000; text-align: left; vertical-align: bottom; }
+.pure-table td { background-color: transparent; }
+.pure-table-bordered td { border-bottom: 1px solid #cbcbcb; }
+.pure-table-bordered tbody > tr:last-child > td { border-bottom-width: 0; }
+.pure-table-horizontal td, .pure-table-horizontal th { border-width: 0 0 1px 0; border-bottom: 1px solid #cbcbcb; }
+.pure-table-horizontal tbody > tr:last-child > td { border-bottom-width: 0; }
+
+.pure-button { display: inline-block; line-height: normal; white-space: nowrap; vertical-align: middle; text-align: center; cursor: pointer; user-select: none; box-sizing: border-box; font-family: inherit; font-size: 100%; padding: .5em 1em; color: rgba(0, 0, 0, .8); border: none transparent; background-color: #e6e6e6; text-decoration: none; border-radius: 2px; }
+.pure-button:hover, .pure-button:focus { background-image: linear-gradient(transparent, rgba(0, 0, 0, .05) 40%, rgba(0, 0, 0, .1)); }
+.pure-button-active { box-shadow: 0 0 0 1px rgba(0, 0, 0, .15) inset, 0 0 6px rgba(0, 0, 0, .2) inset; }
+
+.filter { margin-bottom: 1em; }
+.filter input, .filter select { padding: .3em .5em; border: 1px solid #ccc; border-radius: 2px; margin-right: 1em; }
+.filter label { margin-right: 1em; }
+`
+
+// The script enhances the tables in the report with sorting and filtering,
+// and adds navigation between uncovered lines on the source pages.
+// The report is complete without scripting, so all of the controls are added
+// by the script.
+const jsAsset = `(function() {
+'use strict';
+
+// Find the cell in a row that covers the column, taking into account any
+// cells that span multiple columns.
+function cellAt(row, column) {
+	var index = 0;
+	for (var i = 0; i < row.cells.length; i++) {
+		index += row.cells[i].colSpan;
+		if (column < index) return row.cells[i];
+	}
+	return null;
+}
+
+var sortKeys = {
+	'text': function(cell) {
+		return cell ? cell.textContent : '';
+	},
+	'perc': function(cell) {
+		var v = cell ? parseFloat(cell.textContent) : NaN;
+		return isNaN(v) ? -1 : v;
+	}
+};
+
+function sortTable(table, column, key, dir) {
+	var tbody = table.tBodies[0];
+	var rows = Array.prototype.slice.call(tbody.rows);
+	rows.sort(function(a, b) {
+		var v1 = key(cellAt(a, column));
+		var v2 = key(cellAt(b, column));
+		return v1 < v2 ? -dir : v1 > v2 ? +dir : 0;
+	});
+	for (var i = 0; i < rows.length; i++) {
+		tbody.appendChild(rows[i]);
+	}
+}
+
+function makeSortButton(th, column, key, dir) {
+	var button = document.createElement('button');
+	button.type = 'button';
+	button.className = 'pure-button';
+	button.textContent = dir > 0 ? '▲' : '▼';
+	button.setAttribute('aria-label', dir > 0 ? 'Sort ascending' : 'Sort descending');
+	button.onclick = function() {
+		var table = th.closest('table');
+		sortTable(table, column, key, dir);
+		var headers = table.tHead.getElementsByTagName('th');
+		for (var i = 0; i < headers.length; i++) {
+			headers[i].removeAttribute('aria-sort');
+		}
+		th.setAttribute('aria-sort', dir > 0 ? 'ascending' : 'descending');
+	};
+	return button;
+}
+
+function addSorting(th) {
+	var key = sortKeys[th.getAttribute('data-sort')];
+	if (!key) return;
+
+	// Sort using the last column covered by the header.  For coverage, this
+	// is the percentage.
+	var column = th.colSpan - 1;
+	for (var e = th.previousElementSibling; e; e = e.previousElementSibling) {
+		column += e.colSpan;
+	}
+
+	var span = document.createElement('span');
+	span.className = 'reveal';
+	span.appendChild(makeSortButton(th, column, key, +1));
+	span.appendChild(makeSortButton(th, column, key, -1));
+	th.appendChild(document.createTextNode(' '));
+	th.appendChild(span);
+}
+
+function addFilter(table) {
+	var form = document.createElement('form');
+	form.className = 'filter';
+	form.onsubmit = function() { return false; };
+
+	var name = document.createElement('input');
+	name.type = 'search';
+	name.placeholder = 'Filter by filename';
+	name.setAttribute('aria-label', 'Filter by filename');
+	form.appendChild(name);
+
+	var rating = document.createElement('select');
+	rating.setAttribute('aria-label', 'Filter by rating');
+	rating.appendChild(new Option('Any rating', ''));
+	var ratings = table.getAttribute('data-filter').split(' ');
+	for (var i = 0; i < ratings.length; i++) {
+		rating.appendChild(new Option(ratings[i], ratings[i]));
+	}
+	form.appendChild(rating);
+
+	var label = document.createElement('label');
+	var uncovered = document.createElement('input');
+	uncovered.type = 'checkbox';
+	label.appendChild(uncovered);
+	label.appendChild(document.createTextNode(' Has uncovered lines'));
+	form.appendChild(label);
+
+	var count = document.createElement('span');
+	form.appendChild(count);
+
+	var update = function() {
+		var text = name.value.toLowerCase();
+		var rows = table.tBodies[0].rows;
+		var shown = 0, files = 0;
+		for (var i = 0; i < rows.length; i++) {
+			var row = rows[i];
+			var ok = row.cells[0].textContent.toLowerCase().indexOf(text) >= 0 &&
+				(!rating.value || row.getAttribute('data-rating') == rating.value) &&
+				(!uncovered.checked || parseInt(row.getAttribute('data-uncovered'), 10) > 0);
+			row.style.display = ok ? '' : 'none';
+			// Rows for directories are filtered, but are not counted.
+			if (row.hasAttribute('data-dir')) continue;
+			files++;
+			if (ok) shown++;
+		}
+		count.textContent = shown + ' of ' + files + ' files';
+	};
+	name.oninput = update;
+	rating.onchange = update;
+	uncovered.onchange = update;
+	update();
+
+	table.parentNode.insertBefore(form, table);
+}
+
+// Find the rows that start a run of rows with the class.
+function runStarts(table, className) {
+	var rows = table.querySelectorAll('tbody tr.' + className);
+	var out = [];
+	for (var i = 0; i < rows.length; i++) {
+		var prev = rows[i].previousElementSibling;
+		if (!prev || !prev.classList.contains(className)) {
+			out.push(rows[i]);
+		}
+	}
+	return out;
+}
+
+function currentLine() {
+	var m = /^#L(\d+)$/.exec(window.location.hash);
+	return m ? parseInt(m[1], 10) : 0;
+}
+
+function jumpTo(rows, dir) {
+	var line = currentLine();
+	var target = null;
+	for (var i = 0; i < rows.length; i++) {
+		var n = parseInt(rows[i].id.substring(1), 10);
+		if (dir > 0 && n > line) {
+			target = rows[i];
+			break;
+		}
+		if (dir < 0 && n < line) {
+			target = rows[i];
+		}
+	}
+	if (target) {
+		window.location.hash = '#' + target.id;
+	}
+}
+
+function addSourceNavigation(nav, table) {
+	var misses = runStarts(table, 'miss');
+	var partial = runStarts(table, 'partial');
+
+	var actions = {};
+	var add = function(label, key, rows, dir) {
+		var button = document.createElement('button');
+		button.type = 'button';
+		button.className = 'pure-button';
+		button.textContent = label;
+		button.title = label + ' (' + key + ')';
+		button.disabled = rows.length == 0;
+		button.onclick = function() { jumpTo(rows, dir); };
+		nav.appendChild(button);
+		actions[key] = button.onclick;
+	};
+
+	nav.textContent = '';
+	add('Previous uncovered line', 'p', misses, -1);
+	add('Next uncovered line', 'n', misses, +1);
+	add('Previous partial line', 'P', partial, -1);
+	add('Next partial line', 'N', partial, +1);
+
+	document.addEventListener('keydown', function(e) {
+		var tag = e.target.tagName;
+		if (e.ctrlKey || e.altKey || e.metaKey || tag == 'INPUT' || tag == 'SELECT' || tag == 'TEXTAREA') {
+			return;
+		}
+		if (actions[e.key]) {
+			actions[e.key]();
+			e.preventDefault();
+		}
+	});
+}
+
+window.addEventListener('load', function() {
+	var elems = document.querySelectorAll('th[data-sort]');
+	for (var i = 0; i < elems.length; i++) {
+		addSorting(elems[i]);
+	}
+
+	elems = document.querySelectorAll('table[data-filter]');
+	for (var i = 0; i < elems.length; i++) {
+		addFilter(elems[i]);
+	}
+
+	var nav = document.querySelector('nav.source-nav');
+	var table = document.querySelector('table.source');
+	if (nav && table) {
+		addSourceNavigation(nav, table);
+	}
+});
+})();
+`
+
+func createCSS(filename string) error {
+	return createAsset(filename, cssAsset)
+}
+
+func writeCSS(out io.Writer) error {
+	_, err := io.WriteString(out, cssAsset)
+	return err
+}
+
+func createJS(filename string) error {
+	return createAsset(filename, jsAsset)
+}
+
+func writeJS(out io.Writer) error {
+	_, err := io.WriteString(out, jsAsset)
+	return err
+}
+
+func createAsset(filename string, content string) error {
+	w, err := tool.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	_, err = io.WriteString(w.File(), content)
+	w.Keep(err)
+	return err
+}
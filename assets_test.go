@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestCreateCSS(t *testing.T) {
+	name, cleanup := TempFilename(t)
+	defer cleanup()
+
+	err := createCSS(name)
+	if err != nil {
+		t.Fatalf("could not write output: %s", err)
+	}
+
+	out, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatalf("could not read the output: %s", err)
+	}
+	if !bytes.Equal(out, []byte(cssAsset)) {
+		t.Errorf("output does not match the stylesheet")
+	}
+}
+
+func TestCreateJS(t *testing.T) {
+	name, cleanup := TempFilename(t)
+	defer cleanup()
+
+	err := createJS(name)
+	if err != nil {
+		t.Errorf("could not write output: %s", err)
+	}
+}
+
+func TestWriteAssets(t *testing.T) {
+	cases := []struct {
+		name     string
+		write    func(*bytes.Buffer) error
+		contains string
+	}{
+		{"css", func(b *bytes.Buffer) error { return writeCSS(b) }, ".pure-table"},
+		{"js", func(b *bytes.Buffer) error { return writeJS(b) }, "data-filter"},
+	}
+
+	for _, v := range cases {
+		buffer := bytes.NewBuffer(nil)
+		if err := v.write(buffer); err != nil {
+			t.Errorf("case %s: could not write output: %s", v.name, err)
+		}
+		if out := buffer.String(); !strings.Contains(out, v.contains) {
+			t.Errorf("case %s: output does not contain %q", v.name, v.contains)
+		}
+	}
+}
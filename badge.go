@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gitlab.com/stone.code/scov/internal/tool"
+)
+
+// A badge summarizes a single coverage metric, for use in a project's README.
+type badge struct {
+	Label    string
+	Coverage Coverage
+	Rating   RatingBand
+}
+
+// badgeLabels contains the labels for the metrics that can be used for
+// badges.
+var badgeLabels = map[string]string{
+	"lines":     "coverage",
+	"functions": "function coverage",
+	"branches":  "branch coverage",
+	"regions":   "region coverage",
+}
+
+// newBadge creates a badge for the named metric.  The badge is coloured
+// using the rating scheme for that metric.
+func newBadge(metric string, ratings Ratings, lcov, fcov, bcov, rcov Coverage) (badge, error) {
+	label, ok := badgeLabels[metric]
+	if !ok {
+		return badge{}, fmt.Errorf("unknown metric for badge: %s", metric)
+	}
+
+	cov, rs := lcov, ratings.Lines
+	switch metric {
+	case "functions":
+		cov, rs = fcov, ratings.Funcs
+	case "branches":
+		cov, rs = bcov, ratings.Branches
+	case "regions":
+		cov, rs = rcov, ratings.Regions
+	}
+	return badge{label, cov, rs.Rate(cov)}, nil
+}
+
+// Message returns the text for the right side of the badge.
+func (b badge) Message() string {
+	if !b.Coverage.Valid() {
+		return "n/a"
+	}
+	return fmt.Sprintf("%.1f%%", b.Coverage.P())
+}
+
+// Colors returns the colour for the badge, both as an RGB colour for SVG and
+// as a named colour for shields.io.
+func (b badge) Colors() (string, string) {
+	if !b.Coverage.Valid() {
+		return "#9f9f9f", "lightgrey"
+	}
+
+	colors := b.Rating.colors()
+	return colors.Badge, colors.Shields
+}
+
+// badgeTextWidth estimates the width of the text, in pixels, when rendered
+// using an 11px Verdana font.
+func badgeTextWidth(text string) int {
+	return len(text)*7 + 10
+}
+
+const badgeSVG = `<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[4]s: %[5]s"><title>%[4]s: %[5]s</title>` +
+	`<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>` +
+	`<clipPath id="r"><rect width="%[1]d" height="20" rx="3" fill="#fff"/></clipPath>` +
+	`<g clip-path="url(#r)"><rect width="%[2]d" height="20" fill="#555"/><rect x="%[2]d" width="%[3]d" height="20" fill="%[6]s"/><rect width="%[1]d" height="20" fill="url(#s)"/></g>` +
+	`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">` +
+	`<text x="%[7]d" y="15" fill="#010101" fill-opacity=".3">%[4]s</text><text x="%[7]d" y="14">%[4]s</text>` +
+	`<text x="%[8]d" y="15" fill="#010101" fill-opacity=".3">%[5]s</text><text x="%[8]d" y="14">%[5]s</text></g></svg>
+`
+
+func writeBadgeSVG(out io.Writer, b badge) error {
+	label := html.EscapeString(b.Label)
+	message := html.EscapeString(b.Message())
+	color, _ := b.Colors()
+
+	lw := badgeTextWidth(b.Label)
+	mw := badgeTextWidth(b.Message())
+	_, err := fmt.Fprintf(out, badgeSVG, lw+mw, lw, mw, label, message, color, lw/2, lw+mw/2)
+	return err
+}
+
+// jsonBadge is the representation of a badge for the shields.io endpoint.
+// See https://shields.io/endpoint.
+type jsonBadge struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Label         string `json:"label"`
+	Message       string `json:"message"`
+	Color         string `json:"color"`
+}
+
+func writeBadgeJSON(out io.Writer, b badge) error {
+	_, color := b.Colors()
+	data := jsonBadge{
+		SchemaVersion: 1,
+		Label:         b.Label,
+		Message:       b.Message(),
+		Color:         color,
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "\t")
+	return encoder.Encode(&data)
+}
+
+func createBadge(filename string, b badge, write func(io.Writer, badge) error) error {
+	w, err := tool.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	err = write(w.File(), b)
+	w.Keep(err)
+	return err
+}
+
+// createBadgeReports writes the badges requested on the command-line.  Any
+// of the filenames can be empty, in which case that badge is skipped.
+func createBadgeReports(svgfile, jsonfile, outdir string, metric string, report *Report) error {
+	b, err := newBadge(metric, report.Ratings, report.LCoverage, report.FCoverage, report.BCoverage, report.RCoverage)
+	if err != nil {
+		return err
+	}
+
+	if svgfile != "" {
+		err := createBadge(svgfile, b, writeBadgeSVG)
+		if err != nil {
+			return err
+		}
+	}
+	if jsonfile != "" {
+		err := createBadge(jsonfile, b, writeBadgeJSON)
+		if err != nil {
+			return err
+		}
+	}
+	if outdir != "" {
+		return createBadges(outdir, metric, report)
+	}
+	return nil
+}
+
+// createBadges writes an SVG badge and a shields.io endpoint for the report,
+// for each component, and for each directory.
+func createBadges(outdir string, metric string, report *Report) error {
+	err := createBadgePair(filepath.Join(outdir, "coverage"), metric, report.Ratings,
+		report.LCoverage, report.FCoverage, report.BCoverage, report.RCoverage)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range report.Components {
+		err := createBadgePair(filepath.Join(outdir, "components", badgeFilename(v.Name)), metric, report.Ratings,
+			v.LCoverage, v.FCoverage, v.BCoverage, v.RCoverage)
+		if err != nil {
+			return err
+		}
+	}
+
+	if report.Dirs != nil {
+		return createDirBadges(outdir, metric, report.Ratings, report.Dirs.Dirs)
+	}
+	return nil
+}
+
+func createDirBadges(outdir string, metric string, ratings Ratings, dirs []*DirStatistics) error {
+	for _, v := range dirs {
+		err := createBadgePair(filepath.Join(outdir, "dirs", filepath.FromSlash(reportPath(v.Name))), metric, ratings,
+			v.LCoverage, v.FCoverage, v.BCoverage, v.RCoverage)
+		if err != nil {
+			return err
+		}
+		err = createDirBadges(outdir, metric, ratings, v.Dirs)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createBadgePair writes both the SVG badge and the shields.io endpoint.  The
+// extensions are added to the basename.
+func createBadgePair(basename string, metric string, ratings Ratings, lcov, fcov, bcov, rcov Coverage) error {
+	b, err := newBadge(metric, ratings, lcov, fcov, bcov, rcov)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(basename), 0700)
+	if err != nil {
+		return err
+	}
+	err = createBadge(basename+".svg", b, writeBadgeSVG)
+	if err != nil {
+		return err
+	}
+	return createBadge(basename+".json", b, writeBadgeJSON)
+}
+
+// badgeFilename converts a component name to a filename.  Any characters
+// that might not be safe in a filename are replaced.
+func badgeFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '_'
+	}, name)
+	if strings.Trim(name, ".") == "" {
+		// Avoid special names, such as "..".
+		name = "_" + name
+	}
+	return name
+}
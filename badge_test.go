@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewBadge(t *testing.T) {
+	cases := []struct {
+		metric   string
+		ok       bool
+		label    string
+		coverage Coverage
+	}{
+		{"lines", true, "coverage", Coverage{1, 10}},
+		{"functions", true, "function coverage", Coverage{2, 10}},
+		{"branches", true, "branch coverage", Coverage{3, 10}},
+		{"regions", true, "region coverage", Coverage{4, 10}},
+		{"bogus", false, "", Coverage{}},
+	}
+
+	for _, v := range cases {
+		t.Run(v.metric, func(t *testing.T) {
+			b, err := newBadge(v.metric, DefaultRatings(), Coverage{1, 10}, Coverage{2, 10}, Coverage{3, 10}, Coverage{4, 10})
+			if (err == nil) != v.ok {
+				LogNE(t, "ok", v.ok, err == nil)
+			}
+			if b.Label != v.label {
+				LogNE(t, "label", v.label, b.Label)
+			}
+			if b.Coverage != v.coverage {
+				LogNE(t, "coverage", v.coverage, b.Coverage)
+			}
+		})
+	}
+}
+
+func TestNewBadgeRatings(t *testing.T) {
+	ratings := DefaultRatings()
+	ratings.Branches = RatingScheme{{"high", 100, "green"}, {"low", 0, "red"}}
+
+	b, err := newBadge("lines", ratings, Coverage{19, 20}, Coverage{}, Coverage{19, 20}, Coverage{})
+	if err != nil {
+		t.Fatalf("could not create badge: %s", err)
+	}
+	if _, name := b.Colors(); name != "brightgreen" {
+		LogNE(t, "color name", "brightgreen", name)
+	}
+
+	b, err = newBadge("branches", ratings, Coverage{19, 20}, Coverage{}, Coverage{19, 20}, Coverage{})
+	if err != nil {
+		t.Fatalf("could not create badge: %s", err)
+	}
+	if _, name := b.Colors(); name != "red" {
+		LogNE(t, "color name", "red", name)
+	}
+}
+
+func TestBadge(t *testing.T) {
+	cases := []struct {
+		coverage Coverage
+		message  string
+		color    string
+		name     string
+	}{
+		{Coverage{0, 0}, "n/a", "#9f9f9f", "lightgrey"},
+		{Coverage{1, 10}, "10.0%", "#e05d44", "red"},
+		{Coverage{8, 10}, "80.0%", "#dfb317", "yellow"},
+		{Coverage{19, 20}, "95.0%", "#4c1", "brightgreen"},
+	}
+
+	for _, v := range cases {
+		t.Run(v.coverage.String(), func(t *testing.T) {
+			b := badge{"coverage", v.coverage, DefaultRatingScheme().Rate(v.coverage)}
+			if out := b.Message(); out != v.message {
+				LogNE(t, "message", v.message, out)
+			}
+			color, name := b.Colors()
+			if color != v.color {
+				LogNE(t, "color", v.color, color)
+			}
+			if name != v.name {
+				LogNE(t, "color name", v.name, name)
+			}
+		})
+	}
+}
+
+func TestWriteBadgeSVG(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+	err := writeBadgeSVG(buffer, badge{"coverage", Coverage{17, 20}, RatingBand{"medium", 75, "yellow"}})
+	if err != nil {
+		t.Fatalf("could not write badge: %s", err)
+	}
+	checkGolden(t, buffer.Bytes())
+}
+
+func TestWriteBadgeJSON(t *testing.T) {
+	buffer := bytes.NewBuffer(nil)
+	err := writeBadgeJSON(buffer, badge{"coverage", Coverage{17, 20}, RatingBand{"medium", 75, "yellow"}})
+	if err != nil {
+		t.Fatalf("could not write badge: %s", err)
+	}
+	checkGolden(t, buffer.Bytes())
+}
+
+func TestCreateBadgeReports(t *testing.T) {
+	dir, cleanup := TempDirectory(t)
+	defer cleanup()
+
+	data := make(map[string]*FileData)
+	err := loadFile(data, "./testdata/example-7.4.0-branches", loadOptions{})
+	if err != nil {
+		t.Fatalf("could not read file: %s", err)
+	}
+	cm, err := parseComponentMap(strings.NewReader(testComponentMap))
+	if err != nil {
+		t.Fatalf("could not parse components: %s", err)
+	}
+
+	report := NewTestReport()
+	report.CollectStatistics(data)
+	report.CollectGroups(cm, nil)
+
+	err = createBadgeReports(filepath.Join(dir, "badge.svg"), filepath.Join(dir, "badge.json"), filepath.Join(dir, "badges"), "branches", report)
+	if err != nil {
+		t.Fatalf("could not create badges: %s", err)
+	}
+
+	expected := []string{
+		"badge.svg",
+		"badge.json",
+		"badges/coverage.svg",
+		"badges/coverage.json",
+		"badges/dirs/methods.svg",
+		"badges/dirs/methods.json",
+	}
+	for _, v := range report.Components {
+		expected = append(expected, "badges/components/"+badgeFilename(v.Name)+".svg")
+	}
+	for _, v := range expected {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(v))); err != nil {
+			t.Errorf("missing badge: %s", err)
+		}
+	}
+
+	err = createBadgeReports("", "", "", "bogus", report)
+	if err == nil {
+		t.Errorf("unexpected success")
+	}
+}
+
+func TestCreateDirBadgesParentDirs(t *testing.T) {
+	dir, cleanup := TempDirectory(t)
+	defer cleanup()
+
+	data := make(FileDataSet)
+	data.FileData("../outside/a.c").AppendLineCountData(1, 1)
+
+	report := NewTestReport()
+	report.CollectStatistics(data)
+
+	err := createBadges(filepath.Join(dir, "badges"), "lines", report)
+	if err != nil {
+		t.Fatalf("could not create badges: %s", err)
+	}
+
+	// Nothing should be written outside of the output directory.
+	if _, err := os.Stat(filepath.Join(dir, "outside.svg")); !os.IsNotExist(err) {
+		t.Errorf("unexpected badge outside of the output directory: %v", err)
+	}
+	for _, v := range []string{"dirs/^.svg", "dirs/^/outside.svg", "dirs/^/outside.json"} {
+		if _, err := os.Stat(filepath.Join(dir, "badges", filepath.FromSlash(v))); err != nil {
+			t.Errorf("missing badge: %s", err)
+		}
+	}
+}
+
+func TestBadgeFilename(t *testing.T) {
+	cases := []struct {
+		in       string
+		expected string
+	}{
+		{"core", "core"},
+		{"Core Library", "Core_Library"},
+		{"a/b", "a_b"},
+		{"v1.0", "v1.0"},
+		{"..", "_.."},
+		{"", "_"},
+	}
+
+	for _, v := range cases {
+		if out := badgeFilename(v.in); out != v.expected {
+			LogNE(t, "filename", v.expected, out)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// coberturaClass is a class in a Cobertura report.  The class contains the
+// lines for its methods, but a source file may contain several classes.
+type coberturaClass struct {
+	Name     string            `xml:"name,attr"`
+	Filename string            `xml:"filename,attr"`
+	Methods  []coberturaMethod `xml:"methods>method"`
+	Lines    []coberturaLine   `xml:"lines>line"`
+}
+
+type coberturaMethod struct {
+	Name      string          `xml:"name,attr"`
+	Signature string          `xml:"signature,attr"`
+	Lines     []coberturaLine `xml:"lines>line"`
+}
+
+type coberturaLine struct {
+	Number            int    `xml:"number,attr"`
+	Hits              uint64 `xml:"hits,attr"`
+	Branch            bool   `xml:"branch,attr"`
+	ConditionCoverage string `xml:"condition-coverage,attr"`
+}
+
+// coberturaFilename locates the source file for a class.  Filenames are
+// relative to one of the source directories listed at the start of the
+// report.  The file system is not checked, so if there are several source
+// directories, the directory cannot be known, and the filename is left
+// unchanged.  Those files can be found using the search path for sources.
+func coberturaFilename(filename string, sources []string) string {
+	if filepath.IsAbs(filename) || len(sources) != 1 {
+		return filename
+	}
+	return filepath.Join(sources[0], filename)
+}
+
+func loadCoberturaClass(fds FileDataSet, class *coberturaClass, sources []string) error {
+	currentData := fds.FileData(coberturaFilename(class.Filename, sources))
+
+	for _, v := range class.Lines {
+		currentData.AppendLineCountData(v.Number, v.Hits)
+		if !v.Branch || v.ConditionCoverage == "" {
+			continue
+		}
+
+		covered, total, err := parseConditionCoverage(v.ConditionCoverage)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < total; i++ {
+			data := BranchData{Block: -1, Branch: i}
+			switch {
+			case i < covered:
+				data.Status = BranchTaken
+			case v.Hits > 0:
+				data.Status = BranchNotTaken
+			default:
+				data.Status = BranchNotExec
+			}
+			currentData.AppendBranchData(v.Number, data)
+		}
+	}
+
+	overloaded := countMethodNames(class.Methods)
+	for _, v := range class.Methods {
+		if len(v.Lines) == 0 {
+			continue
+		}
+
+		name := class.Name + "." + v.Name
+		if overloaded[v.Name] > 1 {
+			name += v.Signature
+		}
+		// The hit count for the function is the count for its first line.
+		sort.Slice(v.Lines, func(i, j int) bool {
+			return v.Lines[i].Number < v.Lines[j].Number
+		})
+		first, last := v.Lines[0], v.Lines[len(v.Lines)-1]
+		currentData.AppendFunctionData(name, first.Number, last.Number, first.Hits)
+	}
+	return nil
+}
+
+func countMethodNames(methods []coberturaMethod) map[string]int {
+	out := make(map[string]int, len(methods))
+	for _, v := range methods {
+		out[v.Name]++
+	}
+	return out
+}
+
+// parseConditionCoverage parses the branch coverage for a line, which has the
+// format "50% (1/2)".
+func parseConditionCoverage(value string) (covered, total int, err error) {
+	start := strings.IndexByte(value, '(')
+	end := strings.IndexByte(value, ')')
+	if start < 0 || end < start {
+		return 0, 0, fmt.Errorf("can't parse condition coverage: %s", value)
+	}
+
+	_, err = fmt.Sscanf(value[start+1:end], "%d/%d", &covered, &total)
+	if err != nil {
+		return 0, 0, fmt.Errorf("can't parse condition coverage: %s", err)
+	}
+	if covered < 0 || total < covered {
+		return 0, 0, fmt.Errorf("can't parse condition coverage: %s", value)
+	}
+	return covered, total, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadCoberturaFile(t *testing.T) {
+	fds := make(FileDataSet)
+	err := loadFile(fds, "./testdata/example-cobertura.xml", loadOptions{})
+	if err != nil {
+		t.Fatalf("could not load file: %s", err)
+	}
+
+	filename := filepath.Join("src/main/java", "com/example/Gauss.java")
+	data, ok := fds[filename]
+	if !ok || len(fds) != 1 {
+		t.Fatalf("missing file: %v", fds)
+	}
+
+	lines := map[int]uint64{5: 3, 6: 3, 7: 3, 10: 0, 11: 0, 14: 1, 20: 2, 21: 2}
+	if !reflect.DeepEqual(data.LineData, lines) {
+		LogNE(t, "line data", lines, data.LineData)
+	}
+
+	funcs := map[string]FuncData{
+		"com.example.Gauss.sum(I)I": {StartLine: 5, EndLine: 7, HitCount: 3},
+		"com.example.Gauss.sum(J)J": {StartLine: 10, EndLine: 11, HitCount: 0},
+		"com.example.Gauss.main":    {StartLine: 14, EndLine: 14, HitCount: 1},
+	}
+	if !reflect.DeepEqual(data.FuncData, funcs) {
+		LogNE(t, "function data", funcs, data.FuncData)
+	}
+
+	branches := map[int][]BranchData{
+		6: {
+			{Status: BranchTaken, Block: -1, Branch: 0},
+			{Status: BranchNotTaken, Block: -1, Branch: 1},
+		},
+		11: {
+			{Status: BranchNotExec, Block: -1, Branch: 0},
+			{Status: BranchNotExec, Block: -1, Branch: 1},
+		},
+	}
+	if !reflect.DeepEqual(data.BranchData, branches) {
+		LogNE(t, "branch data", branches, data.BranchData)
+	}
+}
+
+func TestCoberturaFilename(t *testing.T) {
+	cases := []struct {
+		filename string
+		sources  []string
+		expected string
+	}{
+		{"a.py", nil, "a.py"},
+		{"/src/a.py", []string{"/other"}, "/src/a.py"},
+		{"a.py", []string{"/src"}, "/src/a.py"},
+		{"a.py", []string{"/src", "/other"}, "a.py"},
+		{"example.c", []string{"/missing", "./example"}, "example.c"},
+	}
+
+	for _, v := range cases {
+		if out := coberturaFilename(v.filename, v.sources); out != filepath.FromSlash(v.expected) {
+			LogNE(t, "filename", v.expected, out)
+		}
+	}
+}
+
+func TestParseConditionCoverage(t *testing.T) {
+	cases := []struct {
+		value   string
+		ok      bool
+		covered int
+		total   int
+	}{
+		{"50% (1/2)", true, 1, 2},
+		{"100% (4/4)", true, 4, 4},
+		{"0% (0/2)", true, 0, 2},
+		{"50%", false, 0, 0},
+		{"50% (1/)", false, 0, 0},
+		{"50% (a/b)", false, 0, 0},
+		{"150% (3/2)", false, 0, 0},
+	}
+
+	for _, v := range cases {
+		t.Run(v.value, func(t *testing.T) {
+			covered, total, err := parseConditionCoverage(v.value)
+			if (err == nil) != v.ok {
+				LogNE(t, "ok", v.ok, err == nil)
+			}
+			if covered != v.covered || total != v.total {
+				t.Errorf("expected %d/%d, got %d/%d", v.covered, v.total, covered, total)
+			}
+		})
+	}
+}
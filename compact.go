@@ -0,0 +1,420 @@
+package main
+
+import (
+	"sort"
+)
+
+// CompactFileData maintains coverage statistics for a single file.  It holds
+// the same information as FileData, but uses sorted slices instead of maps
+// to reduce the memory required for large data sets.
+type CompactFileData struct {
+	Filename string
+	Lines    []uint32 // Line numbers, in sorted order.
+	Counts   []uint64 // Hit counts for the lines in Lines.
+	Partial  []uint32 // Lines with blocks that were not executed, in sorted order.
+	Funcs    []CompactFuncData
+	Branches []CompactBranchData
+	Regions  []CompactRegionData
+}
+
+// CompactFuncData represents data about a function.
+type CompactFuncData struct {
+	Name      string
+	StartLine uint32
+	EndLine   uint32
+	HitCount  uint64
+}
+
+// CompactBranchData represents the status of a single branch.
+type CompactBranchData struct {
+	Line   uint32
+	Block  int32
+	Branch int32
+	Count  uint64
+	Status BranchStatus
+	Flags  uint8
+}
+
+// Flags used in CompactBranchData.
+const (
+	compactBranchHasCount = 1 << iota
+	compactBranchThrow
+	compactBranchFallthrough
+)
+
+func newCompactBranchData(lineNo int, data BranchData) CompactBranchData {
+	flags := uint8(0)
+	if data.HasCount {
+		flags |= compactBranchHasCount
+	}
+	if data.Throw {
+		flags |= compactBranchThrow
+	}
+	if data.Fallthrough {
+		flags |= compactBranchFallthrough
+	}
+
+	return CompactBranchData{
+		Line:   uint32(lineNo),
+		Block:  int32(data.Block),
+		Branch: int32(data.Branch),
+		Count:  data.Count,
+		Status: data.Status,
+		Flags:  flags,
+	}
+}
+
+// Expand recreates the BranchData for the branch.
+func (cbd *CompactBranchData) Expand() BranchData {
+	return BranchData{
+		Status:      cbd.Status,
+		Count:       cbd.Count,
+		HasCount:    cbd.Flags&compactBranchHasCount != 0,
+		Block:       int(cbd.Block),
+		Branch:      int(cbd.Branch),
+		Throw:       cbd.Flags&compactBranchThrow != 0,
+		Fallthrough: cbd.Flags&compactBranchFallthrough != 0,
+	}
+}
+
+// CompactRegionData represents the hit count for a region of code.
+type CompactRegionData struct {
+	StartLine uint32
+	StartByte uint32
+	EndLine   uint32
+	EndByte   uint32
+	HitCount  uint64
+}
+
+// stringInterner is used to share the storage for strings, such as filenames
+// and function names, that are repeated across input files.
+type stringInterner map[string]string
+
+func (si stringInterner) intern(s string) string {
+	if tmp, ok := si[s]; ok {
+		return tmp
+	}
+	si[s] = s
+	return s
+}
+
+// NewCompactFileData creates a compact copy of the data.
+func NewCompactFileData(data *FileData) *CompactFileData {
+	return newCompactFileData(data, make(stringInterner))
+}
+
+func newCompactFileData(data *FileData, names stringInterner) *CompactFileData {
+	cfd := &CompactFileData{
+		Filename: names.intern(data.Filename),
+		Lines:    make([]uint32, 0, len(data.LineData)),
+		Counts:   make([]uint64, 0, len(data.LineData)),
+		Funcs:    make([]CompactFuncData, 0, len(data.FuncData)),
+		Regions:  make([]CompactRegionData, 0, len(data.RegionData)),
+	}
+
+	for lineNo := range data.LineData {
+		cfd.Lines = append(cfd.Lines, uint32(lineNo))
+	}
+	sort.Slice(cfd.Lines, func(i, j int) bool {
+		return cfd.Lines[i] < cfd.Lines[j]
+	})
+	for _, lineNo := range cfd.Lines {
+		cfd.Counts = append(cfd.Counts, data.LineData[int(lineNo)])
+	}
+	for lineNo := range data.PartialLines {
+		cfd.Partial = append(cfd.Partial, uint32(lineNo))
+	}
+	sort.Slice(cfd.Partial, func(i, j int) bool {
+		return cfd.Partial[i] < cfd.Partial[j]
+	})
+
+	for name, v := range data.FuncData {
+		cfd.Funcs = append(cfd.Funcs, CompactFuncData{
+			Name:      names.intern(name),
+			StartLine: uint32(v.StartLine),
+			EndLine:   uint32(v.EndLine),
+			HitCount:  v.HitCount,
+		})
+	}
+	sort.Slice(cfd.Funcs, func(i, j int) bool {
+		return cfd.Funcs[i].Name < cfd.Funcs[j].Name
+	})
+
+	count := 0
+	for _, v := range data.BranchData {
+		count += len(v)
+	}
+	cfd.Branches = make([]CompactBranchData, 0, count)
+	for lineNo, v := range data.BranchData {
+		for _, branch := range v {
+			cfd.Branches = append(cfd.Branches, newCompactBranchData(lineNo, branch))
+		}
+	}
+	// The order of branches on a single line is significant, so the sort
+	// must be stable.
+	sort.SliceStable(cfd.Branches, func(i, j int) bool {
+		return cfd.Branches[i].Line < cfd.Branches[j].Line
+	})
+
+	for k, v := range data.RegionData {
+		cfd.Regions = append(cfd.Regions, CompactRegionData{
+			StartLine: uint32(k.StartLine),
+			StartByte: uint32(k.StartByte),
+			EndLine:   uint32(k.EndLine),
+			EndByte:   uint32(k.EndByte),
+			HitCount:  v,
+		})
+	}
+	sort.Slice(cfd.Regions, func(i, j int) bool {
+		return compareCompactRegions(&cfd.Regions[i], &cfd.Regions[j]) < 0
+	})
+
+	return cfd
+}
+
+// Expand recreates the FileData for the file.
+func (cfd *CompactFileData) Expand() *FileData {
+	data := NewFileData(cfd.Filename)
+
+	for i, lineNo := range cfd.Lines {
+		data.AppendLineCountData(int(lineNo), cfd.Counts[i])
+	}
+	for _, lineNo := range cfd.Partial {
+		data.AppendPartialLine(int(lineNo))
+	}
+	for _, v := range cfd.Funcs {
+		data.AppendFunctionData(v.Name, int(v.StartLine), int(v.EndLine), v.HitCount)
+	}
+	for i := range cfd.Branches {
+		data.AppendBranchData(int(cfd.Branches[i].Line), cfd.Branches[i].Expand())
+	}
+	for _, v := range cfd.Regions {
+		data.AppendRegionData(int(v.StartLine), int(v.StartByte), int(v.EndLine), int(v.EndByte), v.HitCount)
+	}
+
+	return data
+}
+
+// CompactFileDataSet maintains coverage statistics for multiple files using
+// the compact representation.
+type CompactFileDataSet struct {
+	files map[string]*CompactFileData
+	names stringInterner
+}
+
+// NewCompactFileDataSet initializes a new CompactFileDataSet.
+func NewCompactFileDataSet() *CompactFileDataSet {
+	return &CompactFileDataSet{
+		files: make(map[string]*CompactFileData),
+		names: make(stringInterner),
+	}
+}
+
+// Len returns the number of files in the set.
+func (cfds *CompactFileDataSet) Len() int {
+	return len(cfds.files)
+}
+
+// Filenames returns the names of the files in the set, in sorted order.
+func (cfds *CompactFileDataSet) Filenames() []string {
+	names := make([]string, 0, len(cfds.files))
+	for name := range cfds.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Contains reports whether the set has data for a particular file.
+func (cfds *CompactFileDataSet) Contains(filename string) bool {
+	_, ok := cfds.files[filename]
+	return ok
+}
+
+// Lookup returns an expanded copy of the data for a particular file in the
+// set, or nil if the file is not present.
+func (cfds *CompactFileDataSet) Lookup(filename string) *FileData {
+	if tmp, ok := cfds.files[filename]; ok {
+		return tmp.Expand()
+	}
+	return nil
+}
+
+// Merge adds the data from fds to the set.  To limit the peak memory use,
+// files are removed from fds as they are merged.
+func (cfds *CompactFileDataSet) Merge(fds FileDataSet) {
+	for filename, data := range fds {
+		cfd := newCompactFileData(data, cfds.names)
+		if prev, ok := cfds.files[filename]; ok {
+			cfd = mergeCompactFileData(prev, cfd)
+		}
+		cfds.files[cfds.names.intern(filename)] = cfd
+		delete(fds, filename)
+	}
+}
+
+// ConvertRegionToLineData will use hitcounts from region data to infer hit
+// counts for line data for all of the files in the set.
+func (cfds *CompactFileDataSet) ConvertRegionToLineData() {
+	cfds.ConvertRegionToCodeLines(nil)
+}
+
+// ConvertRegionToCodeLines is equivalent to the method on FileDataSet.
+func (cfds *CompactFileDataSet) ConvertRegionToCodeLines(code func(filename string) map[int]bool) {
+	for filename, data := range cfds.files {
+		if len(data.Lines) == 0 && len(data.Regions) != 0 {
+			tmp := data.Expand()
+			tmp.ConvertRegionToCodeLines(codeLinesFor(code, filename))
+			cfds.files[filename] = newCompactFileData(tmp, cfds.names)
+		}
+	}
+}
+
+// mergeCompactFileData combines the data from src and dest, using the same
+// rules as when the data is loaded.  Since the slices are sorted, the data can
+// be merged in a single pass, without expanding the data.
+func mergeCompactFileData(dest, src *CompactFileData) *CompactFileData {
+	out := &CompactFileData{Filename: dest.Filename}
+	out.Lines, out.Counts = mergeCompactLines(dest.Lines, dest.Counts, src.Lines, src.Counts)
+	out.Partial = mergeCompactPartial(dest.Partial, src.Partial)
+	out.Funcs = mergeCompactFuncs(dest.Funcs, src.Funcs)
+	out.Branches = mergeCompactBranches(dest.Branches, src.Branches)
+	out.Regions = mergeCompactRegions(dest.Regions, src.Regions)
+	return out
+}
+
+func mergeCompactLines(aLines []uint32, aCounts []uint64, bLines []uint32, bCounts []uint64) ([]uint32, []uint64) {
+	lines := make([]uint32, 0, len(aLines)+len(bLines))
+	counts := make([]uint64, 0, len(aLines)+len(bLines))
+	i, j := 0, 0
+	for i < len(aLines) || j < len(bLines) {
+		switch {
+		case j == len(bLines) || (i < len(aLines) && aLines[i] < bLines[j]):
+			lines, counts = append(lines, aLines[i]), append(counts, aCounts[i])
+			i++
+		case i == len(aLines) || bLines[j] < aLines[i]:
+			lines, counts = append(lines, bLines[j]), append(counts, bCounts[j])
+			j++
+		default:
+			lines, counts = append(lines, aLines[i]), append(counts, aCounts[i]+bCounts[j])
+			i, j = i+1, j+1
+		}
+	}
+	return lines, counts
+}
+
+func mergeCompactPartial(a, b []uint32) []uint32 {
+	out := []uint32(nil)
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j == len(b) || (i < len(a) && a[i] < b[j]):
+			out = append(out, a[i])
+			i++
+		case i == len(a) || b[j] < a[i]:
+			out = append(out, b[j])
+			j++
+		default:
+			out = append(out, a[i])
+			i, j = i+1, j+1
+		}
+	}
+	return out
+}
+
+func mergeCompactFuncs(a, b []CompactFuncData) []CompactFuncData {
+	out := make([]CompactFuncData, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j == len(b) || (i < len(a) && a[i].Name < b[j].Name):
+			out = append(out, a[i])
+			i++
+		case i == len(a) || b[j].Name < a[i].Name:
+			out = append(out, b[j])
+			j++
+		default:
+			// Same as AppendFunctionData.
+			v := a[i]
+			v.HitCount += b[j].HitCount
+			if v.StartLine == 0 {
+				v.StartLine = b[j].StartLine
+			}
+			if v.EndLine == 0 {
+				v.EndLine = b[j].EndLine
+			}
+			out = append(out, v)
+			i, j = i+1, j+1
+		}
+	}
+	return out
+}
+
+// mergeCompactBranches combines the branches.  As with AppendBranchData, the
+// branches from b are added after those from a on the same line.
+func mergeCompactBranches(a, b []CompactBranchData) []CompactBranchData {
+	out := make([]CompactBranchData, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		if j == len(b) || (i < len(a) && a[i].Line <= b[j].Line) {
+			out = append(out, a[i])
+			i++
+		} else {
+			out = append(out, b[j])
+			j++
+		}
+	}
+	return out
+}
+
+// compareCompactRegions orders the regions by their location.
+func compareCompactRegions(a, b *CompactRegionData) int {
+	switch {
+	case a.StartLine != b.StartLine:
+		return compareUint32(a.StartLine, b.StartLine)
+	case a.StartByte != b.StartByte:
+		return compareUint32(a.StartByte, b.StartByte)
+	case a.EndLine != b.EndLine:
+		return compareUint32(a.EndLine, b.EndLine)
+	}
+	return compareUint32(a.EndByte, b.EndByte)
+}
+
+func compareUint32(a, b uint32) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+func mergeCompactRegions(a, b []CompactRegionData) []CompactRegionData {
+	out := make([]CompactRegionData, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		cmp := 0
+		if j == len(b) {
+			cmp = -1
+		} else if i == len(a) {
+			cmp = 1
+		} else {
+			cmp = compareCompactRegions(&a[i], &b[j])
+		}
+
+		switch {
+		case cmp < 0:
+			out = append(out, a[i])
+			i++
+		case cmp > 0:
+			out = append(out, b[j])
+			j++
+		default:
+			v := a[i]
+			v.HitCount += b[j].HitCount
+			out = append(out, v)
+			i, j = i+1, j+1
+		}
+	}
+	return out
+}
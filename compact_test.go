@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestCompactFileData(t *testing.T) {
+	cases := []string{
+		"example-7.4.0-branches",
+		"example-8.3.0-branches",
+		"example-9.1.0.c.gcov.json.gz",
+		"example-12.2.0-partial.gcno",
+		"example-lcov-1.13.info",
+		"example-llvm-8.0.1.json",
+		"scov-1.10.4.out",
+	}
+
+	for _, v := range cases {
+		t.Run(v, func(t *testing.T) {
+			data := make(FileDataSet)
+			err := loadFile(data, filepath.Join("./testdata", v), loadOptions{})
+			if err != nil {
+				t.Fatalf("could not read file: %s", err)
+			}
+
+			for filename, expected := range data {
+				out := NewCompactFileData(expected).Expand()
+				if !reflect.DeepEqual(expected, out) {
+					t.Errorf("round trip for %s does not match", filename)
+				}
+			}
+		})
+	}
+}
+
+func TestCompactBranchData(t *testing.T) {
+	cases := []BranchData{
+		{Status: BranchNotExec, Block: -1, Branch: -1},
+		{Status: BranchTaken, Count: 7, HasCount: true, Block: 2, Branch: 1, Fallthrough: true},
+		{Status: BranchNotTaken, HasCount: true, Block: 3, Branch: 0, Throw: true},
+	}
+
+	for i, v := range cases {
+		cbd := newCompactBranchData(10, v)
+		if cbd.Line != 10 {
+			t.Errorf("Case %d: expected line 10, got %d", i, cbd.Line)
+		}
+		if out := cbd.Expand(); out != v {
+			t.Errorf("Case %d: expected %v, got %v", i, v, out)
+		}
+	}
+}
+
+func TestMergeCompactFileData(t *testing.T) {
+	fill := func(data *FileData, offset int) {
+		for i := 1; i <= 6; i++ {
+			data.AppendLineCountData(i*2+offset, uint64(i))
+		}
+		data.AppendPartialLine(4 + offset)
+		data.AppendFunctionData("a", 0, 0, 1)
+		data.AppendFunctionData("b"+strconv.Itoa(offset), 2+offset, 8, 3)
+		data.AppendFunctionData("c", 2+offset, 9+offset, 2)
+		data.AppendBranchData(4, BranchData{Status: BranchTaken, Count: uint64(offset + 1), HasCount: true})
+		data.AppendBranchData(4, BranchData{Status: BranchNotTaken, HasCount: true, Block: offset})
+		data.AppendBranchData(6+offset, BranchData{Status: BranchNotExec})
+		data.AppendRegionData(1, 1, 5, 2, 3)
+		data.AppendRegionData(2+offset, 1, 2+offset, 10, 1)
+	}
+
+	expected := NewFileData("a.c")
+	fill(expected, 0)
+	fill(expected, 1)
+
+	a, b := NewFileData("a.c"), NewFileData("a.c")
+	fill(a, 0)
+	fill(b, 1)
+	out := mergeCompactFileData(NewCompactFileData(a), NewCompactFileData(b))
+	if got := out.Expand(); !reflect.DeepEqual(got, expected) {
+		LogNE(t, "merged data", expected, got)
+	}
+}
+
+func TestCompactFileDataSet(t *testing.T) {
+	cases := []struct {
+		filenames []string
+	}{
+		{[]string{"example-7.4.0-branches"}},
+		{[]string{"example-7.4.0-branches", "example-8.3.0-branches"}},
+		{[]string{"example-lcov-1.13.info", "example-lcov-1.13.info"}},
+		{[]string{"example-llvm-6.0.1.json", "example-llvm-8.0.1.json"}},
+	}
+
+	for _, v := range cases {
+		t.Run(v.filenames[len(v.filenames)-1], func(t *testing.T) {
+			expected := make(FileDataSet)
+			out := NewCompactFileDataSet()
+			for _, name := range v.filenames {
+				err := loadFile(expected, filepath.Join("./testdata", name), loadOptions{})
+				if err != nil {
+					t.Fatalf("could not read file: %s", err)
+				}
+
+				tmp := make(FileDataSet)
+				err = loadFile(tmp, filepath.Join("./testdata", name), loadOptions{})
+				if err != nil {
+					t.Fatalf("could not read file: %s", err)
+				}
+				out.Merge(tmp)
+				if len(tmp) != 0 {
+					t.Errorf("data not consumed by merge")
+				}
+			}
+			expected.ConvertRegionToLineData()
+			out.ConvertRegionToLineData()
+
+			if got := out.Len(); got != len(expected) {
+				LogNE(t, "file count", len(expected), got)
+			}
+			for filename, data := range expected {
+				if got := out.Lookup(filename); !reflect.DeepEqual(data, got) {
+					t.Errorf("data for %s does not match", filename)
+				}
+			}
+			if got := out.Lookup("missing.c"); got != nil {
+				t.Errorf("unexpected data for missing file")
+			}
+
+			report1 := NewTestReport()
+			report1.CollectStatistics(expected)
+			report2 := NewTestReport()
+			report2.CollectCompactStatistics(out)
+			if !reflect.DeepEqual(report1.Files, report2.Files) {
+				t.Errorf("file statistics do not match")
+			}
+		})
+	}
+}
+
+func TestLoadCompactFileDataSections(t *testing.T) {
+	dir, cleanup := TempDirectory(t)
+	defer cleanup()
+	writeStreamFileCases(t, dir)
+
+	for _, v := range streamFileCases {
+		t.Run(v.filename, func(t *testing.T) {
+			filter := newFileFilter(bytes.NewBuffer(nil), "", nil, true, "", nil)
+			filenames := []string{filepath.Join(dir, v.filename)}
+			expected, err := loadFileData(filenames, loadOptions{}, filter)
+			if err != nil {
+				t.Fatalf("could not load file: %s", err)
+			}
+			// The compact data has already had the regions converted.
+			expected.ConvertRegionToCodeLines(filter.codeLines)
+			compact, err := loadCompactFileData(filenames, loadOptions{}, filter)
+			if err != nil {
+				t.Fatalf("could not load file: %s", err)
+			}
+
+			if compact.Len() != len(expected) {
+				LogNE(t, "file count", len(expected), compact.Len())
+			}
+			for name, data := range expected {
+				if out := compact.Lookup(name); !reflect.DeepEqual(out, data) {
+					LogNE(t, "data for "+name, data, out)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ComponentMap assigns source files to named components.
+//
+// The mapping file has one rule per line, with a pattern followed by the name
+// of the component.  The patterns follow the same rules as CODEOWNERS files,
+// and when several rules match, the last rule takes precedence.  A line
+// starting with the keyword 'threshold', followed by a component name and a
+// percentage, sets the minimum line coverage for the component.  Blank lines,
+// and lines starting with '#', are ignored.
+type ComponentMap struct {
+	Rules      []ComponentRule
+	Thresholds map[string]float32
+}
+
+// ComponentRule assigns files that match the pattern to a component.
+type ComponentRule struct {
+	Pattern   string
+	Component string
+}
+
+// CodeOwners assigns owners to source files using the rules from a CODEOWNERS
+// file.
+type CodeOwners struct {
+	Rules []OwnerRule
+}
+
+// OwnerRule assigns owners to files that match the pattern.
+type OwnerRule struct {
+	Pattern string
+	Owners  []string
+}
+
+// Labels used for files that do not match any of the rules.
+const (
+	unassignedComponent = "(unassigned)"
+	unownedOwner        = "(unowned)"
+)
+
+func loadComponentMap(filename string) (*ComponentMap, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return parseComponentMap(file)
+}
+
+func parseComponentMap(file io.Reader) (*ComponentMap, error) {
+	cm := &ComponentMap{
+		Thresholds: make(map[string]float32),
+	}
+
+	lineNo := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineNo++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] == "threshold" {
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("line %d: expected a component and a threshold", lineNo)
+			}
+			value, err := strconv.ParseFloat(strings.TrimSuffix(fields[2], "%"), 32)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: can't parse threshold: %s", lineNo, err)
+			}
+			cm.Thresholds[fields[1]] = float32(value)
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected a pattern and a component", lineNo)
+		}
+
+		cm.Rules = append(cm.Rules, ComponentRule{
+			Pattern:   fields[0],
+			Component: fields[1],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return cm, nil
+}
+
+// Component returns the name of the component for the file.
+func (cm *ComponentMap) Component(filename string) string {
+	for i := len(cm.Rules) - 1; i >= 0; i-- {
+		if matchPathPattern(cm.Rules[i].Pattern, filename) {
+			return cm.Rules[i].Component
+		}
+	}
+	return unassignedComponent
+}
+
+func loadCodeOwners(filename string) (*CodeOwners, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return parseCodeOwners(file)
+}
+
+func parseCodeOwners(file io.Reader) (*CodeOwners, error) {
+	co := &CodeOwners{}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if ndx := strings.IndexByte(line, '#'); ndx >= 0 {
+			line = line[:ndx]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		// GitLab's CODEOWNERS files can contain section headers, which are
+		// not patterns.
+		if strings.HasPrefix(fields[0], "[") || strings.HasPrefix(fields[0], "^[") {
+			continue
+		}
+
+		co.Rules = append(co.Rules, OwnerRule{
+			Pattern: fields[0],
+			Owners:  fields[1:],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return co, nil
+}
+
+// Owners returns the owners for the file.  A rule without any owners
+// indicates that the file is unowned.
+func (co *CodeOwners) Owners(filename string) []string {
+	for i := len(co.Rules) - 1; i >= 0; i-- {
+		if matchPathPattern(co.Rules[i].Pattern, filename) {
+			if len(co.Rules[i].Owners) == 0 {
+				break
+			}
+			return co.Rules[i].Owners
+		}
+	}
+	return []string{unownedOwner}
+}
+
+// GroupStatistics is used to capture coverage statistics for a named group of
+// files, such as a component, or the files belonging to an owner.
+type GroupStatistics struct {
+	Name      string
+	FileCount int
+	LCoverage Coverage
+	FCoverage Coverage
+	BCoverage Coverage
+	RCoverage Coverage
+	Threshold float32 // Minimum line coverage, or zero if not set.
+}
+
+// HasThreshold returns true if a minimum line coverage was set.
+func (g *GroupStatistics) HasThreshold() bool {
+	return g.Threshold > 0
+}
+
+// BelowThreshold returns true if the line coverage is less than the minimum.
+func (g *GroupStatistics) BelowThreshold() bool {
+	return g.HasThreshold() && g.LCoverage.Valid() && !g.LCoverage.AtLeast(g.Threshold)
+}
+
+func (g *GroupStatistics) add(stats *FileStatistics) {
+	g.FileCount++
+	g.LCoverage = g.LCoverage.Add(stats.LCoverage)
+	g.FCoverage = g.FCoverage.Add(stats.FCoverage)
+	g.BCoverage = g.BCoverage.Add(stats.BCoverage)
+	g.RCoverage = g.RCoverage.Add(stats.RCoverage)
+}
+
+// CollectGroups assembles the coverage statistics for each component and
+// for each owner.  Either argument can be nil.
+func (r *Report) CollectGroups(components *ComponentMap, owners *CodeOwners) {
+	r.Components = nil
+	r.Owners = nil
+
+	if components != nil {
+		groups := make(map[string]*GroupStatistics)
+		for i := range r.Files {
+			name := components.Component(r.Files[i].Name)
+			lookupGroup(groups, name).add(&r.Files[i])
+		}
+		for name, threshold := range components.Thresholds {
+			if g, ok := groups[name]; ok {
+				g.Threshold = threshold
+			}
+		}
+		r.Components = sortGroups(groups)
+	}
+
+	if owners != nil {
+		groups := make(map[string]*GroupStatistics)
+		for i := range r.Files {
+			for _, name := range owners.Owners(r.Files[i].Name) {
+				lookupGroup(groups, name).add(&r.Files[i])
+			}
+		}
+		r.Owners = sortGroups(groups)
+	}
+}
+
+// FailedComponents returns the components whose line coverage is below their
+// threshold.
+func (r *Report) FailedComponents() []GroupStatistics {
+	out := []GroupStatistics(nil)
+	for _, v := range r.Components {
+		if v.BelowThreshold() {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// HasThresholds returns true if any component has a minimum line coverage.
+func (r *Report) HasThresholds() bool {
+	for _, v := range r.Components {
+		if v.HasThreshold() {
+			return true
+		}
+	}
+	return false
+}
+
+func lookupGroup(groups map[string]*GroupStatistics, name string) *GroupStatistics {
+	if tmp, ok := groups[name]; ok {
+		return tmp
+	}
+
+	tmp := &GroupStatistics{Name: name}
+	groups[name] = tmp
+	return tmp
+}
+
+func sortGroups(groups map[string]*GroupStatistics) []GroupStatistics {
+	out := make([]GroupStatistics, 0, len(groups))
+	for _, v := range groups {
+		out = append(out, *v)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testComponentMap = `# Comments are ignored
+*           app
+/methods/   numerics
+iterate.c   iteration
+
+threshold numerics 80
+threshold iteration 50%
+`
+
+const testCodeOwners = `# Comments are ignored
+*               @everyone
+/methods/       @alice @bob  # trailing comment
+[Section]
+gauss.c
+`
+
+func TestParseComponentMap(t *testing.T) {
+	cm, err := parseComponentMap(strings.NewReader(testComponentMap))
+	if err != nil {
+		t.Fatalf("could not parse: %s", err)
+	}
+
+	cases := []struct {
+		filename  string
+		component string
+	}{
+		{"example.c", "app"},
+		{"methods/gauss.c", "numerics"},
+		{"methods/iterate.c", "iteration"},
+	}
+	for _, v := range cases {
+		if got := cm.Component(v.filename); got != v.component {
+			t.Errorf("Case %s: expected %s, got %s", v.filename, v.component, got)
+		}
+	}
+
+	expected := map[string]float32{"numerics": 80, "iteration": 50}
+	if !reflect.DeepEqual(cm.Thresholds, expected) {
+		LogNE(t, "thresholds", expected, cm.Thresholds)
+	}
+}
+
+func TestParseComponentMapFail(t *testing.T) {
+	cases := []string{
+		"example.c",
+		"example.c app extra",
+		"threshold app",
+		"threshold app #",
+	}
+
+	for _, v := range cases {
+		_, err := parseComponentMap(strings.NewReader(v))
+		if err == nil {
+			t.Errorf("Case %s: unexpected success", v)
+		}
+	}
+}
+
+func TestParseCodeOwners(t *testing.T) {
+	co, err := parseCodeOwners(strings.NewReader(testCodeOwners))
+	if err != nil {
+		t.Fatalf("could not parse: %s", err)
+	}
+
+	cases := []struct {
+		filename string
+		owners   []string
+	}{
+		{"example.c", []string{"@everyone"}},
+		{"methods/iterate.c", []string{"@alice", "@bob"}},
+		{"methods/gauss.c", []string{unownedOwner}},
+	}
+	for _, v := range cases {
+		if got := co.Owners(v.filename); !reflect.DeepEqual(got, v.owners) {
+			t.Errorf("Case %s: expected %v, got %v", v.filename, v.owners, got)
+		}
+	}
+}
+
+func TestReportCollectGroups(t *testing.T) {
+	data := make(FileDataSet)
+	err := loadFile(data, "./testdata/example-7.4.0-branches", loadOptions{})
+	if err != nil {
+		t.Fatalf("could not read file: %s", err)
+	}
+
+	cm, err := parseComponentMap(strings.NewReader(testComponentMap))
+	if err != nil {
+		t.Fatalf("could not parse: %s", err)
+	}
+	co, err := parseCodeOwners(strings.NewReader(testCodeOwners))
+	if err != nil {
+		t.Fatalf("could not parse: %s", err)
+	}
+
+	report := NewTestReport()
+	report.CollectStatistics(data)
+	report.CollectGroups(cm, co)
+
+	components := []GroupStatistics{
+		{Name: "app", FileCount: 1, LCoverage: Coverage{9, 10}, FCoverage: Coverage{1, 1}, BCoverage: Coverage{2, 4}},
+		{Name: "iteration", FileCount: 1, LCoverage: Coverage{6, 8}, FCoverage: Coverage{1, 1}, BCoverage: Coverage{3, 4}, Threshold: 50},
+		{Name: "numerics", FileCount: 1, LCoverage: Coverage{3, 4}, FCoverage: Coverage{1, 1}, BCoverage: Coverage{1, 2}, Threshold: 80},
+	}
+	if !reflect.DeepEqual(report.Components, components) {
+		LogNE(t, "components", components, report.Components)
+	}
+
+	owners := []string(nil)
+	for _, v := range report.Owners {
+		owners = append(owners, v.Name+"="+v.LCoverage.String())
+	}
+	expected := []string{unownedOwner + "=3/4", "@alice=6/8", "@bob=6/8", "@everyone=9/10"}
+	if !reflect.DeepEqual(owners, expected) {
+		LogNE(t, "owners", expected, owners)
+	}
+
+	if !report.HasThresholds() {
+		t.Errorf("expected thresholds")
+	}
+	if failed := report.FailedComponents(); len(failed) != 1 || failed[0].Name != "numerics" {
+		LogNE(t, "failed components", "numerics", failed)
+	}
+}
+
+func TestGroupStatistics_BelowThreshold(t *testing.T) {
+	cases := []struct {
+		coverage  Coverage
+		threshold float32
+		expected  bool
+	}{
+		{Coverage{0, 0}, 50, false},
+		{Coverage{3, 4}, 0, false},
+		{Coverage{3, 4}, 80, true},
+		{Coverage{4, 5}, 80, false},
+		{Coverage{671089, 671089}, 100, false},
+	}
+
+	for _, v := range cases {
+		g := GroupStatistics{LCoverage: v.coverage, Threshold: v.threshold}
+		if out := g.BelowThreshold(); out != v.expected {
+			t.Errorf("Case %s@%g: expected %v, got %v", v.coverage, v.threshold, v.expected, out)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 )
 
@@ -23,6 +24,18 @@ func (c Coverage) Q() float32 {
 	return 100 - float32(c.Hits)*100/float32(c.Total)
 }
 
+// AtLeast returns true if the percentage of lines or functions that were
+// executed is at least the threshold.  Unlike comparing with P, the
+// comparison is exact, so full coverage always meets a threshold of 100.
+func (c Coverage) AtLeast(threshold float32) bool {
+	return float64(c.Hits)*100 >= float64(threshold)*float64(c.Total)
+}
+
+// Misses returns the count of lines or functions that were not executed.
+func (c Coverage) Misses() int {
+	return c.Total - c.Hits
+}
+
 // Add combines the coverage data from different scopes.
 func (c Coverage) Add(delta Coverage) Coverage {
 	c.Hits += delta.Hits
@@ -30,17 +43,6 @@ func (c Coverage) Add(delta Coverage) Coverage {
 	return c
 }
 
-// Rating returns the rating (low, medium, or high) for this coverage.
-func (c Coverage) Rating() CoverageRating {
-	if c.P() >= 90 {
-		return HighCoverage
-	}
-	if c.P() >= 75 {
-		return MediumCoverage
-	}
-	return LowCoverage
-}
-
 // String returns a human readable string representing the coverage.
 func (c Coverage) String() string {
 	return strconv.FormatInt(int64(c.Hits), 10) + "/" +
@@ -71,30 +73,10 @@ func (c Coverage) Valid() bool {
 	return c.Total > 0
 }
 
-// CoverageRating is a classification of the coverage into low, medium or high.
-type CoverageRating uint8
-
-// These constants provide a rough classification for the amount of coverage in a scope.
-const (
-	LowCoverage CoverageRating = iota
-	MediumCoverage
-	HighCoverage
-)
-
-// String returns a string representation of the rating.
-func (cr CoverageRating) String() string {
-	if cr == LowCoverage {
-		return "low"
-	}
-	if cr == MediumCoverage {
-		return "medium"
-	}
-	return "high"
-}
-
 // FuncData represents data about a function.
 type FuncData struct {
 	StartLine int
+	EndLine   int // Last line of the function, or zero if unknown.
 	HitCount  uint64
 }
 
@@ -109,6 +91,18 @@ const (
 	BranchNotExec
 )
 
+// BranchData represents data about a single branch.  Identifiers and counts
+// are only available for some input formats.
+type BranchData struct {
+	Status      BranchStatus
+	Count       uint64 // Number of times the branch was taken.
+	HasCount    bool   // Indicates whether the input included a count.
+	Block       int    // Basic block containing the branch, or -1 if unknown.
+	Branch      int    // Branch number within the block, or -1 if unknown.
+	Throw       bool   // The branch is taken when an exception is thrown.
+	Fallthrough bool   // The branch falls through to the next block.
+}
+
 // Region defines a region of code in a source file.
 type Region struct {
 	StartLine int
@@ -117,23 +111,27 @@ type Region struct {
 	EndByte   int
 }
 
-// FileData maintains coverage statistics for a single file.
+// FileData maintains coverage statistics for a single file.  PartialLines
+// marks lines that contain blocks that were not executed, which gcov shows
+// with a '*' after the hit count.
 type FileData struct {
-	Filename   string
-	LineData   map[int]uint64
-	FuncData   map[string]FuncData
-	BranchData map[int][]BranchStatus
-	RegionData map[Region]uint64
+	Filename     string
+	LineData     map[int]uint64
+	PartialLines map[int]bool
+	FuncData     map[string]FuncData
+	BranchData   map[int][]BranchData
+	RegionData   map[Region]uint64
 }
 
 // NewFileData initializes a new FileData.
 func NewFileData(filename string) *FileData {
 	return &FileData{
-		Filename:   filename,
-		LineData:   make(map[int]uint64),
-		FuncData:   make(map[string]FuncData),
-		BranchData: make(map[int][]BranchStatus),
-		RegionData: make(map[Region]uint64),
+		Filename:     filename,
+		LineData:     make(map[int]uint64),
+		PartialLines: make(map[int]bool),
+		FuncData:     make(map[string]FuncData),
+		BranchData:   make(map[int][]BranchData),
+		RegionData:   make(map[Region]uint64),
 	}
 }
 
@@ -150,6 +148,102 @@ func (file *FileData) LineCoverage() Coverage {
 	return Coverage{a, b}
 }
 
+// FirstMiss returns the first line that was not executed.  If all lines were
+// executed, the return is zero.
+func (file *FileData) FirstMiss() int {
+	first := 0
+	for lineNo, v := range file.LineData {
+		if v == 0 && (first == 0 || lineNo < first) {
+			first = lineNo
+		}
+	}
+	return first
+}
+
+// PartialBranches returns true if some, but not all, of the branches on the
+// line were taken.
+func (file *FileData) PartialBranches(lineNo int) bool {
+	taken, notTaken := false, false
+	for _, v := range file.BranchData[lineNo] {
+		if v.Status == BranchTaken {
+			taken = true
+		} else {
+			notTaken = true
+		}
+	}
+	return taken && notTaken
+}
+
+// PartialLine returns true if the line was executed, but only partially.
+// Either the line contains blocks that were not executed, or some, but not
+// all, of the branches on the line were taken.
+func (file *FileData) PartialLine(lineNo int) bool {
+	if file.PartialLines[lineNo] && file.LineData[lineNo] != 0 {
+		return true
+	}
+	return file.PartialBranches(lineNo)
+}
+
+// FuncStatistics returns the statistics for the functions in the file, sorted
+// by their starting line.  If the input did not include the last line of a
+// function, the function is assumed to extend until the start of the next
+// function.
+func (file *FileData) FuncStatistics(filename string) []FuncStatistics {
+	out := make([]FuncStatistics, 0, len(file.FuncData))
+	for name, v := range file.FuncData {
+		out = append(out, FuncStatistics{
+			Name:      name,
+			Filename:  filename,
+			StartLine: v.StartLine,
+			EndLine:   v.EndLine,
+			HitCount:  v.HitCount,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].StartLine != out[j].StartLine {
+			return out[i].StartLine < out[j].StartLine
+		}
+		return out[i].Name < out[j].Name
+	})
+
+	lastLine := 0
+	for lineNo := range file.LineData {
+		if lineNo > lastLine {
+			lastLine = lineNo
+		}
+	}
+
+	for i := range out {
+		if out[i].StartLine <= 0 {
+			continue
+		}
+		if out[i].EndLine < out[i].StartLine {
+			out[i].EndLine = lastLine
+			for _, v := range out[i+1:] {
+				if v.StartLine > out[i].StartLine {
+					out[i].EndLine = v.StartLine - 1
+					break
+				}
+			}
+			if out[i].EndLine < out[i].StartLine {
+				out[i].EndLine = out[i].StartLine
+			}
+		}
+
+		a, b := 0, 0
+		for lineNo := out[i].StartLine; lineNo <= out[i].EndLine; lineNo++ {
+			if hitCount, ok := file.LineData[lineNo]; ok {
+				if hitCount != 0 {
+					a++
+				}
+				b++
+			}
+		}
+		out[i].LCoverage = Coverage{a, b}
+	}
+	return out
+}
+
 // FuncCoverage calculates function coverage for the file.
 func (file *FileData) FuncCoverage() Coverage {
 	a, b := 0, 0
@@ -169,7 +263,7 @@ func (file *FileData) BranchCoverage() Coverage {
 
 	for _, v := range file.BranchData {
 		for _, v := range v {
-			if v == BranchTaken {
+			if v.Status == BranchTaken {
 				a++
 			}
 			b++
@@ -196,13 +290,26 @@ func (file *FileData) RegionCoverage() Coverage {
 //
 // This method cannot be called if the line data already exists.
 func (file *FileData) ConvertRegionToLineData() {
+	file.ConvertRegionToCodeLines(nil)
+}
+
+// ConvertRegionToCodeLines is similar to ConvertRegionToLineData, but line
+// data is only inferred for the lines in code.  Regions span every line
+// between their start and end, including blank lines and comments, so the
+// source is used to restrict the line data to lines that contain code.  If
+// code is nil, all lines are used.
+//
+// This method cannot be called if the line data already exists.
+func (file *FileData) ConvertRegionToCodeLines(code map[int]bool) {
 	if len(file.LineData) != 0 {
 		panic("can not convert region data to line data if line data already present")
 	}
 
 	for k, hitCount := range file.RegionData {
 		for i := k.StartLine; i <= k.EndLine; i++ {
-			file.AppendLineCountData(i, hitCount)
+			if code == nil || code[i] {
+				file.AppendLineCountData(i, hitCount)
+			}
 		}
 	}
 }
@@ -212,23 +319,37 @@ func (file *FileData) AppendLineCountData(lineNo int, hitCount uint64) {
 	file.LineData[lineNo] += hitCount
 }
 
-// AppendFunctionData appends hit count data for a function.
-func (file *FileData) AppendFunctionData(funcName string, funcStart int, hitCount uint64) {
+// AppendPartialLine marks a line as containing blocks that were not
+// executed.
+func (file *FileData) AppendPartialLine(lineNo int) {
+	file.PartialLines[lineNo] = true
+}
+
+// AppendFunctionData appends hit count data for a function.  The line
+// numbers can be zero if they are not known.
+func (file *FileData) AppendFunctionData(funcName string, funcStart, funcEnd int, hitCount uint64) {
 	if v, ok := file.FuncData[funcName]; ok {
 		v.HitCount += hitCount
+		if v.StartLine == 0 {
+			v.StartLine = funcStart
+		}
+		if v.EndLine == 0 {
+			v.EndLine = funcEnd
+		}
 		file.FuncData[funcName] = v
 	} else {
 		file.FuncData[funcName] = FuncData{
 			StartLine: funcStart,
+			EndLine:   funcEnd,
 			HitCount:  hitCount,
 		}
 	}
 }
 
 // AppendBranchData appends hit count data for a branch.
-func (file *FileData) AppendBranchData(lineNo int, status BranchStatus) {
+func (file *FileData) AppendBranchData(lineNo int, data BranchData) {
 	tmp := file.BranchData[lineNo]
-	tmp = append(tmp, status)
+	tmp = append(tmp, data)
 	file.BranchData[lineNo] = tmp
 }
 
@@ -252,6 +373,12 @@ func (fds FileDataSet) FileData(filename string) *FileData {
 	return tmp
 }
 
+// Lookup returns the data for a particular file in the set, or nil if the
+// file is not present.
+func (fds FileDataSet) Lookup(filename string) *FileData {
+	return fds[filename]
+}
+
 // LineCoverage calculates line coverage over all of the files in the set.
 func (fds FileDataSet) LineCoverage() Coverage {
 	lcov := Coverage{}
@@ -275,9 +402,24 @@ func (fds FileDataSet) RegionCoverage() Coverage {
 //
 // This method cannot be called if the line data already exists.
 func (fds FileDataSet) ConvertRegionToLineData() {
-	for _, data := range fds {
-		if len(data.LineData) == 0 {
-			data.ConvertRegionToLineData()
+	fds.ConvertRegionToCodeLines(nil)
+}
+
+// ConvertRegionToCodeLines is similar to ConvertRegionToLineData, but the
+// function code is called to find the lines in each file that contain code.
+// Refer to the method on FileData for details.  If code is nil, or returns
+// nil for a file, all lines are used.
+func (fds FileDataSet) ConvertRegionToCodeLines(code func(filename string) map[int]bool) {
+	for filename, data := range fds {
+		if len(data.LineData) == 0 && len(data.RegionData) != 0 {
+			data.ConvertRegionToCodeLines(codeLinesFor(code, filename))
 		}
 	}
 }
+
+func codeLinesFor(code func(string) map[int]bool, filename string) map[int]bool {
+	if code == nil {
+		return nil
+	}
+	return code(filename)
+}
@@ -1,38 +1,10 @@
 package main
 
 import (
+	"reflect"
 	"testing"
 )
 
-func TestCoverage_Rating(t *testing.T) {
-	cases := []struct {
-		hits     int
-		count    int
-		expected CoverageRating
-		str      string
-	}{
-		{0, 100, LowCoverage, "low"},
-		{50, 100, LowCoverage, "low"},
-		{74, 100, LowCoverage, "low"},
-		{75, 100, MediumCoverage, "medium"},
-		{89, 100, MediumCoverage, "medium"},
-		{90, 100, HighCoverage, "high"},
-		{45, 50, HighCoverage, "high"},
-	}
-
-	for _, v := range cases {
-		cov := Coverage{v.hits, v.count}
-		t.Run(cov.String(), func(t *testing.T) {
-			if out := cov.Rating(); out != v.expected {
-				t.Errorf("mismatch, expected %v, got %v", v.expected, out)
-			}
-			if out := cov.Rating().String(); out != v.str {
-				t.Errorf("mismatch, expected %v, got %v", v.str, out)
-			}
-		})
-	}
-}
-
 func TestFileDataSetFileData(t *testing.T) {
 	fds := FileDataSet{}
 
@@ -49,3 +21,122 @@ func TestFileDataSetFileData(t *testing.T) {
 		t.Errorf("expected a different response")
 	}
 }
+
+func TestFileData_ConvertRegionToCodeLines(t *testing.T) {
+	cases := []struct {
+		name     string
+		code     map[int]bool
+		expected map[int]uint64
+	}{
+		{"all", nil, map[int]uint64{1: 2, 2: 2, 3: 5, 4: 5}},
+		{"code", map[int]bool{1: true, 3: true}, map[int]uint64{1: 2, 3: 5}},
+		{"none", map[int]bool{}, map[int]uint64{}},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(t *testing.T) {
+			data := NewFileData("example.c")
+			data.AppendRegionData(1, 1, 4, 2, 2)
+			data.AppendRegionData(3, 1, 4, 2, 3)
+			data.ConvertRegionToCodeLines(v.code)
+			if !reflect.DeepEqual(data.LineData, v.expected) {
+				LogNE(t, "line data", v.expected, data.LineData)
+			}
+		})
+	}
+}
+
+func TestFileData_FirstMiss(t *testing.T) {
+	data := NewFileData("example.c")
+	if got := data.FirstMiss(); got != 0 {
+		LogNE(t, "first miss", 0, got)
+	}
+
+	data.AppendLineCountData(3, 1)
+	data.AppendLineCountData(12, 0)
+	data.AppendLineCountData(7, 0)
+	if got := data.FirstMiss(); got != 7 {
+		LogNE(t, "first miss", 7, got)
+	}
+}
+
+func TestFileData_PartialBranches(t *testing.T) {
+	data := NewFileData("example.c")
+	data.AppendBranchData(3, BranchData{Status: BranchTaken})
+	data.AppendBranchData(3, BranchData{Status: BranchNotTaken})
+	data.AppendBranchData(5, BranchData{Status: BranchTaken})
+	data.AppendBranchData(5, BranchData{Status: BranchTaken})
+	data.AppendBranchData(7, BranchData{Status: BranchNotExec})
+	data.AppendBranchData(7, BranchData{Status: BranchNotExec})
+
+	cases := []struct {
+		lineNo   int
+		expected bool
+	}{
+		{1, false},
+		{3, true},
+		{5, false},
+		{7, false},
+	}
+
+	for _, v := range cases {
+		if got := data.PartialBranches(v.lineNo); got != v.expected {
+			t.Errorf("Case %d: expected %v, got %v", v.lineNo, v.expected, got)
+		}
+	}
+}
+
+func TestFileData_PartialLine(t *testing.T) {
+	data := NewFileData("example.c")
+	data.AppendLineCountData(1, 4)
+	data.AppendLineCountData(2, 4)
+	data.AppendPartialLine(2)
+	data.AppendLineCountData(3, 0)
+	data.AppendPartialLine(3)
+	data.AppendLineCountData(4, 1)
+	data.AppendBranchData(4, BranchData{Status: BranchTaken})
+	data.AppendBranchData(4, BranchData{Status: BranchNotTaken})
+
+	cases := []struct {
+		lineNo   int
+		expected bool
+	}{
+		{1, false},
+		{2, true},
+		{3, false},
+		{4, true},
+		{5, false},
+	}
+
+	for _, v := range cases {
+		if got := data.PartialLine(v.lineNo); got != v.expected {
+			t.Errorf("Case %d: expected %v, got %v", v.lineNo, v.expected, got)
+		}
+	}
+}
+
+func TestFileData_FuncStatistics(t *testing.T) {
+	data := NewFileData("example.c")
+	for lineNo := 1; lineNo <= 10; lineNo++ {
+		data.AppendLineCountData(lineNo, uint64(lineNo%3))
+	}
+	data.AppendFunctionData("b", 5, 0, 2)
+	data.AppendFunctionData("a", 1, 3, 1)
+	data.AppendFunctionData("c", 0, 0, 0)
+	data.AppendFunctionData("c", 8, 0, 0)
+
+	expected := []FuncStatistics{
+		{"a", "example.c", 1, 3, 1, Coverage{2, 3}},
+		{"b", "example.c", 5, 7, 2, Coverage{2, 3}},
+		{"c", "example.c", 8, 10, 0, Coverage{2, 3}},
+	}
+	out := data.FuncStatistics("example.c")
+	if len(out) != len(expected) {
+		t.Fatalf("expected %d functions, got %d", len(expected), len(out))
+	}
+	for i := range expected {
+		if out[i] != expected[i] {
+			t.Errorf("Case %d: expected %v, got %v", i, expected[i], out[i])
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// coveragePyData is the JSON report written by coverage.py, using the command
+// "coverage json".
+type coveragePyData struct {
+	Meta  *coveragePyMeta           `json:"meta"`
+	Files map[string]coveragePyFile `json:"files"`
+}
+
+// coveragePyMeta describes the report.  The format is a version number for
+// the layout of the report, and is used to identify reports from coverage.py.
+type coveragePyMeta struct {
+	Version        string `json:"version"`
+	Format         int    `json:"format"`
+	BranchCoverage bool   `json:"branch_coverage"`
+}
+
+// coveragePyFile contains the coverage for a single source file.  Hit counts
+// are not available, only whether or not lines were executed.  Branches are
+// reported as arcs between lines.  A negative destination indicates an exit
+// from the function.
+type coveragePyFile struct {
+	ExecutedLines    []int                       `json:"executed_lines"`
+	MissingLines     []int                       `json:"missing_lines"`
+	ExecutedBranches [][2]int                    `json:"executed_branches"`
+	MissingBranches  [][2]int                    `json:"missing_branches"`
+	Functions        map[string]coveragePyRegion `json:"functions"`
+}
+
+// coveragePyRegion contains the coverage for a function.  Functions are only
+// reported by version 7.5 and later.
+type coveragePyRegion struct {
+	ExecutedLines []int `json:"executed_lines"`
+	MissingLines  []int `json:"missing_lines"`
+}
+
+// loadCoveragePyData loads the coverage data from the report.  The name
+// identifies the report in errors.
+func loadCoveragePyData(fds FileDataSet, data *coveragePyData, name string) error {
+	if data.Meta == nil || data.Meta.Format <= 0 {
+		return fmt.Errorf("%s: missing format for JSON data from coverage.py", name)
+	}
+
+	for filename, file := range data.Files {
+		currentData := fds.FileData(filename)
+
+		executed := make(map[int]bool, len(file.ExecutedLines))
+		for _, v := range file.ExecutedLines {
+			executed[v] = true
+			currentData.AppendLineCountData(v, 1)
+		}
+		for _, v := range file.MissingLines {
+			currentData.AppendLineCountData(v, 0)
+		}
+
+		loadCoveragePyBranches(currentData, file, executed)
+
+		for funcName, fn := range file.Functions {
+			// Code outside of any function is reported with an empty name.
+			if funcName == "" {
+				continue
+			}
+			start, end := lineRange(fn.ExecutedLines, fn.MissingLines)
+			hitCount := uint64(0)
+			if len(fn.ExecutedLines) > 0 {
+				hitCount = 1
+			}
+			currentData.AppendFunctionData(funcName, start, end, hitCount)
+		}
+	}
+	return nil
+}
+
+// coveragePyArc is a branch from a source line.
+type coveragePyArc struct {
+	To    int
+	Taken bool
+}
+
+func loadCoveragePyBranches(currentData *FileData, file coveragePyFile, executed map[int]bool) {
+	arcs := make(map[int][]coveragePyArc)
+	for _, v := range file.ExecutedBranches {
+		arcs[v[0]] = append(arcs[v[0]], coveragePyArc{v[1], true})
+	}
+	for _, v := range file.MissingBranches {
+		arcs[v[0]] = append(arcs[v[0]], coveragePyArc{v[1], false})
+	}
+
+	for lineNo, list := range arcs {
+		// Order the branches by destination, with exits last.
+		sort.Slice(list, func(i, j int) bool {
+			a, b := list[i].To, list[j].To
+			if (a < 0) != (b < 0) {
+				return b < 0
+			}
+			if a < 0 {
+				return a > b
+			}
+			return a < b
+		})
+
+		for i, v := range list {
+			data := BranchData{Block: -1, Branch: i}
+			switch {
+			case v.Taken:
+				data.Status = BranchTaken
+			case executed[lineNo]:
+				data.Status = BranchNotTaken
+			default:
+				data.Status = BranchNotExec
+			}
+			currentData.AppendBranchData(lineNo, data)
+		}
+	}
+}
+
+// lineRange returns the first and last line in the lists.
+func lineRange(lists ...[]int) (start, end int) {
+	for _, list := range lists {
+		for _, v := range list {
+			if start == 0 || v < start {
+				start = v
+			}
+			if v > end {
+				end = v
+			}
+		}
+	}
+	return start, end
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadCoveragePyFile(t *testing.T) {
+	fds := make(FileDataSet)
+	err := loadFile(fds, "./testdata/example-coveragepy.json", loadOptions{})
+	if err != nil {
+		t.Fatalf("could not load file: %s", err)
+	}
+
+	if len(fds) != 2 {
+		LogNE(t, "file count", 2, len(fds))
+	}
+	data, ok := fds["pkg/wrapper.py"]
+	if !ok {
+		t.Fatalf("missing file")
+	}
+
+	lines := map[int]uint64{1: 1, 3: 1, 4: 1, 5: 1, 6: 1, 7: 0, 8: 1, 11: 1, 12: 0, 13: 0}
+	if !reflect.DeepEqual(data.LineData, lines) {
+		LogNE(t, "line data", lines, data.LineData)
+	}
+
+	funcs := map[string]FuncData{
+		"gauss":  {StartLine: 4, EndLine: 8, HitCount: 1},
+		"unused": {StartLine: 12, EndLine: 13, HitCount: 0},
+	}
+	if !reflect.DeepEqual(data.FuncData, funcs) {
+		LogNE(t, "function data", funcs, data.FuncData)
+	}
+
+	branches := map[int][]BranchData{
+		5: {
+			{Status: BranchTaken, Block: -1, Branch: 0},
+			{Status: BranchTaken, Block: -1, Branch: 1},
+		},
+		6: {
+			{Status: BranchNotTaken, Block: -1, Branch: 0},
+		},
+		12: {
+			{Status: BranchNotExec, Block: -1, Branch: 0},
+		},
+	}
+	if !reflect.DeepEqual(data.BranchData, branches) {
+		LogNE(t, "branch data", branches, data.BranchData)
+	}
+	if cov := data.BranchCoverage(); cov != (Coverage{2, 4}) {
+		LogNE(t, "branch coverage", Coverage{2, 4}, cov)
+	}
+}
+
+func TestLoadCoveragePyBranches(t *testing.T) {
+	file := coveragePyFile{
+		ExecutedBranches: [][2]int{{3, -1}, {3, 7}},
+		MissingBranches:  [][2]int{{3, -2}, {3, 4}},
+	}
+	data := NewFileData("a.py")
+	loadCoveragePyBranches(data, file, map[int]bool{3: true})
+
+	// Branches are ordered by destination, with exits last.
+	expected := []BranchStatus{BranchNotTaken, BranchTaken, BranchTaken, BranchNotTaken}
+	if len(data.BranchData[3]) != len(expected) {
+		t.Fatalf("unexpected number of branches: %d", len(data.BranchData[3]))
+	}
+	for i, v := range data.BranchData[3] {
+		if v.Status != expected[i] {
+			LogNE(t, "status", expected[i], v.Status)
+		}
+		if v.Branch != i {
+			LogNE(t, "branch", i, v.Branch)
+		}
+	}
+}
+
+func TestLoadCoveragePyFileMinimal(t *testing.T) {
+	// Older versions do not report functions.
+	const value = `{"meta":{"version":"5.5","format":1},"files":{"a.py":{"executed_lines":[1,2],"missing_lines":[3]}}}`
+
+	fds := make(FileDataSet)
+	err := loadJSONFile(fds, strings.NewReader(value), loadOptions{})
+	if err != nil {
+		t.Fatalf("could not load file: %s", err)
+	}
+	if cov := fds["a.py"].LineCoverage(); cov != (Coverage{2, 3}) {
+		LogNE(t, "line coverage", Coverage{2, 3}, cov)
+	}
+}
+
+func TestLoadCoveragePyFileFormat(t *testing.T) {
+	cases := []string{
+		`{"files":{}}`,
+		`{"meta":{"version":"7.5.0"},"files":{}}`,
+		`{"meta":{"format":0},"files":{}}`,
+	}
+
+	for _, v := range cases {
+		err := loadJSONFile(make(FileDataSet), strings.NewReader(v), loadOptions{})
+		if err == nil || !strings.Contains(err.Error(), "coverage.py") {
+			t.Errorf("Case %s: expected error for coverage.py, got %v", v, err)
+		}
+	}
+}
+
+func TestLineRange(t *testing.T) {
+	cases := []struct {
+		a, b       []int
+		start, end int
+	}{
+		{nil, nil, 0, 0},
+		{[]int{4, 5}, []int{7}, 4, 7},
+		{[]int{9}, []int{2, 3}, 2, 9},
+	}
+
+	for _, v := range cases {
+		start, end := lineRange(v.a, v.b)
+		if start != v.start || end != v.end {
+			t.Errorf("expected %d-%d, got %d-%d", v.start, v.end, start, end)
+		}
+	}
+}
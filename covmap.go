@@ -0,0 +1,723 @@
+package main
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Kinds of regions in the coverage mapping.
+const (
+	covCodeRegion = iota
+	covExpansionRegion
+	covSkippedRegion
+	covGapRegion
+	covBranchRegion
+	covMCDCDecisionRegion
+	covMCDCBranchRegion
+)
+
+// covReader reads the unsigned LEB128 values and strings in the coverage
+// mapping.
+type covReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+var errCovTruncated = errors.New("unexpected end of coverage mapping")
+
+func (r *covReader) uleb128() uint64 {
+	v, shift := uint64(0), uint(0)
+	for {
+		if r.pos >= len(r.data) || shift > 63 {
+			r.err = errCovTruncated
+			r.pos = len(r.data)
+			return 0
+		}
+		b := r.data[r.pos]
+		r.pos++
+		v |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return v
+		}
+		shift += 7
+	}
+}
+
+// int reads a value that must fit in an int, such as a line number.
+func (r *covReader) int() int {
+	v := r.uleb128()
+	if v > math.MaxInt32 {
+		r.err = errors.New("value out of range in coverage mapping")
+		return 0
+	}
+	return int(v)
+}
+
+func (r *covReader) bytes(n uint64) []byte {
+	if n > uint64(len(r.data)-r.pos) {
+		r.err = errCovTruncated
+		r.pos = len(r.data)
+		return nil
+	}
+	v := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return v
+}
+
+// covLoc is a location in a source file.
+type covLoc struct {
+	Line   int
+	Column int
+}
+
+func (a covLoc) less(b covLoc) bool {
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Column < b.Column
+}
+
+// covRegion is a region in the coverage mapping for a function.  The count
+// for the region is given by an encoded counter, which is either zero, a
+// reference to a counter in the profile, or a reference to an expression.
+type covRegion struct {
+	Kind           int
+	Counter        uint64
+	FileID         int
+	ExpandedFileID int
+	Start, End     covLoc
+	Count          uint64
+}
+
+// covExpression is the sum or difference of two encoded counters.
+type covExpression struct {
+	LHS, RHS uint64
+}
+
+// covFunction is the coverage mapping for a function.
+type covFunction struct {
+	NameRef     uint64
+	FuncHash    uint64
+	Filenames   []string
+	Expressions []covExpression
+	Regions     []covRegion
+}
+
+// covMapping contains the coverage mapping read from instrumented binaries.
+type covMapping struct {
+	Functions []*covFunction
+	Names     map[uint64]string
+}
+
+// loadObject reads the coverage mapping from an ELF binary.  The mapping is
+// split between the sections __llvm_covmap, which lists the source files
+// for each translation unit, and __llvm_covfun, which has the regions for
+// each function.
+func (m *covMapping) loadObject(filename string) error {
+	file, err := elf.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Object files, unlike linked binaries, can have several sections with
+	// the same name, such as one __llvm_covfun section for each function.
+	section := func(name string) ([]byte, error) {
+		data := []byte(nil)
+		for _, s := range file.Sections {
+			if s.Name != name {
+				continue
+			}
+			tmp, err := s.Data()
+			if err != nil {
+				return nil, err
+			}
+			if s.Addralign > 1 {
+				for uint64(len(data))%s.Addralign != 0 {
+					data = append(data, 0)
+				}
+			}
+			data = append(data, tmp...)
+		}
+		return data, nil
+	}
+
+	covmap, err := section("__llvm_covmap")
+	if err != nil {
+		return err
+	}
+	covfun, err := section("__llvm_covfun")
+	if err != nil {
+		return err
+	}
+	names, err := section("__llvm_prf_names")
+	if err != nil {
+		return err
+	}
+	if covmap == nil {
+		return fmt.Errorf("%s: no coverage mapping, build with -fprofile-instr-generate -fcoverage-mapping or -C instrument-coverage", filename)
+	}
+
+	err = m.load(covmap, covfun, names, file.ByteOrder)
+	if err != nil {
+		return fmt.Errorf("%s: %s", filename, err)
+	}
+	return nil
+}
+
+func (m *covMapping) load(covmap, covfun, names []byte, order binary.ByteOrder) error {
+	if m.Names == nil {
+		m.Names = make(map[uint64]string)
+	}
+	list, err := readLLVMNames(names)
+	if err != nil {
+		return err
+	}
+	for _, v := range list {
+		m.Names[llvmNameRef(v)] = v
+	}
+
+	// Each translation unit has a header, followed by the list of source
+	// files.  Functions refer to the list using the MD5 hash of the encoded
+	// list.
+	units := make(map[uint64][]string)
+	version := uint32(0)
+	for len(covmap) >= 16 {
+		filenamesSize := order.Uint32(covmap[4:])
+		coverageSize := order.Uint32(covmap[8:])
+		version = order.Uint32(covmap[12:])
+		// The encoded version is one less than the version of the format.
+		// Version 4, from LLVM 11, is the first to use __llvm_covfun.
+		if version < 3 || version > 6 {
+			return fmt.Errorf("unsupported version of coverage mapping: %d", version+1)
+		}
+		if uint64(filenamesSize)+uint64(coverageSize) > uint64(len(covmap)-16) {
+			return errCovTruncated
+		}
+
+		encoded := covmap[16 : 16+filenamesSize]
+		filenames, err := readCovFilenames(encoded, version)
+		if err != nil {
+			return err
+		}
+		units[llvmNameRef(string(encoded))] = filenames
+
+		n := alignTo8(16 + int(filenamesSize) + int(coverageSize))
+		if n > len(covmap) {
+			break
+		}
+		covmap = covmap[n:]
+	}
+
+	for len(covfun) >= 28 {
+		nameRef := order.Uint64(covfun)
+		dataSize := order.Uint32(covfun[8:])
+		funcHash := order.Uint64(covfun[12:])
+		filenamesRef := order.Uint64(covfun[20:])
+		if uint64(dataSize) > uint64(len(covfun)-28) {
+			return errCovTruncated
+		}
+
+		filenames, ok := units[filenamesRef]
+		if !ok {
+			return errors.New("function refers to unknown list of source files")
+		}
+		fn, err := readCovFunction(covfun[28:28+dataSize], filenames, version)
+		if err != nil {
+			return err
+		}
+		fn.NameRef, fn.FuncHash = nameRef, funcHash
+		m.Functions = append(m.Functions, fn)
+
+		n := alignTo8(28 + int(dataSize))
+		if n > len(covfun) {
+			break
+		}
+		covfun = covfun[n:]
+	}
+	return nil
+}
+
+// readCovFilenames reads the list of source files for a translation unit.
+// The list may be compressed.  Starting with version 6, the first entry is
+// the compilation directory, and relative filenames are relative to that
+// directory.
+func readCovFilenames(data []byte, version uint32) ([]string, error) {
+	r := covReader{data: data}
+	count := r.uleb128()
+	uncompressedSize := r.uleb128()
+	compressedSize := r.uleb128()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if compressedSize > 0 {
+		tmp, err := zlibDecompress(r.bytes(compressedSize), uncompressedSize)
+		if err != nil {
+			return nil, err
+		}
+		r = covReader{data: tmp}
+	}
+
+	out := []string(nil)
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		name := string(r.bytes(r.uleb128()))
+		if version >= 5 && i > 0 && !filepath.IsAbs(name) {
+			name = filepath.Join(out[0], name)
+		}
+		out = append(out, name)
+	}
+	return out, r.err
+}
+
+func readCovFunction(data []byte, filenames []string, version uint32) (*covFunction, error) {
+	r := covReader{data: data}
+	fn := &covFunction{}
+
+	numFiles := r.uleb128()
+	for i := uint64(0); i < numFiles && r.err == nil; i++ {
+		ndx := r.uleb128()
+		if ndx >= uint64(len(filenames)) {
+			return nil, errors.New("filename out of range in coverage mapping")
+		}
+		fn.Filenames = append(fn.Filenames, filenames[ndx])
+	}
+
+	numExpressions := r.uleb128()
+	if numExpressions > uint64(len(data)) {
+		return nil, errCovTruncated
+	}
+	fn.Expressions = make([]covExpression, numExpressions)
+	for i := range fn.Expressions {
+		fn.Expressions[i].LHS = r.uleb128()
+		fn.Expressions[i].RHS = r.uleb128()
+	}
+
+	for fileID := 0; fileID < len(fn.Filenames) && r.err == nil; fileID++ {
+		numRegions := r.uleb128()
+		line := 0
+		for i := uint64(0); i < numRegions && r.err == nil; i++ {
+			region := covRegion{FileID: fileID, ExpandedFileID: fileID}
+
+			// The counter and the kind of region share an encoding.  A tag
+			// of zero in the lower two bits indicates a region other than a
+			// code region with a non-zero counter.
+			encoded := r.uleb128()
+			if encoded&3 != 0 {
+				region.Counter = encoded
+			} else if encoded&4 != 0 {
+				region.Kind = covExpansionRegion
+				region.ExpandedFileID = int(encoded >> 3)
+				if region.ExpandedFileID >= len(fn.Filenames) {
+					return nil, errors.New("expansion out of range in coverage mapping")
+				}
+			} else {
+				switch kind := encoded >> 3; kind {
+				case covCodeRegion, covSkippedRegion:
+					region.Kind = int(kind)
+				case covBranchRegion:
+					region.Kind = covBranchRegion
+					region.Counter = r.uleb128()
+					r.uleb128() // Counter for the false branch
+				case covMCDCBranchRegion:
+					region.Kind = covMCDCBranchRegion
+					r.uleb128() // Counter for the true branch
+					r.uleb128() // Counter for the false branch
+					r.uleb128() // Condition ID
+					r.uleb128() // Condition ID for true
+					r.uleb128() // Condition ID for false
+				case covMCDCDecisionRegion:
+					region.Kind = covMCDCDecisionRegion
+					r.uleb128() // Bitmap index
+					r.uleb128() // Number of conditions
+				default:
+					return nil, fmt.Errorf("unknown kind of region in coverage mapping: %d", kind)
+				}
+			}
+
+			line += r.int()
+			region.Start = covLoc{line, r.int()}
+			region.End = covLoc{line + r.int(), 0}
+			endColumn := r.uleb128()
+			if region.Kind == covCodeRegion && endColumn&(1<<31) != 0 {
+				region.Kind = covGapRegion
+				endColumn &^= 1 << 31
+			}
+			if endColumn > math.MaxInt32 {
+				return nil, errors.New("value out of range in coverage mapping")
+			}
+			region.End.Column = int(endColumn)
+			// Regions that cover entire lines have zero for both columns.
+			if region.Start.Column == 0 && region.End.Column == 0 {
+				region.Start.Column = 1
+				region.End.Column = math.MaxInt32
+			}
+			fn.Regions = append(fn.Regions, region)
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	// The count for an expansion region is the count for the first region
+	// in the expanded file.  Several passes are required for nested
+	// expansions.
+	for pass := 1; pass < len(fn.Filenames); pass++ {
+		expansions := make(map[int]*covRegion)
+		for i := range fn.Regions {
+			if v := &fn.Regions[i]; v.Kind == covExpansionRegion {
+				expansions[v.ExpandedFileID] = v
+			}
+		}
+		for _, v := range fn.Regions {
+			if e, ok := expansions[v.FileID]; ok {
+				e.Counter = v.Counter
+				delete(expansions, v.FileID)
+			}
+		}
+	}
+
+	return fn, nil
+}
+
+// covEvaluator computes the counts for the regions of a function.  The values
+// of the expressions are cached, since expressions are often shared.
+type covEvaluator struct {
+	fn     *covFunction
+	counts []uint64
+	values []int64
+	state  []uint8
+}
+
+// States for the expressions during evaluation.
+const (
+	covExprPending = iota
+	covExprActive
+	covExprDone
+)
+
+func newCovEvaluator(fn *covFunction, counts []uint64) *covEvaluator {
+	return &covEvaluator{
+		fn:     fn,
+		counts: counts,
+		values: make([]int64, len(fn.Expressions)),
+		state:  make([]uint8, len(fn.Expressions)),
+	}
+}
+
+// evaluate computes the count for an encoded counter.  A malformed mapping
+// can contain expressions that refer back to themselves, which is reported as
+// an error.
+func (e *covEvaluator) evaluate(counter uint64) (int64, error) {
+	id := counter >> 2
+	switch counter & 3 {
+	case 0:
+		return 0, nil
+	case 1:
+		if id >= uint64(len(e.counts)) {
+			return 0, errors.New("counter out of range in coverage mapping")
+		}
+		return int64(e.counts[id]), nil
+	}
+
+	if id >= uint64(len(e.fn.Expressions)) {
+		return 0, errors.New("expression out of range in coverage mapping")
+	}
+	switch e.state[id] {
+	case covExprActive:
+		return 0, errors.New("cycle in coverage mapping expressions")
+	case covExprDone:
+		return e.values[id], nil
+	}
+
+	e.state[id] = covExprActive
+	lhs, err := e.evaluate(e.fn.Expressions[id].LHS)
+	if err != nil {
+		return 0, err
+	}
+	rhs, err := e.evaluate(e.fn.Expressions[id].RHS)
+	if err != nil {
+		return 0, err
+	}
+	if counter&3 == 2 {
+		e.values[id] = lhs - rhs
+	} else {
+		e.values[id] = lhs + rhs
+	}
+	e.state[id] = covExprDone
+	return e.values[id], nil
+}
+
+// maxCounter returns the number of counters referenced by the mapping.
+func (fn *covFunction) maxCounter() int {
+	out := 0
+	check := func(counter uint64) {
+		if counter&3 == 1 && int(counter>>2) >= out {
+			out = int(counter>>2) + 1
+		}
+	}
+	for _, v := range fn.Expressions {
+		check(v.LHS)
+		check(v.RHS)
+	}
+	for _, v := range fn.Regions {
+		check(v.Counter)
+	}
+	return out
+}
+
+// loadLLVMProfileFile loads coverage data from a single profile written by
+// clang or rustc.
+func loadLLVMProfileFile(fds FileDataSet, file *os.File, opts loadOptions) error {
+	profile := llvmProfile{}
+	err := profile.loadFile(file)
+	if err != nil {
+		return err
+	}
+	return loadLLVMProfile(fds, &profile, opts)
+}
+
+// loadLLVMProfile maps the counters in the profile to regions in the source
+// files, using the coverage mapping from the instrumented binaries.  Like
+// llvm-cov, functions whose structural hash does not match the profile are
+// skipped with a warning, and functions that are missing from the profile
+// were never run.  In strict mode, a mismatched hash is an error.
+func loadLLVMProfile(fds FileDataSet, profile *llvmProfile, opts loadOptions) error {
+	if len(opts.objects) == 0 {
+		return errors.New("profiles from clang or rustc require the instrumented binaries, use -object")
+	}
+
+	mapping := covMapping{}
+	for _, v := range opts.objects {
+		err := mapping.loadObject(v)
+		if err != nil {
+			return err
+		}
+	}
+	return mapping.apply(fds, profile, opts)
+}
+
+func (m *covMapping) apply(fds FileDataSet, profile *llvmProfile, opts loadOptions) error {
+	seen := make(map[string]bool)
+	regions := make(map[string][]covRegion)
+	mismatched := 0
+
+	// Functions may be present in more than one binary, or in more than one
+	// translation unit.  A record without a structural hash is a placeholder
+	// for a function that was not used.
+	byName := make(map[uint64]*covFunction)
+	for _, fn := range m.Functions {
+		if prev, ok := byName[fn.NameRef]; !ok || (prev.FuncHash == 0 && fn.FuncHash != 0) {
+			byName[fn.NameRef] = fn
+		}
+	}
+
+	for _, fn := range m.Functions {
+		if byName[fn.NameRef] != fn || len(fn.Regions) == 0 {
+			continue
+		}
+		key := fmt.Sprintf("%x\x00%s", fn.NameRef, strings.Join(fn.Filenames, "\x00"))
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		counts, ok, err := profile.lookup(fn.NameRef, fn.FuncHash)
+		if err != nil {
+			if opts.mode == ParseStrict {
+				return fmt.Errorf("%s: %s", m.functionName(fn.NameRef), err)
+			}
+			mismatched++
+			continue
+		}
+		if !ok {
+			counts = make([]uint64, fn.maxCounter())
+		}
+
+		eval := newCovEvaluator(fn, counts)
+		first := true
+		for _, v := range fn.Regions {
+			if v.Kind >= covBranchRegion {
+				continue
+			}
+			count, err := eval.evaluate(v.Counter)
+			if err != nil {
+				return err
+			}
+			if count < 0 {
+				count = 0
+			}
+			v.Count = uint64(count)
+
+			if first {
+				// The first region covers the body of the function.
+				currentData := fds.FileData(fn.Filenames[v.FileID])
+				currentData.AppendFunctionData(m.functionName(fn.NameRef), v.Start.Line, v.End.Line, v.Count)
+				first = false
+			}
+			filename := fn.Filenames[v.FileID]
+			regions[filename] = append(regions[filename], v)
+		}
+	}
+
+	for filename, list := range regions {
+		appendLLVMSegments(fds.FileData(filename), buildCovSegments(list))
+	}
+	if mismatched > 0 {
+		opts.warnf("skipped %d functions whose hash does not match the profile", mismatched)
+	}
+	return nil
+}
+
+// functionName returns the name of the function.  Names for functions with
+// internal linkage are prefixed with the source file.
+func (m *covMapping) functionName(nameRef uint64) string {
+	name, ok := m.Names[nameRef]
+	if !ok {
+		return fmt.Sprintf("0x%016x", nameRef)
+	}
+	if ndx := strings.LastIndexByte(name, ';'); ndx >= 0 {
+		name = name[ndx+1:]
+	}
+	return demangleRust(name)
+}
+
+// buildCovSegments converts a list of possibly nested regions for a source
+// file into a list of segments, in the same manner as llvm-cov.  Each segment
+// starts at a location, and continues until the next segment.
+func buildCovSegments(regions []covRegion) []LLVMSegment {
+	// Sort the regions so that enclosing regions come first.  Regions that
+	// cover the same area are sorted by kind, and then combined.
+	sort.SliceStable(regions, func(i, j int) bool {
+		a, b := &regions[i], &regions[j]
+		if a.Start != b.Start {
+			return a.Start.less(b.Start)
+		}
+		if a.End != b.End {
+			return b.End.less(a.End)
+		}
+		return a.Kind < b.Kind
+	})
+	combined := regions[:0]
+	for _, v := range regions {
+		if n := len(combined); n > 0 && combined[n-1].Start == v.Start && combined[n-1].End == v.End {
+			if combined[n-1].Kind == v.Kind {
+				combined[n-1].Count += v.Count
+			}
+			continue
+		}
+		combined = append(combined, v)
+	}
+
+	b := covSegmentBuilder{}
+	for i := range combined {
+		region := &combined[i]
+		start := region.Start
+
+		// Active regions that end before the current region are completed.
+		active, completed := []*covRegion(nil), []*covRegion(nil)
+		for _, v := range b.active {
+			if start.less(v.End) {
+				active = append(active, v)
+			} else {
+				completed = append(completed, v)
+			}
+		}
+		if len(completed) > 0 {
+			b.active = append(active, completed...)
+			b.completeUntil(&start, len(active))
+		}
+
+		isGap := region.Kind == covGapRegion
+		if start == region.End {
+			// Zero-length regions are not made active.
+			skipped := i+1 == len(combined) || region.Kind == covSkippedRegion
+			if len(b.active) == 0 {
+				b.startSegment(region, start, !isGap, skipped)
+			} else {
+				b.startSegment(b.active[len(b.active)-1], start, !isGap, skipped)
+				if skipped {
+					b.startSegment(b.active[len(b.active)-1], start, false, false)
+				}
+			}
+			continue
+		}
+		// Only the last region with a given start starts a segment.
+		if i+1 == len(combined) || start != combined[i+1].Start {
+			b.startSegment(region, start, !isGap, false)
+		}
+		b.active = append(b.active, region)
+	}
+	if len(b.active) > 0 {
+		b.completeUntil(nil, 0)
+	}
+	return b.segments
+}
+
+type covSegmentBuilder struct {
+	segments []LLVMSegment
+	active   []*covRegion
+}
+
+func (b *covSegmentBuilder) startSegment(region *covRegion, loc covLoc, isRegionEntry, emitSkipped bool) {
+	hasCount := !emitSkipped && region.Kind != covSkippedRegion
+
+	// Skip segments that would not change the rendering.
+	if n := len(b.segments); n > 0 && !isRegionEntry && !emitSkipped {
+		last := b.segments[n-1]
+		if last.HasCount == hasCount && last.Count == region.Count && !last.IsRegionEntry {
+			return
+		}
+	}
+
+	segment := LLVMSegment{Line: loc.Line, Column: loc.Column, HasCount: hasCount, IsRegionEntry: isRegionEntry}
+	if hasCount {
+		segment.Count = region.Count
+	}
+	b.segments = append(b.segments, segment)
+}
+
+// completeUntil emits segments for the active regions, starting at index
+// first, which end before loc.  If loc is nil, all active regions are
+// completed.
+func (b *covSegmentBuilder) completeUntil(loc *covLoc, first int) {
+	completed := b.active[first:]
+	sort.SliceStable(completed, func(i, j int) bool {
+		return completed[i].End.less(completed[j].End)
+	})
+
+	for i := first + 1; i < len(b.active); i++ {
+		region := b.active[i]
+		segmentLoc := b.active[i-1].End
+		if loc != nil && segmentLoc == *loc {
+			break
+		}
+		if segmentLoc == region.End {
+			continue
+		}
+		// Use the count from the last completed region ending here.
+		for _, v := range b.active[i+1:] {
+			if v.End == region.End {
+				region = v
+			}
+		}
+		b.startSegment(region, segmentLoc, false, false)
+	}
+
+	last := b.active[len(b.active)-1]
+	if first > 0 && (loc == nil || last.End != *loc) {
+		// Fill the gap with the next active region.
+		b.startSegment(b.active[first-1], last.End, false, false)
+	} else if first == 0 && (loc == nil || last.End != *loc) {
+		// There are no more active regions, so the gap is not covered.
+		b.startSegment(last, last.End, false, true)
+	}
+	b.active = b.active[:first]
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+)
+
+var testProfileOptions = loadOptions{
+	objects: []string{"./testdata/example-rustc-1.90.0/main.o"},
+}
+
+func TestLoadLLVMProfileFile(t *testing.T) {
+	fds := make(FileDataSet)
+	err := loadFile(fds, "./testdata/example-rustc-1.90.0/merged.profdata", testProfileOptions)
+	if err != nil {
+		t.Fatalf("could not load file: %s", err)
+	}
+	if len(fds) != 2 {
+		LogNE(t, "file count", 2, len(fds))
+	}
+
+	// Expected values are from llvm-cov export.
+	cases := []struct {
+		filename string
+		function string
+		start    int
+		hits     uint64
+		region   Region
+		count    uint64
+	}{
+		{"/example/src/main.rs", "main::classify", 3, 40, Region{3, 1, 3, 36}, 40},
+		{"/example/src/main.rs", "main::main", 19, 2, Region{21, 14, 21, 20}, 42},
+		{"/example/src/main.rs", "main::unused", 15, 0, Region{22, 36, 24, 9}, 22},
+		{"/example/src/shapes.rs", "<main::shapes::Point>::new", 7, 2, Region{7, 5, 7, 40}, 2},
+		{"/example/src/shapes.rs", "<main::shapes::Point>::quadrant", 11, 2, Region{13, 29, 13, 30}, 0},
+		{"/example/src/shapes.rs", "main::shapes::never_called", 22, 0, Region{22, 1, 22, 38}, 0},
+	}
+	for _, v := range cases {
+		t.Run(v.function, func(t *testing.T) {
+			data, ok := fds[v.filename]
+			if !ok {
+				t.Fatalf("missing data for file")
+			}
+			fn, ok := data.FuncData[v.function]
+			if !ok {
+				t.Fatalf("missing data for function")
+			}
+			if fn.StartLine != v.start || fn.HitCount != v.hits {
+				t.Errorf("bad function data: %v", fn)
+			}
+			count, ok := data.RegionData[v.region]
+			if !ok {
+				t.Fatalf("missing region %v", v.region)
+			}
+			if count != v.count {
+				LogNE(t, "region count", v.count, count)
+			}
+		})
+	}
+
+	if rcov := fds["/example/src/main.rs"].RegionCoverage(); rcov != (Coverage{26, 32}) {
+		LogNE(t, "region coverage", Coverage{26, 32}, rcov)
+	}
+}
+
+func TestLoadLLVMProfileMerged(t *testing.T) {
+	filter := newFileFilter(bytes.NewBuffer(nil), "/example/", nil, true, "", nil)
+	expected, err := loadFileData([]string{"./testdata/example-rustc-1.90.0/merged.profdata"}, testProfileOptions, filter)
+	if err != nil {
+		t.Fatalf("could not load file: %s", err)
+	}
+	got, err := loadFileData([]string{
+		"./testdata/example-rustc-1.90.0/a.profraw",
+		"./testdata/example-rustc-1.90.0/b.profraw",
+	}, testProfileOptions, filter)
+	if err != nil {
+		t.Fatalf("could not load file: %s", err)
+	}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("merged profiles do not match")
+	}
+
+	compact, err := loadCompactFileData([]string{
+		"./testdata/example-rustc-1.90.0/a.profraw",
+		"./testdata/example-rustc-1.90.0/b.profraw",
+	}, testProfileOptions, filter)
+	if err != nil {
+		t.Fatalf("could not load file: %s", err)
+	}
+	if compact.Len() != len(expected) {
+		LogNE(t, "file count", len(expected), compact.Len())
+	}
+	for name, data := range expected {
+		if rcov := compact.Lookup(name).RegionCoverage(); rcov != data.RegionCoverage() {
+			LogNE(t, "region coverage", data.RegionCoverage(), rcov)
+		}
+	}
+}
+
+func TestLoadLLVMProfileErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		objects []string
+	}{
+		{"none", nil},
+		{"missing", []string{"./testdata/example-rustc-1.90.0/missing.o"}},
+		{"not-elf", []string{"./testdata/example-rustc-1.90.0/a.profraw"}},
+		{"no-mapping", []string{os.Args[0]}},
+	}
+	for _, v := range cases {
+		t.Run(v.name, func(t *testing.T) {
+			fds := make(FileDataSet)
+			err := loadFile(fds, "./testdata/example-rustc-1.90.0/a.profraw", loadOptions{objects: v.objects})
+			if err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
+
+func TestCovMappingHashMismatch(t *testing.T) {
+	fn := &covFunction{
+		NameRef:   llvmNameRef("a"),
+		FuncHash:  1,
+		Filenames: []string{"a.c"},
+		Regions:   []covRegion{{Counter: 0<<2 | 1, Start: covLoc{1, 1}, End: covLoc{3, 2}}},
+	}
+	mapping := covMapping{Functions: []*covFunction{fn}, Names: map[uint64]string{fn.NameRef: "a"}}
+	profile := &llvmProfile{}
+	if err := profile.add(fn.NameRef, 2, []uint64{5}); err != nil {
+		t.Fatalf("could not add counters: %s", err)
+	}
+
+	warnings := bytes.NewBuffer(nil)
+	fds := make(FileDataSet)
+	if err := mapping.apply(fds, profile, loadOptions{warnings: warnings}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(fds) != 0 {
+		LogNE(t, "file count", 0, len(fds))
+	}
+	if expected := "warning: skipped 1 functions whose hash does not match the profile\n"; warnings.String() != expected {
+		LogNE(t, "warnings", expected, warnings.String())
+	}
+
+	if err := mapping.apply(make(FileDataSet), profile, loadOptions{mode: ParseStrict}); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestBuildCovSegments(t *testing.T) {
+	regions := []covRegion{
+		{Kind: covCodeRegion, Start: covLoc{2, 5}, End: covLoc{3, 10}, Count: 0},
+		{Kind: covCodeRegion, Start: covLoc{1, 1}, End: covLoc{5, 2}, Count: 3},
+		{Kind: covSkippedRegion, Start: covLoc{4, 1}, End: covLoc{4, 20}},
+	}
+
+	expected := []LLVMSegment{
+		{Line: 1, Column: 1, Count: 3, HasCount: true, IsRegionEntry: true},
+		{Line: 2, Column: 5, Count: 0, HasCount: true, IsRegionEntry: true},
+		{Line: 3, Column: 10, Count: 3, HasCount: true},
+		{Line: 4, Column: 1, IsRegionEntry: true},
+		{Line: 4, Column: 20, Count: 3, HasCount: true},
+		{Line: 5, Column: 2},
+	}
+	got := buildCovSegments(regions)
+	if !reflect.DeepEqual(got, expected) {
+		LogNE(t, "segments", expected, got)
+	}
+}
+
+func TestCovEvaluatorMalformed(t *testing.T) {
+	// The only expression subtracts zero from itself.
+	data := []byte{1, 0, 1, 2, 0, 1, 2, 1, 1, 0, 2}
+	fn, err := readCovFunction(data, []string{"a.c"}, 5)
+	if err != nil {
+		t.Fatalf("could not read function: %s", err)
+	}
+	if len(fn.Regions) != 1 {
+		t.Fatalf("unexpected number of regions: %d", len(fn.Regions))
+	}
+	if _, err := newCovEvaluator(fn, nil).evaluate(fn.Regions[0].Counter); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestCovEvaluator(t *testing.T) {
+	// Expressions are encoded as (id << 2) | tag, where the tag is 1 for
+	// a counter, 2 for a subtraction, and 3 for an addition.
+	fn := &covFunction{Expressions: []covExpression{
+		{1<<2 | 3, 1<<2 | 1}, // e1 + c1
+		{0<<2 | 1, 0<<2 | 1}, // c0 + c0
+		{3<<2 | 2, 0},        // e3 - zero
+		{2<<2 | 3, 0<<2 | 1}, // e2 + c0
+	}}
+	counts := []uint64{5, 2}
+
+	cases := []struct {
+		counter  uint64
+		expected int64
+		ok       bool
+	}{
+		{0, 0, true},
+		{1<<2 | 1, 2, true},
+		{2<<2 | 1, 0, false},
+		{0<<2 | 3, 12, true},
+		{0<<2 | 2, 8, true},
+		{2<<2 | 3, 0, false},
+		{4<<2 | 3, 0, false},
+	}
+	for _, v := range cases {
+		got, err := newCovEvaluator(fn, counts).evaluate(v.counter)
+		if (err == nil) != v.ok {
+			LogNE(t, "ok", v.ok, err == nil)
+			continue
+		}
+		if got != v.expected {
+			LogNE(t, "count", v.expected, got)
+		}
+	}
+}
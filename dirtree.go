@@ -0,0 +1,196 @@
+package main
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// DirStatistics is used to capture coverage statistics for a directory.  The
+// coverage includes all of the files in the directory, and in all of its
+// subdirectories.
+type DirStatistics struct {
+	Name      string // Path of the directory, or empty for the root.
+	LCoverage Coverage
+	FCoverage Coverage
+	BCoverage Coverage
+	RCoverage Coverage
+	Dirs      []*DirStatistics // Subdirectories, sorted by name.
+	Files     []FileStatistics // Files directly within the directory, sorted by name.
+}
+
+// NewDirTree aggregates the coverage statistics for the files into a tree of
+// directories.  The root of the tree is returned.
+func NewDirTree(files []FileStatistics) *DirStatistics {
+	root := &DirStatistics{}
+	dirs := map[string]*DirStatistics{"": root}
+
+	var lookup func(name string) *DirStatistics
+	lookup = func(name string) *DirStatistics {
+		if tmp, ok := dirs[name]; ok {
+			return tmp
+		}
+
+		tmp := &DirStatistics{Name: name}
+		dirs[name] = tmp
+		parent := lookup(parentDir(name))
+		parent.Dirs = append(parent.Dirs, tmp)
+		return tmp
+	}
+
+	for _, v := range files {
+		dir := lookup(parentDir(v.Name))
+		dir.Files = append(dir.Files, v)
+	}
+
+	root.finish()
+	return root
+}
+
+// parentDir returns the directory containing the file or directory, or the
+// empty string if the file is at the top-level.
+func parentDir(name string) string {
+	dir := path.Dir(strings.Replace(name, "\\", "/", -1))
+	if dir == "." || dir == "/" {
+		return ""
+	}
+	return dir
+}
+
+// reportPath converts the name of a source file or directory to a path,
+// using forward slashes, relative to the root of the HTML report.  Leading
+// slashes are removed, and parent directory components are replaced with
+// "^", as gcov does for --preserve-paths, so that the pages are always
+// written inside the report's directory.
+func reportPath(name string) string {
+	name = strings.TrimLeft(path.Clean(strings.Replace(name, "\\", "/", -1)), "/")
+	if name == "." {
+		return ""
+	}
+
+	parts := strings.Split(name, "/")
+	for i, v := range parts {
+		if v == ".." {
+			parts[i] = "^"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+func (d *DirStatistics) finish() {
+	sort.Slice(d.Dirs, func(i, j int) bool {
+		return d.Dirs[i].Name < d.Dirs[j].Name
+	})
+	sort.Slice(d.Files, func(i, j int) bool {
+		return d.Files[i].Name < d.Files[j].Name
+	})
+
+	for _, v := range d.Dirs {
+		v.finish()
+		d.LCoverage = d.LCoverage.Add(v.LCoverage)
+		d.FCoverage = d.FCoverage.Add(v.FCoverage)
+		d.BCoverage = d.BCoverage.Add(v.BCoverage)
+		d.RCoverage = d.RCoverage.Add(v.RCoverage)
+	}
+	for _, v := range d.Files {
+		d.LCoverage = d.LCoverage.Add(v.LCoverage)
+		d.FCoverage = d.FCoverage.Add(v.FCoverage)
+		d.BCoverage = d.BCoverage.Add(v.BCoverage)
+		d.RCoverage = d.RCoverage.Add(v.RCoverage)
+	}
+}
+
+// Statistics returns the coverage statistics for the directory as a whole.
+// The name has a trailing slash to distinguish the entry from a file.
+func (d *DirStatistics) Statistics() FileStatistics {
+	return FileStatistics{
+		Name:      d.Name + "/",
+		LCoverage: d.LCoverage,
+		FCoverage: d.FCoverage,
+		BCoverage: d.BCoverage,
+		RCoverage: d.RCoverage,
+	}
+}
+
+// Walk calls fn for the directory, and then for each of its subdirectories
+// in sorted order.
+func (d *DirStatistics) Walk(fn func(*DirStatistics)) {
+	fn(d)
+	for _, v := range d.Dirs {
+		v.Walk(fn)
+	}
+}
+
+// Descendants lists all of the subdirectories in the tree, excluding the
+// directory itself, in sorted order.
+func (d *DirStatistics) Descendants() []*DirStatistics {
+	out := []*DirStatistics(nil)
+	d.Walk(func(v *DirStatistics) {
+		if v != d {
+			out = append(out, v)
+		}
+	})
+	return out
+}
+
+// Flatten lists the statistics for all of the files in the tree.  However,
+// any directories below the depth limit are rolled up, and appear as a single
+// entry.  If depth is less than one, there is no limit.
+func (d *DirStatistics) Flatten(depth int) []FileStatistics {
+	out := []FileStatistics(nil)
+	d.flatten(depth, &out)
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+func (d *DirStatistics) flatten(depth int, out *[]FileStatistics) {
+	*out = append(*out, d.Files...)
+	for _, v := range d.Dirs {
+		if depth == 1 {
+			*out = append(*out, v.Statistics())
+		} else {
+			v.flatten(depth-1, out)
+		}
+	}
+}
+
+// Breadcrumb is a link to a parent directory in the HTML report.
+type Breadcrumb struct {
+	Name string
+	URL  string
+}
+
+// Breadcrumbs returns the links to the root, and to each of the parent
+// directories, for a page in the HTML report.  The URLs are relative to the
+// directory dir.
+func Breadcrumbs(dir string) []Breadcrumb {
+	parts := splitDir(dir)
+
+	out := make([]Breadcrumb, 0, len(parts)+1)
+	out = append(out, Breadcrumb{
+		Name: "Root",
+		URL:  relativeRoot(dir) + "index.html",
+	})
+	for i, v := range parts {
+		out = append(out, Breadcrumb{
+			Name: v,
+			URL:  strings.Repeat("../", len(parts)-i-1) + "index.html",
+		})
+	}
+	return out
+}
+
+// relativeRoot returns the relative URL from the directory dir to the root of
+// the HTML report.
+func relativeRoot(dir string) string {
+	return strings.Repeat("../", len(splitDir(dir)))
+}
+
+func splitDir(dir string) []string {
+	if dir = strings.Trim(dir, "/"); dir != "" {
+		return strings.Split(dir, "/")
+	}
+	return nil
+}
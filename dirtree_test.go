@@ -0,0 +1,93 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewDirTree(t *testing.T) {
+	files := []FileStatistics{
+		{Name: "main.c", LCoverage: Coverage{1, 2}},
+		{Name: "src/b/b.c", LCoverage: Coverage{3, 4}},
+		{Name: "src/a.c", LCoverage: Coverage{5, 6}},
+		{Name: "src/b/c/c.c", LCoverage: Coverage{7, 8}},
+		{Name: "lib/l.c", LCoverage: Coverage{9, 10}},
+	}
+
+	root := NewDirTree(files)
+	if root.Name != "" {
+		LogNE(t, "root name", "", root.Name)
+	}
+	if got := root.LCoverage; got != (Coverage{25, 30}) {
+		LogNE(t, "root coverage", Coverage{25, 30}, got)
+	}
+
+	names := []string(nil)
+	for _, v := range root.Descendants() {
+		names = append(names, v.Name+"="+v.LCoverage.String())
+	}
+	expected := []string{"lib=9/10", "src=15/18", "src/b=10/12", "src/b/c=7/8"}
+	if !reflect.DeepEqual(names, expected) {
+		LogNE(t, "directories", expected, names)
+	}
+
+	cases := []struct {
+		depth    int
+		expected []string
+	}{
+		{0, []string{"lib/l.c", "main.c", "src/a.c", "src/b/b.c", "src/b/c/c.c"}},
+		{1, []string{"lib/", "main.c", "src/"}},
+		{2, []string{"lib/l.c", "main.c", "src/a.c", "src/b/"}},
+		{3, []string{"lib/l.c", "main.c", "src/a.c", "src/b/b.c", "src/b/c/"}},
+	}
+
+	for _, v := range cases {
+		names := []string(nil)
+		for _, v := range root.Flatten(v.depth) {
+			names = append(names, v.Name)
+		}
+		if !reflect.DeepEqual(names, v.expected) {
+			t.Errorf("Depth %d: expected %v, got %v", v.depth, v.expected, names)
+		}
+	}
+}
+
+func TestBreadcrumbs(t *testing.T) {
+	cases := []struct {
+		dir      string
+		expected []Breadcrumb
+	}{
+		{"", []Breadcrumb{{"Root", "index.html"}}},
+		{"src", []Breadcrumb{{"Root", "../index.html"}, {"src", "index.html"}}},
+		{"src/b", []Breadcrumb{{"Root", "../../index.html"}, {"src", "../index.html"}, {"b", "index.html"}}},
+	}
+
+	for _, v := range cases {
+		if got := Breadcrumbs(v.dir); !reflect.DeepEqual(got, v.expected) {
+			t.Errorf("Case %s: expected %v, got %v", v.dir, v.expected, got)
+		}
+	}
+}
+
+func TestReportPath(t *testing.T) {
+	cases := []struct {
+		name     string
+		expected string
+	}{
+		{"", ""},
+		{"a.c", "a.c"},
+		{"src/a.c", "src/a.c"},
+		{"/usr/include/a.h", "usr/include/a.h"},
+		{"./src/../a.c", "a.c"},
+		{"../lib/a.c", "^/lib/a.c"},
+		{"../../a.c", "^/^/a.c"},
+		{"..", "^"},
+		{"..\\lib\\a.c", "^/lib/a.c"},
+	}
+
+	for _, v := range cases {
+		if got := reportPath(v.name); got != v.expected {
+			t.Errorf("Case %s: expected %s, got %s", v.name, v.expected, got)
+		}
+	}
+}
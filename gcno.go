@@ -0,0 +1,679 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Magic numbers, tags, and flags used in the notes (.gcno) and data (.gcda)
+// files written by gcc.
+const (
+	gcovMagicNotes = 0x67636e6f // "gcno"
+	gcovMagicData  = 0x67636461 // "gcda"
+
+	gcovTagFunction    = 0x01000000
+	gcovTagBlocks      = 0x01410000
+	gcovTagArcs        = 0x01430000
+	gcovTagLines       = 0x01450000
+	gcovTagCounterArcs = 0x01a10000
+
+	gcovArcOnTree      = 1
+	gcovArcFake        = 2
+	gcovArcFallthrough = 4
+)
+
+// gcovReader reads the words, counters, and strings in a notes or data file.
+// The layout of the files depends on the version of gcc that wrote them.
+type gcovReader struct {
+	data    []byte
+	pos     int
+	order   binary.ByteOrder
+	version int
+	err     error
+}
+
+var errGCovTruncated = errors.New("unexpected end of data")
+
+// newGCovReader checks the magic number at the start of the data, which also
+// identifies the byte order, and decodes the version number.
+func newGCovReader(data []byte, magic uint32) (*gcovReader, error) {
+	if len(data) < 12 {
+		return nil, errGCovTruncated
+	}
+
+	r := &gcovReader{data: data}
+	switch magic {
+	case binary.LittleEndian.Uint32(data):
+		r.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(data):
+		r.order = binary.BigEndian
+	default:
+		return nil, errors.New("bad magic number")
+	}
+	r.pos = 4
+
+	// The version is stored as characters, such as "B22*" for gcc 12.2, or
+	// "408*" for gcc 4.8.
+	v := r.word()
+	c0, c1, c2 := byte(v>>24), byte(v>>16), byte(v>>8)
+	if c0 >= 'A' {
+		r.version = int(c0-'A')*100 + int(c1-'0')*10 + int(c2-'0')
+	} else {
+		r.version = int(c0-'0')*10 + int(c2-'0')
+	}
+	if r.version < 47 {
+		return nil, fmt.Errorf("unsupported version of gcc: %d.%d", r.version/10, r.version%10)
+	}
+	return r, nil
+}
+
+func (r *gcovReader) word() uint32 {
+	if r.pos+4 > len(r.data) {
+		r.err = errGCovTruncated
+		r.pos = len(r.data)
+		return 0
+	}
+	v := r.order.Uint32(r.data[r.pos:])
+	r.pos += 4
+	return v
+}
+
+// counter reads a 64-bit counter, which is stored as two words with the low
+// word first.
+func (r *gcovReader) counter() uint64 {
+	lo := r.word()
+	hi := r.word()
+	return uint64(hi)<<32 | uint64(lo)
+}
+
+// string reads a string.  Starting with gcc 12, the length is in bytes.
+// Earlier versions give the length in words, and pad the string with nuls.
+func (r *gcovReader) string() string {
+	length := int(r.word())
+	if r.version < 120 {
+		length *= 4
+	}
+	if length < 0 || r.pos+length > len(r.data) {
+		r.err = errGCovTruncated
+		r.pos = len(r.data)
+		return ""
+	}
+	v := r.data[r.pos : r.pos+length]
+	r.pos += length
+	return strings.TrimRight(string(v), "\x00")
+}
+
+// length reads the length of a record, and returns the length in bytes.  The
+// length is negative for a counter record where all of the counters are
+// zero.
+func (r *gcovReader) length() int {
+	v := int(int32(r.word()))
+	if r.version < 120 {
+		v *= 4
+	}
+	return v
+}
+
+// gcnoFile contains the control flow graphs for the functions in an object
+// file.
+type gcnoFile struct {
+	Stamp     uint32
+	Cwd       string
+	Functions []*gcnoFunction
+}
+
+type gcnoFunction struct {
+	Ident          uint32
+	LinenoChecksum uint32
+	CfgChecksum    uint32
+	Name           string
+	Artificial     bool
+	Filename       string
+	StartLine      int
+	EndLine        int
+	Blocks         []*gcnoBlock
+	Arcs           []*gcnoArc
+}
+
+type gcnoBlock struct {
+	Number int
+	Succ   []*gcnoArc
+	Pred   []*gcnoArc
+	Lines  []gcnoLine
+	Count  uint64
+
+	// Set for blocks that can only be reached by exceptions.
+	exceptional bool
+
+	// Used when counting the loops through the blocks on a line.
+	traversable bool
+	reached     bool
+	incoming    *gcnoArc
+}
+
+type gcnoLine struct {
+	Filename string
+	Line     int
+}
+
+type gcnoArc struct {
+	Src, Dst *gcnoBlock
+	Flags    uint32
+	Count    uint64
+
+	cycleCount uint64
+}
+
+func readGCNO(data []byte) (*gcnoFile, int, error) {
+	r, err := newGCovReader(data, gcovMagicNotes)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	out := &gcnoFile{Stamp: r.word()}
+	if r.version >= 120 {
+		r.word() // Checksum
+	}
+	if r.version >= 90 {
+		out.Cwd = r.string()
+	}
+	if r.version >= 80 {
+		r.word() // Has unexecuted blocks
+	}
+
+	var fn *gcnoFunction
+	for r.err == nil && r.pos+8 <= len(data) {
+		tag := r.word()
+		length := r.length()
+		if length < 0 || r.pos+length > len(data) {
+			return nil, 0, errGCovTruncated
+		}
+		end := r.pos + length
+
+		switch {
+		case tag == gcovTagFunction:
+			fn = &gcnoFunction{}
+			fn.Ident = r.word()
+			fn.LinenoChecksum = r.word()
+			fn.CfgChecksum = r.word()
+			fn.Name = r.string()
+			if r.version >= 80 {
+				fn.Artificial = r.word() != 0
+			}
+			fn.Filename = r.string()
+			fn.StartLine = int(r.word())
+			// Starting with gcc 8, the record also includes the last
+			// line of the function.
+			if r.version >= 80 {
+				r.word() // Start column
+				fn.EndLine = int(r.word())
+			}
+			out.Functions = append(out.Functions, fn)
+
+		case tag == gcovTagBlocks && fn != nil:
+			count := length / 4
+			if r.version >= 80 {
+				count = int(r.word())
+			}
+			fn.Blocks = make([]*gcnoBlock, count)
+			for i := range fn.Blocks {
+				fn.Blocks[i] = &gcnoBlock{Number: i}
+			}
+
+		case tag == gcovTagArcs && fn != nil:
+			src, err := fn.block(r.word())
+			if err != nil {
+				return nil, 0, err
+			}
+			for r.err == nil && r.pos+8 <= end {
+				dst, err := fn.block(r.word())
+				if err != nil {
+					return nil, 0, err
+				}
+				arc := &gcnoArc{Src: src, Dst: dst, Flags: r.word()}
+				src.Succ = append(src.Succ, arc)
+				dst.Pred = append(dst.Pred, arc)
+				fn.Arcs = append(fn.Arcs, arc)
+			}
+
+		case tag == gcovTagLines && fn != nil:
+			block, err := fn.block(r.word())
+			if err != nil {
+				return nil, 0, err
+			}
+			filename := fn.Filename
+			for r.err == nil && r.pos < end {
+				line := r.word()
+				if line != 0 {
+					block.Lines = append(block.Lines, gcnoLine{filename, int(line)})
+					continue
+				}
+				filename = r.string()
+				if filename == "" {
+					break
+				}
+			}
+		}
+
+		r.pos = end
+	}
+
+	// Like gcov, order the arcs from each block by destination, which
+	// determines the order of the branches.
+	for _, fn := range out.Functions {
+		for _, b := range fn.Blocks {
+			sort.SliceStable(b.Succ, func(i, j int) bool {
+				return b.Succ[i].Dst.Number < b.Succ[j].Dst.Number
+			})
+		}
+	}
+
+	return out, r.version, r.err
+}
+
+func (fn *gcnoFunction) block(number uint32) (*gcnoBlock, error) {
+	if int(number) >= len(fn.Blocks) {
+		return nil, fmt.Errorf("block %d out of range in function %s", number, fn.Name)
+	}
+	return fn.Blocks[number], nil
+}
+
+// readGCDA reads the counters for the arcs, and adds them to the functions
+// in the notes file.
+func readGCDA(notes *gcnoFile, data []byte, version int) error {
+	r, err := newGCovReader(data, gcovMagicData)
+	if err != nil {
+		return err
+	}
+	if r.version != version {
+		return errors.New("version does not match notes file")
+	}
+	if r.word() != notes.Stamp {
+		return errors.New("stamp does not match notes file")
+	}
+	if r.version >= 120 {
+		r.word() // Checksum
+	}
+
+	functions := make(map[uint32]*gcnoFunction, len(notes.Functions))
+	for _, v := range notes.Functions {
+		functions[v.Ident] = v
+	}
+
+	var fn *gcnoFunction
+	for r.err == nil && r.pos+8 <= len(data) {
+		tag := r.word()
+		length := r.length()
+		if tag == 0 {
+			break
+		}
+		end := r.pos
+		if length > 0 {
+			end += length
+		}
+		if end > len(data) {
+			return errGCovTruncated
+		}
+
+		switch {
+		case tag == gcovTagFunction:
+			// A function record with no data is a placeholder.
+			fn = nil
+			if length == 0 {
+				break
+			}
+			ident, lineno, cfg := r.word(), r.word(), r.word()
+			fn = functions[ident]
+			if fn == nil {
+				return fmt.Errorf("unknown function with ident %d", ident)
+			}
+			if fn.LinenoChecksum != lineno || fn.CfgChecksum != cfg {
+				return fmt.Errorf("checksums for function %s do not match notes file", fn.Name)
+			}
+
+		case tag == gcovTagCounterArcs && fn != nil:
+			// There is a counter for each arc that is not on the spanning
+			// tree.
+			arcs := []*gcnoArc(nil)
+			for _, v := range fn.Arcs {
+				if v.Flags&gcovArcOnTree == 0 {
+					arcs = append(arcs, v)
+				}
+			}
+			if length != len(arcs)*8 && length != -len(arcs)*8 {
+				return fmt.Errorf("number of counters for function %s does not match notes file", fn.Name)
+			}
+			if length > 0 {
+				for _, v := range arcs {
+					v.Count += r.counter()
+				}
+			}
+		}
+
+		r.pos = end
+	}
+
+	return r.err
+}
+
+// solve computes the counts for the arcs on the spanning tree, and then the
+// counts for the blocks.  The counts for the arcs not on the tree are known
+// from the data file.
+func (fn *gcnoFunction) solve(version int) {
+	if len(fn.Blocks) < 2 {
+		return
+	}
+
+	// Close the graph with an arc from the exit to the entry, so that the
+	// flow into every block matches the flow out.  Starting with gcc 4.8, the
+	// exit is the second block.
+	entry, exit := fn.Blocks[0], fn.Blocks[len(fn.Blocks)-1]
+	if version >= 48 {
+		exit = fn.Blocks[1]
+	}
+	closing := &gcnoArc{Src: exit, Dst: entry, Flags: gcovArcOnTree}
+	exit.Succ = append(exit.Succ, closing)
+	entry.Pred = append(entry.Pred, closing)
+
+	visited := make(map[*gcnoBlock]bool, len(fn.Blocks))
+	fn.propagate(visited, entry, nil)
+
+	exit.Succ = exit.Succ[:len(exit.Succ)-1]
+	entry.Pred = entry.Pred[:len(entry.Pred)-1]
+
+	for _, b := range fn.Blocks {
+		b.Count = 0
+		for _, v := range b.Succ {
+			b.Count += v.Count
+		}
+	}
+}
+
+// findExceptionalBlocks marks the blocks that can only be reached when an
+// exception is thrown, in the same manner as gcov.  Arcs from a block that
+// makes a call, other than the fall through, go to the exception handlers.
+func (fn *gcnoFunction) findExceptionalBlocks() {
+	if len(fn.Blocks) == 0 {
+		return
+	}
+	for _, b := range fn.Blocks {
+		b.exceptional = true
+	}
+
+	queue := []*gcnoBlock{fn.Blocks[0]}
+	fn.Blocks[0].exceptional = false
+	for len(queue) > 0 {
+		b := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+
+		isCall := false
+		for _, v := range b.Succ {
+			isCall = isCall || v.Flags&gcovArcFake != 0
+		}
+		for _, v := range b.Succ {
+			isThrow := isCall && v.Flags&gcovArcFallthrough == 0
+			if v.Flags&gcovArcFake == 0 && !isThrow && v.Dst.exceptional {
+				v.Dst.exceptional = false
+				queue = append(queue, v.Dst)
+			}
+		}
+	}
+}
+
+// propagate computes the count for the arc pred on the spanning tree, which
+// is the excess flow into or out of the block.
+func (fn *gcnoFunction) propagate(visited map[*gcnoBlock]bool, b *gcnoBlock, pred *gcnoArc) uint64 {
+	if visited[b] {
+		return 0
+	}
+	visited[b] = true
+
+	excess := int64(0)
+	for _, v := range b.Pred {
+		if v == pred {
+			continue
+		}
+		if v.Flags&gcovArcOnTree != 0 {
+			excess += int64(fn.propagate(visited, v.Src, v))
+		} else {
+			excess += int64(v.Count)
+		}
+	}
+	for _, v := range b.Succ {
+		if v == pred {
+			continue
+		}
+		if v.Flags&gcovArcOnTree != 0 {
+			excess -= int64(fn.propagate(visited, v.Dst, v))
+		} else {
+			excess -= int64(v.Count)
+		}
+	}
+	if excess < 0 {
+		excess = -excess
+	}
+	if pred != nil {
+		pred.Count = uint64(excess)
+	}
+	return uint64(excess)
+}
+
+// gcnoLineCount computes the count for a line using the same method as gcov.
+// The count is the flow into the blocks on the line from other lines, plus
+// the number of times that loops within the line were executed.
+func gcnoLineCount(blocks []*gcnoBlock) uint64 {
+	onLine := make(map[*gcnoBlock]bool, len(blocks))
+	for _, b := range blocks {
+		onLine[b] = true
+	}
+
+	count := uint64(0)
+	for _, b := range blocks {
+		if b.Number == 0 {
+			for _, v := range b.Succ {
+				count += v.Count
+			}
+		} else {
+			for _, v := range b.Pred {
+				if !onLine[v.Src] {
+					count += v.Count
+				}
+			}
+		}
+		for _, v := range b.Succ {
+			v.cycleCount = v.Count
+		}
+	}
+
+	for {
+		for _, b := range blocks {
+			b.traversable = true
+			b.reached = false
+			b.incoming = nil
+		}
+		d := uint64(0)
+		for _, b := range blocks {
+			if b.traversable {
+				if d = gcnoAugmentCycle(b); d > 0 {
+					break
+				}
+			}
+		}
+		if d == 0 {
+			break
+		}
+		count += d
+	}
+	for _, b := range blocks {
+		b.traversable = false
+	}
+	return count
+}
+
+// gcnoAugmentCycle searches for a cycle through the traversable blocks,
+// starting with src.  If a cycle is found, the smallest count for an arc in
+// the cycle is removed from all of its arcs, and returned.
+func gcnoAugmentCycle(src *gcnoBlock) uint64 {
+	type frame struct {
+		block *gcnoBlock
+		next  int
+	}
+
+	stack := []frame{{src, 0}}
+	src.reached = true
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		u := top.block
+		if top.next == len(u.Succ) {
+			u.traversable = false
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		arc := u.Succ[top.next]
+		top.next++
+
+		if arc.cycleCount == 0 || !arc.Dst.traversable || arc.Dst == u {
+			continue
+		}
+		if !arc.Dst.reached {
+			arc.Dst.reached = true
+			arc.Dst.incoming = arc
+			stack = append(stack, frame{arc.Dst, 0})
+			continue
+		}
+
+		// The arc closes a cycle.
+		minCount := arc.cycleCount
+		for v := u; v != arc.Dst; v = v.incoming.Src {
+			if v.incoming.cycleCount < minCount {
+				minCount = v.incoming.cycleCount
+			}
+		}
+		arc.cycleCount -= minCount
+		for v := u; v != arc.Dst; v = v.incoming.Src {
+			v.incoming.cycleCount -= minCount
+		}
+		return minCount
+	}
+	return 0
+}
+
+// loadGCNOFile loads the coverage data from a notes file written by gcc, and
+// the matching data file.  If the data file is missing, the object was never
+// run, and all of the counts are zero.
+func loadGCNOFile(fds FileDataSet, file *os.File) error {
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	notes, version, err := readGCNO(data)
+	if err != nil {
+		return fmt.Errorf("%s: %s", file.Name(), err)
+	}
+
+	datafile := strings.TrimSuffix(file.Name(), ".gcno") + ".gcda"
+	data, err = ioutil.ReadFile(datafile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		err = readGCDA(notes, data, version)
+		if err != nil {
+			return fmt.Errorf("%s: %s", datafile, err)
+		}
+	}
+
+	loadGCNOData(fds, notes, version)
+	return nil
+}
+
+func loadGCNOData(fds FileDataSet, notes *gcnoFile, version int) {
+	// Filenames are relative to the working directory of the compiler, which
+	// is recorded starting with gcc 9.
+	filename := func(name string) string {
+		if notes.Cwd == "" || filepath.IsAbs(name) {
+			return name
+		}
+		return filepath.Join(notes.Cwd, name)
+	}
+
+	lines := make(map[gcnoLine][]*gcnoBlock)
+	for _, fn := range notes.Functions {
+		if fn.Artificial {
+			continue
+		}
+		fn.solve(version)
+		fn.findExceptionalBlocks()
+
+		currentData := fds.FileData(filename(fn.Filename))
+		entryCount := uint64(0)
+		if len(fn.Blocks) > 0 {
+			entryCount = fn.Blocks[0].Count
+		}
+		currentData.AppendFunctionData(fn.Name, fn.StartLine, fn.EndLine, entryCount)
+
+		for _, b := range fn.Blocks {
+			for _, v := range b.Lines {
+				lines[v] = append(lines[v], b)
+			}
+			loadGCNOBranches(fds, b, filename)
+		}
+	}
+
+	for line, blocks := range lines {
+		currentData := fds.FileData(filename(line.Filename))
+		currentData.AppendLineCountData(line.Line, gcnoLineCount(blocks))
+		// Like gcov, a line is partially executed if it has a block that
+		// was not executed, ignoring blocks for exception handlers.
+		for _, b := range blocks {
+			if !b.exceptional && b.Count == 0 {
+				currentData.AppendPartialLine(line.Line)
+				break
+			}
+		}
+	}
+}
+
+// loadGCNOBranches adds the branches for a block, which are reported on the
+// last line of the block.  Arcs that are fake, such as for calls that do not
+// return, are not branches.
+func loadGCNOBranches(fds FileDataSet, b *gcnoBlock, filename func(string) string) {
+	if len(b.Lines) == 0 {
+		return
+	}
+
+	arcs := []*gcnoArc(nil)
+	for _, v := range b.Succ {
+		if v.Flags&gcovArcFake == 0 {
+			arcs = append(arcs, v)
+		}
+	}
+	if len(arcs) < 2 {
+		return
+	}
+
+	line := b.Lines[len(b.Lines)-1]
+	currentData := fds.FileData(filename(line.Filename))
+	for i, v := range arcs {
+		status := BranchNotTaken
+		if v.Count > 0 {
+			status = BranchTaken
+		} else if b.Count == 0 {
+			status = BranchNotExec
+		}
+		currentData.AppendBranchData(line.Line, BranchData{
+			Status:      status,
+			Count:       v.Count,
+			HasCount:    true,
+			Block:       b.Number,
+			Branch:      i,
+			Fallthrough: v.Flags&gcovArcFallthrough != 0,
+		})
+	}
+}
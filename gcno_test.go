@@ -0,0 +1,500 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewGCovReader(t *testing.T) {
+	cases := []struct {
+		data    string
+		version int
+		ok      bool
+	}{
+		{"oncg*22B\x00\x00\x00\x00", 122, true},
+		{"gcnoB22*\x00\x00\x00\x00", 122, true},
+		{"oncg*38A\x00\x00\x00\x00", 83, true},
+		{"oncg*804\x00\x00\x00\x00", 48, true},
+		{"oncg*604\x00\x00\x00\x00", 0, false},
+		{"adcg*22B\x00\x00\x00\x00", 0, false},
+		{"oncg", 0, false},
+	}
+
+	for _, v := range cases {
+		t.Run(v.data, func(t *testing.T) {
+			r, err := newGCovReader([]byte(v.data), gcovMagicNotes)
+			if !v.ok {
+				if err == nil {
+					t.Errorf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if r.version != v.version {
+				LogNE(t, "version", v.version, r.version)
+			}
+		})
+	}
+}
+
+func TestLoadGCNOFile(t *testing.T) {
+	fds := make(FileDataSet)
+	err := loadFile(fds, "./testdata/example-12.2.0-gcno/example-iterate.gcno", loadOptions{})
+	if err != nil {
+		t.Fatalf("could not load file: %s", err)
+	}
+
+	data, ok := fds["/example/methods/iterate.c"]
+	if !ok {
+		t.Fatalf("missing data for file")
+	}
+
+	// Expected values are from gcov 12.2.
+	lines := map[int]uint64{19: 1, 23: 1, 28: 22, 33: 21, 35: 0, 36: 0, 41: 21, 44: 1}
+	if !reflect.DeepEqual(data.LineData, lines) {
+		LogNE(t, "line data", lines, data.LineData)
+	}
+	fn := data.FuncData["iterate_get_sum"]
+	if fn.StartLine != 19 || fn.EndLine != 45 || fn.HitCount != 1 {
+		t.Errorf("bad function data: %v", fn)
+	}
+
+	branches := map[int][]uint64{28: {21, 1}, 33: {0, 21}}
+	if len(data.BranchData) != len(branches) {
+		LogNE(t, "branch count", len(branches), len(data.BranchData))
+	}
+	for line, counts := range branches {
+		got := []uint64(nil)
+		for _, v := range data.BranchData[line] {
+			got = append(got, v.Count)
+		}
+		if !reflect.DeepEqual(got, counts) {
+			LogNE(t, "branch counts", counts, got)
+		}
+	}
+	if got := data.BranchData[33][0].Status; got != BranchNotTaken {
+		LogNE(t, "branch status", BranchNotTaken, got)
+	}
+}
+
+func TestLoadGCNOFilePartial(t *testing.T) {
+	fds := make(FileDataSet)
+	err := loadFile(fds, "./testdata/example-12.2.0-partial.gcno", loadOptions{})
+	if err != nil {
+		t.Fatalf("could not load file: %s", err)
+	}
+
+	data, ok := fds["/example/partial.c"]
+	if !ok {
+		t.Fatalf("missing data for file")
+	}
+
+	// Expected values are from gcov 12.2, which marks lines 5 and 11
+	// with an asterisk.
+	for lineNo := range data.LineData {
+		expected := lineNo == 5 || lineNo == 11
+		if got := data.PartialLine(lineNo); got != expected {
+			t.Errorf("Case %d: expected %v, got %v", lineNo, expected, got)
+		}
+	}
+	if hits := data.LineData[11]; hits != 5 {
+		LogNE(t, "hit count", uint64(5), hits)
+	}
+}
+
+func TestLoadGCNOFileWithoutData(t *testing.T) {
+	dir, cleanup := TempDirectory(t)
+	defer cleanup()
+
+	notes, err := ioutil.ReadFile("./testdata/example-12.2.0-gcno/example-gauss.gcno")
+	if err != nil {
+		t.Fatalf("could not read file: %s", err)
+	}
+	filename := filepath.Join(dir, "example-gauss.gcno")
+	err = ioutil.WriteFile(filename, notes, 0644)
+	if err != nil {
+		t.Fatalf("could not write file: %s", err)
+	}
+
+	fds := make(FileDataSet)
+	err = loadFile(fds, filename, loadOptions{})
+	if err != nil {
+		t.Fatalf("could not load file: %s", err)
+	}
+
+	data := fds["/example/methods/gauss.c"]
+	if lcov := data.LineCoverage(); lcov != (Coverage{0, 4}) {
+		LogNE(t, "line coverage", Coverage{0, 4}, lcov)
+	}
+	if got := data.BranchData[42][0].Status; got != BranchNotExec {
+		LogNE(t, "branch status", BranchNotExec, got)
+	}
+}
+
+func TestLoadGCNOFileMismatch(t *testing.T) {
+	dir, cleanup := TempDirectory(t)
+	defer cleanup()
+
+	copyFile := func(src, dst string) {
+		data, err := ioutil.ReadFile(filepath.Join("./testdata/example-12.2.0-gcno", src))
+		if err != nil {
+			t.Fatalf("could not read file: %s", err)
+		}
+		err = ioutil.WriteFile(filepath.Join(dir, dst), data, 0644)
+		if err != nil {
+			t.Fatalf("could not write file: %s", err)
+		}
+	}
+	copyFile("example-gauss.gcno", "example.gcno")
+	copyFile("example-iterate.gcda", "example.gcda")
+
+	fds := make(FileDataSet)
+	err := loadFile(fds, filepath.Join(dir, "example.gcno"), loadOptions{})
+	if err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestReadGCNOTruncated(t *testing.T) {
+	data, err := ioutil.ReadFile("./testdata/example-12.2.0-gcno/example-gauss.gcno")
+	if err != nil {
+		t.Fatalf("could not read file: %s", err)
+	}
+
+	for _, n := range []int{8, 16, 30, 100, len(data) - 1} {
+		if _, _, err := readGCNO(data[:n]); err == nil {
+			t.Errorf("expected error for %d bytes", n)
+		}
+	}
+}
+
+// gcovTestWriter writes notes and data files using the layout for a version
+// of gcc.
+type gcovTestWriter struct {
+	bytes.Buffer
+	order   binary.ByteOrder
+	version int
+}
+
+func (w *gcovTestWriter) word(v uint32) {
+	var tmp [4]byte
+	w.order.PutUint32(tmp[:], v)
+	w.Write(tmp[:])
+}
+
+func (w *gcovTestWriter) string(v string) {
+	if v == "" {
+		w.word(0)
+		return
+	}
+	if w.version >= 120 {
+		w.word(uint32(len(v) + 1))
+		w.WriteString(v + "\x00")
+		return
+	}
+	length := len(v)/4 + 1
+	w.word(uint32(length))
+	w.WriteString(v + strings.Repeat("\x00", length*4-len(v)))
+}
+
+func (w *gcovTestWriter) header(magic, stamp uint32) {
+	w.word(magic)
+	v := w.version
+	if v >= 70 {
+		w.word(uint32('A'+v/100)<<24 | uint32('0'+v/10%10)<<16 | uint32('0'+v%10)<<8 | '*')
+	} else {
+		w.word(uint32('0'+v/10)<<24 | uint32('0')<<16 | uint32('0'+v%10)<<8 | '*')
+	}
+	w.word(stamp)
+	if v >= 120 {
+		w.word(0) // Checksum
+	}
+}
+
+func (w *gcovTestWriter) record(tag uint32, body func(*gcovTestWriter)) {
+	tmp := &gcovTestWriter{order: w.order, version: w.version}
+	body(tmp)
+	w.word(tag)
+	if w.version >= 120 {
+		w.word(uint32(tmp.Len()))
+	} else {
+		w.word(uint32(tmp.Len() / 4))
+	}
+	w.Write(tmp.Bytes())
+}
+
+// writeGCovTestFiles writes the notes and data files for a function on
+// lines 3 to 6, with a branch at the end of line 4 that was taken three
+// times out of five.
+func writeGCovTestFiles(t *testing.T, dir string, version int, order binary.ByteOrder) string {
+	// Starting with gcc 4.8, the exit is the second block.
+	entry, exit, body, then := 0, 1, 2, 3
+	if version < 48 {
+		entry, body, then, exit = 0, 1, 2, 3
+	}
+
+	notes := &gcovTestWriter{order: order, version: version}
+	notes.header(gcovMagicNotes, 1234)
+	if version >= 90 {
+		notes.string("/src")
+	}
+	if version >= 80 {
+		notes.word(1) // Has unexecuted blocks
+	}
+	notes.record(gcovTagFunction, func(w *gcovTestWriter) {
+		w.word(1) // Ident
+		w.word(2) // Line number checksum
+		w.word(3) // Control flow checksum
+		w.string("main")
+		if version >= 80 {
+			w.word(0) // Artificial
+		}
+		w.string("a.c")
+		w.word(3)
+		if version >= 80 {
+			w.word(1) // Start column
+			w.word(6)
+			w.word(1) // End column
+		}
+	})
+	notes.record(gcovTagBlocks, func(w *gcovTestWriter) {
+		if version >= 80 {
+			w.word(4)
+			return
+		}
+		for i := 0; i < 4; i++ {
+			w.word(0) // Flags
+		}
+	})
+	arcs := func(src int, dst ...int) {
+		notes.record(gcovTagArcs, func(w *gcovTestWriter) {
+			w.word(uint32(src))
+			for i := 0; i < len(dst); i += 2 {
+				w.word(uint32(dst[i]))
+				w.word(uint32(dst[i+1]))
+			}
+		})
+	}
+	arcs(entry, body, gcovArcOnTree|gcovArcFallthrough)
+	arcs(body, then, 0, exit, 0)
+	arcs(then, exit, gcovArcOnTree|gcovArcFallthrough)
+	lines := func(block int, lines ...uint32) {
+		notes.record(gcovTagLines, func(w *gcovTestWriter) {
+			w.word(uint32(block))
+			w.word(0)
+			w.string("a.c")
+			for _, v := range lines {
+				w.word(v)
+			}
+			w.word(0)
+			w.string("")
+		})
+	}
+	lines(body, 3, 4)
+	lines(then, 5)
+
+	data := &gcovTestWriter{order: order, version: version}
+	data.header(gcovMagicData, 1234)
+	data.record(gcovTagFunction, func(w *gcovTestWriter) {
+		w.word(1)
+		w.word(2)
+		w.word(3)
+	})
+	data.record(gcovTagCounterArcs, func(w *gcovTestWriter) {
+		for _, v := range []uint32{3, 2} {
+			w.word(v)
+			w.word(0)
+		}
+	})
+
+	filename := filepath.Join(dir, fmt.Sprintf("a-%d.gcno", version))
+	err := ioutil.WriteFile(filename, notes.Bytes(), 0644)
+	if err != nil {
+		t.Fatalf("could not write file: %s", err)
+	}
+	err = ioutil.WriteFile(strings.TrimSuffix(filename, ".gcno")+".gcda", data.Bytes(), 0644)
+	if err != nil {
+		t.Fatalf("could not write file: %s", err)
+	}
+	return filename
+}
+
+func TestLoadGCNOFileVersions(t *testing.T) {
+	dir, cleanup := TempDirectory(t)
+	defer cleanup()
+
+	cases := []struct {
+		version  int
+		order    binary.ByteOrder
+		filename string
+		endLine  int
+		branches []uint64
+	}{
+		{47, binary.LittleEndian, "a.c", 0, []uint64{3, 2}},
+		{48, binary.BigEndian, "a.c", 0, []uint64{2, 3}},
+		{73, binary.LittleEndian, "a.c", 0, []uint64{2, 3}},
+		{83, binary.LittleEndian, "a.c", 6, []uint64{2, 3}},
+		{93, binary.BigEndian, "/src/a.c", 6, []uint64{2, 3}},
+		{122, binary.LittleEndian, "/src/a.c", 6, []uint64{2, 3}},
+	}
+
+	for _, v := range cases {
+		t.Run(fmt.Sprintf("%d", v.version), func(t *testing.T) {
+			filename := writeGCovTestFiles(t, dir, v.version, v.order)
+
+			fds := make(FileDataSet)
+			err := loadFile(fds, filename, loadOptions{})
+			if err != nil {
+				t.Fatalf("could not load file: %s", err)
+			}
+			data, ok := fds[filepath.FromSlash(v.filename)]
+			if !ok {
+				t.Fatalf("missing data for file")
+			}
+
+			lines := map[int]uint64{3: 5, 4: 5, 5: 3}
+			if !reflect.DeepEqual(data.LineData, lines) {
+				LogNE(t, "line data", lines, data.LineData)
+			}
+			fn := FuncData{StartLine: 3, EndLine: v.endLine, HitCount: 5}
+			if got := data.FuncData["main"]; got != fn {
+				LogNE(t, "function data", fn, got)
+			}
+			// Branches are ordered by the destination block, and the
+			// exit block moved with gcc 4.8.
+			counts := []uint64(nil)
+			for _, w := range data.BranchData[4] {
+				counts = append(counts, w.Count)
+			}
+			if !reflect.DeepEqual(counts, v.branches) {
+				LogNE(t, "branch counts", v.branches, counts)
+			}
+		})
+	}
+}
+
+func TestGCNOLineCount(t *testing.T) {
+	// A line with a loop, such as "for (i = 0; i < 10; i++) s += i;", has a
+	// block for the test that is entered once from above, and ten times from
+	// the body.
+	blocks := []*gcnoBlock{{Number: 2}, {Number: 3}, {Number: 4}, {Number: 5}}
+	arc := func(src, dst int, count uint64) {
+		v := &gcnoArc{Src: blocks[src], Dst: blocks[dst], Count: count}
+		blocks[src].Succ = append(blocks[src].Succ, v)
+		blocks[dst].Pred = append(blocks[dst].Pred, v)
+	}
+	arc(0, 1, 1)
+	arc(1, 2, 10)
+	arc(2, 1, 10)
+	arc(1, 3, 1)
+
+	if got := gcnoLineCount(blocks[1:3]); got != 11 {
+		LogNE(t, "line count", uint64(11), got)
+	}
+	if got := gcnoLineCount(blocks[3:]); got != 1 {
+		LogNE(t, "line count", uint64(1), got)
+	}
+	for _, v := range blocks {
+		if v.traversable {
+			t.Errorf("block %d left traversable", v.Number)
+		}
+	}
+}
+
+func TestWalkNotesFromDir(t *testing.T) {
+	cases := []struct {
+		files    []string
+		expected []string
+	}{
+		{
+			[]string{"methods/example.gcda", "methods/example.gcno", "methods/example.json", ".hidden/example.gcno"},
+			[]string{"methods/example.gcno"},
+		},
+		{
+			[]string{"main.gcno", "methods/example.gcno", "example.c.gcov"},
+			[]string{"example.c.gcov"},
+		},
+	}
+
+	for i, v := range cases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			dir, cleanup := TempDirectory(t)
+			defer cleanup()
+
+			for _, w := range v.files {
+				name := filepath.Join(dir, filepath.FromSlash(w))
+				err := os.MkdirAll(filepath.Dir(name), 0755)
+				if err != nil {
+					t.Fatalf("could not create directory: %s", err)
+				}
+				err = ioutil.WriteFile(name, nil, 0644)
+				if err != nil {
+					t.Fatalf("could not write file: %s", err)
+				}
+			}
+
+			got := []string(nil)
+			err := walkFile(dir, loadOptions{}, func(parser Parser, file *os.File) error {
+				name, _ := filepath.Rel(dir, file.Name())
+				got = append(got, filepath.ToSlash(name))
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("could not walk directory: %s", err)
+			}
+			if !reflect.DeepEqual(got, v.expected) {
+				LogNE(t, "files", v.expected, got)
+			}
+		})
+	}
+}
+
+func TestWalkNotesFromDirUnreadable(t *testing.T) {
+	dir, cleanup := TempDirectory(t)
+	defer cleanup()
+
+	for _, v := range []string{"a/example.gcno", "b/private/example.gcno"} {
+		name := filepath.Join(dir, filepath.FromSlash(v))
+		err := os.MkdirAll(filepath.Dir(name), 0755)
+		if err != nil {
+			t.Fatalf("could not create directory: %s", err)
+		}
+		err = ioutil.WriteFile(name, nil, 0644)
+		if err != nil {
+			t.Fatalf("could not write file: %s", err)
+		}
+	}
+	private := filepath.Join(dir, "b", "private")
+	if err := os.Chmod(private, 0); err != nil {
+		t.Fatalf("could not change permissions: %s", err)
+	}
+	defer os.Chmod(private, 0755)
+	if _, err := ioutil.ReadDir(private); err == nil {
+		t.Skip("permissions are not enforced")
+	}
+
+	warnings := bytes.NewBuffer(nil)
+	got := []string(nil)
+	err := walkFile(dir, loadOptions{warnings: warnings}, func(parser Parser, file *os.File) error {
+		got = append(got, file.Name())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("could not walk directory: %s", err)
+	}
+	if expected := []string{filepath.Join(dir, "a", "example.gcno")}; !reflect.DeepEqual(got, expected) {
+		LogNE(t, "files", expected, got)
+	}
+	if !strings.Contains(warnings.String(), "warning: skipping unreadable path") {
+		t.Errorf("missing warning: %q", warnings.String())
+	}
+}
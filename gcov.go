@@ -1,20 +1,29 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
-	"os"
+	"io"
 	"path/filepath"
 	"strconv"
 )
 
-func loadGCovFile(fds FileDataSet, file *os.File) error {
+func loadGCovFile(fds FileDataSet, file io.Reader, opts loadOptions) error {
+	return streamGCovFile(fds, file, opts, nil)
+}
+
+// streamGCovFile loads the coverage data from the intermediate format.  If
+// flush is not nil, it is called as each source file is completed, after
+// which the data for that source file is removed from fds.
+func streamGCovFile(fds FileDataSet, file io.Reader, opts loadOptions, flush func(FileDataSet) error) error {
 	currentData := (*FileData)(nil)
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		t, value := recordType(scanner.Text())
+	s := newRecordScanner(file, opts)
+	for s.scan() {
+		t, value := recordType(s.text())
 		switch t {
+		case "":
+			// ignore blank lines
+
 		case "version":
 			// Don't need to track the version, as the record variations can be
 			// recognized when the fields are split.  May want to print the
@@ -23,120 +32,176 @@ func loadGCovFile(fds FileDataSet, file *os.File) error {
 			// fmt.Println("version", value)
 
 		case "file":
+			if flush != nil && len(fds) > 0 {
+				err := flushFileData(fds, flush)
+				if err != nil {
+					return err
+				}
+			}
 			currentData = fds.FileData(value)
 
-		case "function":
-			funcName, funcStart, hitCount, err := parseFunctionRecord(value)
-			if err != nil {
-				return err
+		case "function", "lcount", "branch":
+			if currentData == nil {
+				if err := s.missingFile(t); err != nil {
+					return err
+				}
+				continue
 			}
-			currentData.AppendFunctionData(funcName, funcStart, hitCount)
-
-		case "lcount":
-			lineNo, hitCount, err := parseLCountRecord(value)
-			if err != nil {
-				return err
+			if err := appendGCovRecord(currentData, t, value); err != nil {
+				if err := s.badRecord(err); err != nil {
+					return err
+				}
 			}
-			currentData.AppendLineCountData(lineNo, hitCount)
 
-		case "branch":
-			lineNo, branchStatus, err := parseBranchRecord(value)
-			if err != nil {
+		default:
+			if err := s.unknownRecord(t); err != nil {
 				return err
 			}
-			currentData.AppendBranchData(lineNo, branchStatus)
-
-		default:
-			// Unknown records are ignored.  If future versions of the file
-			// format introduce new records, we don't want to have an error.
 		}
 	}
+	if err := s.finish(); err != nil {
+		return err
+	}
 
-	return scanner.Err()
+	if flush != nil && len(fds) > 0 {
+		return flushFileData(fds, flush)
+	}
+	return nil
 }
 
-func parseFunctionRecord(value string) (funcName string, funcStart int, hitCount uint64, err error) {
+// appendGCovRecord parses a data record from the intermediate format, and
+// adds the data to the source file.
+func appendGCovRecord(currentData *FileData, t, value string) error {
+	switch t {
+	case "function":
+		funcName, funcStart, funcEnd, hitCount, err := parseFunctionRecord(value)
+		if err != nil {
+			return err
+		}
+		currentData.AppendFunctionData(funcName, funcStart, funcEnd, hitCount)
+
+	case "lcount":
+		lineNo, hitCount, unexecuted, err := parseLCountRecord(value)
+		if err != nil {
+			return err
+		}
+		currentData.AppendLineCountData(lineNo, hitCount)
+		if unexecuted {
+			currentData.AppendPartialLine(lineNo)
+		}
+
+	case "branch":
+		lineNo, branchData, err := parseBranchRecord(value)
+		if err != nil {
+			return err
+		}
+		currentData.AppendBranchData(lineNo, branchData)
+	}
+	return nil
+}
+
+func parseFunctionRecord(value string) (funcName string, funcStart, funcEnd int, hitCount uint64, err error) {
 	buffer := [4]string{}
 	values := splitOnComma(buffer[:], value)
 
 	if len(values) == 3 {
 		tmp, err := strconv.ParseUint(values[0], 10, 64)
 		if err != nil {
-			return "", 0, 0, fmt.Errorf("can't parse function record: %s", err)
+			return "", 0, 0, 0, fmt.Errorf("can't parse function record: %s", err)
 		}
 		funcStart = int(tmp)
 
 		hitCount, err = strconv.ParseUint(values[1], 10, 64)
 		if err != nil {
-			return "", 0, 0, fmt.Errorf("can't parse function record: %s", err)
+			return "", 0, 0, 0, fmt.Errorf("can't parse function record: %s", err)
 		}
 		funcName = values[2]
-		return funcName, funcStart, hitCount, nil
+		return funcName, funcStart, 0, hitCount, nil
 	} else if len(values) == 4 {
 		// The first two fields are the line number range for the function.
-		// We are using the start.
 		tmp, err := strconv.ParseUint(values[0], 10, 64)
 		if err != nil {
-			return "", 0, 0, fmt.Errorf("can't parse function record: %s", err)
+			return "", 0, 0, 0, fmt.Errorf("can't parse function record: %s", err)
 		}
 		funcStart = int(tmp)
 
+		tmp, err = strconv.ParseUint(values[1], 10, 64)
+		if err != nil {
+			return "", 0, 0, 0, fmt.Errorf("can't parse function record: %s", err)
+		}
+		funcEnd = int(tmp)
+
 		hitCount, err = strconv.ParseUint(values[2], 10, 64)
 		if err != nil {
-			return "", 0, 0, fmt.Errorf("can't parse function record: %s", err)
+			return "", 0, 0, 0, fmt.Errorf("can't parse function record: %s", err)
 		}
 		funcName = values[3]
-		return funcName, funcStart, hitCount, nil
+		return funcName, funcStart, funcEnd, hitCount, nil
 	}
 
-	return "", 0, 0, fmt.Errorf("can't parse function record")
+	return "", 0, 0, 0, fmt.Errorf("can't parse function record")
 }
 
-func parseLCountRecord(value string) (lineNo int, hitCount uint64, err error) {
+// parseLCountRecord parses a line record, which has the format
+// <line>,<count>[,<has_unexecuted_block>].  The flag, which was added in gcc
+// 8, is set if the line contains blocks that were not executed.
+func parseLCountRecord(value string) (lineNo int, hitCount uint64, unexecuted bool, err error) {
 	buffer := [4]string{}
 	values := splitOnComma(buffer[:], value)
 
 	if l := len(values); l != 2 && l != 3 {
-		return 0, 0, fmt.Errorf("can't parse lcount record")
+		return 0, 0, false, fmt.Errorf("can't parse lcount record")
 	}
 
 	lineNoTmp, err := strconv.ParseInt(values[0], 10, 64)
 	if err != nil {
-		return 0, 0, fmt.Errorf("can't parse lcount record: %s", err)
+		return 0, 0, false, fmt.Errorf("can't parse lcount record: %s", err)
 	}
 	lineNo = int(lineNoTmp)
 	hitCount, err = strconv.ParseUint(values[1], 10, 64)
 	if err != nil {
-		return 0, 0, fmt.Errorf("can't parse lcount record: %s", err)
+		return 0, 0, false, fmt.Errorf("can't parse lcount record: %s", err)
+	}
+	if len(values) == 3 {
+		unexecuted, err = strconv.ParseBool(values[2])
+		if err != nil {
+			return 0, 0, false, fmt.Errorf("can't parse lcount record: %s", err)
+		}
 	}
 
-	return lineNo, hitCount, nil
+	return lineNo, hitCount, unexecuted, nil
 }
 
-func parseBranchRecord(value string) (lineNo int, status BranchStatus, err error) {
+func parseBranchRecord(value string) (lineNo int, data BranchData, err error) {
 	buffer := [4]string{}
 	values := splitOnComma(buffer[:], value)
 
 	if len(values) != 2 {
-		return 0, 0, fmt.Errorf("can't parse branch record")
+		return 0, BranchData{}, fmt.Errorf("can't parse branch record")
 	}
 
 	lineNoTmp, err := strconv.ParseInt(values[0], 10, 64)
 	if err != nil {
-		return 0, 0, fmt.Errorf("can't parse branch record: %s", err)
+		return 0, BranchData{}, fmt.Errorf("can't parse branch record: %s", err)
 	}
 	lineNo = int(lineNoTmp)
 
+	// The intermediate format does not include counts or identifiers for
+	// the branches.
+	data = BranchData{Block: -1, Branch: -1}
 	switch values[1] {
 	case "taken":
-		return lineNo, BranchTaken, nil
+		data.Status = BranchTaken
+		return lineNo, data, nil
 	case "nottaken":
-		return lineNo, BranchNotTaken, nil
+		data.Status = BranchNotTaken
+		return lineNo, data, nil
 	case "notexec":
-		return lineNo, BranchNotExec, nil
+		data.Status = BranchNotExec
+		return lineNo, data, nil
 	}
 
-	return 0, 0, fmt.Errorf("can't parse branch record: unrecognized branch status")
+	return 0, BranchData{}, fmt.Errorf("can't parse branch record: unrecognized branch status")
 }
 
 func filterExternalFileData(fileData map[string]*FileData, external bool) map[string]*FileData {
@@ -145,9 +210,16 @@ func filterExternalFileData(fileData map[string]*FileData, external bool) map[st
 	}
 
 	for key := range fileData {
-		if filepath.IsAbs(key) {
+		if isExternalFile(key) {
 			delete(fileData, key)
 		}
 	}
 	return fileData
 }
+
+// isExternalFile returns true if the file is outside of the source
+// directory, or if it belongs to a Rust dependency or to the Rust standard
+// library.
+func isExternalFile(filename string) bool {
+	return filepath.IsAbs(filename) || isRustExternalFile(filename)
+}
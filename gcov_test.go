@@ -10,17 +10,19 @@ func TestParseFunctionRecord(t *testing.T) {
 		ok       bool
 		name     string
 		line     int
+		endLine  int
 		hitCount uint64
 	}{
-		{"function:222,6,main", true, "main", 222, 6},
-		{"function:222,223,6,main", true, "main", 222, 6},
-		{"function:222,0,main", true, "main", 222, 0},
-		{"function:222,223,0,main", true, "main", 222, 0},
-		{"function:#,6,main", false, "", 0, 0},
-		{"function:222,#,main", false, "", 0, 0},
-		{"function:#,223,6,main", false, "", 0, 0},
-		{"function:222,223,#,main", false, "", 0, 0},
-		{"function:222,main", false, "", 0, 0},
+		{"function:222,6,main", true, "main", 222, 0, 6},
+		{"function:222,223,6,main", true, "main", 222, 223, 6},
+		{"function:222,0,main", true, "main", 222, 0, 0},
+		{"function:222,223,0,main", true, "main", 222, 223, 0},
+		{"function:#,6,main", false, "", 0, 0, 0},
+		{"function:222,#,main", false, "", 0, 0, 0},
+		{"function:#,223,6,main", false, "", 0, 0, 0},
+		{"function:222,#,6,main", false, "", 0, 0, 0},
+		{"function:222,223,#,main", false, "", 0, 0, 0},
+		{"function:222,main", false, "", 0, 0, 0},
 	}
 
 	for _, v := range cases {
@@ -29,12 +31,15 @@ func TestParseFunctionRecord(t *testing.T) {
 			if rt != "function" {
 				LogNE(t, "record type", "function", rt)
 			}
-			name, line, hc, err := parseFunctionRecord(value)
+			name, line, endLine, hc, err := parseFunctionRecord(value)
 			if name != v.name {
 				LogNE(t, "function name", v.name, name)
 			}
 			if line != v.line {
-				LogNE(t, "function line", v.name, name)
+				LogNE(t, "function line", v.line, line)
+			}
+			if endLine != v.endLine {
+				LogNE(t, "function end line", v.endLine, endLine)
 			}
 			if hc != v.hitCount {
 				LogNE(t, "hit count", v.hitCount, hc)
@@ -51,18 +56,21 @@ func TestParseFunctionRecord(t *testing.T) {
 
 func TestParseLCountRecord(t *testing.T) {
 	cases := []struct {
-		value    string
-		ok       bool
-		lineNo   int
-		hitCount uint64
+		value      string
+		ok         bool
+		lineNo     int
+		hitCount   uint64
+		unexecuted bool
 	}{
-		{"lcount:32,18", true, 32, 18},
-		{"lcount:32,0", true, 32, 0},
-		{"lcount:32,18,0", true, 32, 18},
-		{"lcount:32,0,1", true, 32, 0},
-		{"lcount:32,#", false, 0, 0},
-		{"lcount:#,18", false, 0, 0},
-		{"lcount:32", false, 0, 0},
+		{"lcount:32,18", true, 32, 18, false},
+		{"lcount:32,0", true, 32, 0, false},
+		{"lcount:32,18,0", true, 32, 18, false},
+		{"lcount:32,18,1", true, 32, 18, true},
+		{"lcount:32,0,1", true, 32, 0, true},
+		{"lcount:32,#", false, 0, 0, false},
+		{"lcount:#,18", false, 0, 0, false},
+		{"lcount:32,18,#", false, 0, 0, false},
+		{"lcount:32", false, 0, 0, false},
 	}
 
 	for _, v := range cases {
@@ -71,13 +79,16 @@ func TestParseLCountRecord(t *testing.T) {
 			if rt != "lcount" {
 				LogNE(t, "record type", "lcount", rt)
 			}
-			lineNo, hc, err := parseLCountRecord(value)
+			lineNo, hc, unexecuted, err := parseLCountRecord(value)
 			if lineNo != v.lineNo {
 				LogNE(t, "line number", v.lineNo, lineNo)
 			}
 			if hc != v.hitCount {
 				LogNE(t, "hit count", v.hitCount, hc)
 			}
+			if unexecuted != v.unexecuted {
+				LogNE(t, "unexecuted block", v.unexecuted, unexecuted)
+			}
 			if (err == nil) != v.ok {
 				LogNE(t, "ok", v.ok, err == nil)
 				if err != nil {
@@ -109,12 +120,12 @@ func TestParseBranchRecord(t *testing.T) {
 			if rt != "branch" {
 				LogNE(t, "record type", "lcount", rt)
 			}
-			lineNo, status, err := parseBranchRecord(value)
+			lineNo, data, err := parseBranchRecord(value)
 			if lineNo != v.lineNo {
 				LogNE(t, "function name", v.lineNo, lineNo)
 			}
-			if status != v.status {
-				LogNE(t, "hit count", v.status, status)
+			if data.Status != v.status {
+				LogNE(t, "hit count", v.status, data.Status)
 			}
 			if (err == nil) != v.ok {
 				LogNE(t, "ok", v.ok, err == nil)
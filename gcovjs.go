@@ -2,7 +2,7 @@ package main
 
 import (
 	"compress/gzip"
-	"encoding/json"
+	"fmt"
 	"io"
 )
 
@@ -21,13 +21,15 @@ type GCovFile struct {
 type GCovFunction struct {
 	Name           string `json:"name"`
 	StartLine      int    `json:"start_line"`
+	EndLine        int    `json:"end_line"`
 	ExecutionCount uint64 `json:"execution_count"`
 }
 
 type GCovLine struct {
-	LineNumber int          `json:"line_number"`
-	Count      uint64       `json:"count"`
-	Branches   []GCovBranch `json:"branches"`
+	LineNumber      int          `json:"line_number"`
+	Count           uint64       `json:"count"`
+	UnexecutedBlock bool         `json:"unexecuted_block"`
+	Branches        []GCovBranch `json:"branches"`
 }
 
 type GCovBranch struct {
@@ -41,10 +43,10 @@ func loadGCovJSFile(fds FileDataSet, file io.Reader) error {
 
 	gz, err := gzip.NewReader(file)
 	if err != nil {
-		return err
+		return fmt.Errorf("%s: %s", readerName(file), err)
 	}
 
-	err = json.NewDecoder(gz).Decode(&jsonData)
+	err = decodeJSON(gz, readerName(file), &jsonData)
 	if err != nil {
 		return err
 	}
@@ -54,18 +56,31 @@ func loadGCovJSFile(fds FileDataSet, file io.Reader) error {
 		currentData := fds.FileData(filename)
 
 		for _, u := range v.Functions {
-			currentData.AppendFunctionData(u.Name, u.StartLine, u.ExecutionCount)
+			currentData.AppendFunctionData(u.Name, u.StartLine, u.EndLine, u.ExecutionCount)
 		}
 
 		for _, u := range v.Lines {
 			currentData.AppendLineCountData(u.LineNumber, u.Count)
+			if u.UnexecutedBlock {
+				currentData.AppendPartialLine(u.LineNumber)
+			}
 
 			for _, b := range u.Branches {
 				status := BranchNotTaken
 				if b.Count > 0 {
 					status = BranchTaken
+				} else if u.Count == 0 {
+					status = BranchNotExec
 				}
-				currentData.AppendBranchData(u.LineNumber, status)
+				currentData.AppendBranchData(u.LineNumber, BranchData{
+					Status:      status,
+					Count:       b.Count,
+					HasCount:    true,
+					Block:       -1,
+					Branch:      -1,
+					Throw:       b.Throw,
+					Fallthrough: b.Fallthrough,
+				})
 			}
 		}
 	}
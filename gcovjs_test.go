@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"compress/gzip"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -45,3 +46,26 @@ func TestLoadGCovJSFile(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadGCovJSFileUnexecutedBlock(t *testing.T) {
+	const value = `{"format_version":"1","files":[{"file":"a.c","lines":[` +
+		`{"line_number":1,"count":2,"unexecuted_block":false},` +
+		`{"line_number":2,"count":2,"unexecuted_block":true},` +
+		`{"line_number":3,"count":0,"unexecuted_block":true}]}]}`
+
+	fds := make(FileDataSet)
+	err := loadGCovJSFile(fds, strings.NewReader(gzipString(t, value)))
+	if err != nil {
+		t.Fatalf("could not load file: %s", err)
+	}
+
+	data := fds["a.c"]
+	if expected := map[int]uint64{1: 2, 2: 2, 3: 0}; !reflect.DeepEqual(data.LineData, expected) {
+		LogNE(t, "line data", expected, data.LineData)
+	}
+	for lineNo, expected := range map[int]bool{1: false, 2: true, 3: false} {
+		if got := data.PartialLine(lineNo); got != expected {
+			t.Errorf("Case %d: expected %v, got %v", lineNo, expected, got)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+// matchPathPattern reports whether the filename matches the pattern.  The
+// patterns follow the same rules as the CODEOWNERS and .gitignore files used
+// by git:
+//
+//   - A pattern starting with a slash is anchored to the root, otherwise the
+//     pattern can match at any depth if it does not contain a slash.
+//   - A pattern matching a directory also matches all of the files within
+//     that directory.
+//   - The wildcard '*' matches within a single path element, while '**'
+//     matches any number of path elements.
+func matchPathPattern(pattern, filename string) bool {
+	filename = strings.Trim(strings.Replace(filename, "\\", "/", -1), "/")
+
+	if strings.HasPrefix(pattern, "/") {
+		pattern = pattern[1:]
+	} else if !strings.Contains(strings.TrimSuffix(pattern, "/"), "/") {
+		pattern = "**/" + pattern
+	}
+	pattern = strings.TrimSuffix(pattern, "/")
+	if pattern == "" {
+		return false
+	}
+
+	return matchElements(strings.Split(pattern, "/"), strings.Split(filename, "/"))
+}
+
+// matchElements matches the path elements of a pattern against the path
+// elements of a filename.  Any remaining elements of the filename, after the
+// pattern is consumed, are files within a matching directory.
+func matchElements(pattern, filename []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(filename); i++ {
+				if matchElements(pattern[1:], filename[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(filename) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], filename[0]); !ok || err != nil {
+			return false
+		}
+		pattern, filename = pattern[1:], filename[1:]
+	}
+
+	return true
+}
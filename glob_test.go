@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMatchPathPattern(t *testing.T) {
+	cases := []struct {
+		pattern  string
+		filename string
+		expected bool
+	}{
+		{"*", "example.c", true},
+		{"*", "methods/gauss.c", true},
+		{"*.c", "methods/gauss.c", true},
+		{"*.h", "methods/gauss.c", false},
+		{"/*.c", "example.c", true},
+		{"/*.c", "methods/gauss.c", false},
+		{"methods/", "methods/gauss.c", true},
+		{"methods", "methods/gauss.c", true},
+		{"methods", "src/methods/gauss.c", true},
+		{"/methods", "src/methods/gauss.c", false},
+		{"src/methods", "src/methods/gauss.c", true},
+		{"src/methods", "lib/src/methods/gauss.c", false},
+		{"src/**/gauss.c", "src/gauss.c", true},
+		{"src/**/gauss.c", "src/a/b/gauss.c", true},
+		{"src/**", "src/a/b/gauss.c", true},
+		{"**/b/*.c", "src/a/b/gauss.c", true},
+		{"src/*/gauss.c", "src/a/b/gauss.c", false},
+		{"gauss.?", "src/gauss.c", true},
+		{"/", "src/gauss.c", false},
+		{"[", "src/gauss.c", false},
+	}
+
+	for _, v := range cases {
+		if got := matchPathPattern(v.pattern, v.filename); got != v.expected {
+			t.Errorf("Case %s, %s: expected %v, got %v", v.pattern, v.filename, v.expected, got)
+		}
+	}
+}
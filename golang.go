@@ -1,28 +1,30 @@
 package main
 
 import (
-	"bufio"
 	"errors"
 	"io"
 	"strconv"
 	"strings"
 )
 
-func loadGoFile(fds FileDataSet, file io.Reader) error {
+func loadGoFile(fds FileDataSet, file io.Reader, opts loadOptions) error {
 	mode := ""
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		record := scanner.Text()
+	s := newRecordScanner(file, opts)
+	for s.scan() {
+		record := s.text()
 		if mode == "" {
 			if !strings.HasPrefix(record, "mode:") {
-				return errors.New("format error: missing mode record")
+				return s.errorf("format error: missing mode record")
 			}
 			mode = strings.TrimSpace(record[5:])
 		} else {
 			filename, start, end, _, hitCount, err := parseGoRecord(record)
 			if err != nil {
-				return err
+				if err := s.badRecord(err); err != nil {
+					return err
+				}
+				continue
 			}
 
 			currentData := fds.FileData(filename)
@@ -30,7 +32,7 @@ func loadGoFile(fds FileDataSet, file io.Reader) error {
 		}
 	}
 
-	return scanner.Err()
+	return s.finish()
 }
 
 // Position is a line/column pair used to specify a location in a source file.
@@ -22,7 +22,7 @@ func TestParserLoadGoFile(t *testing.T) {
 		t.Run(v.filename, func(t *testing.T) {
 			data := make(FileDataSet)
 
-			err := loadFile(data, filepath.Join("./testdata", v.filename))
+			err := loadFile(data, filepath.Join("./testdata", v.filename), loadOptions{})
 			if err != nil {
 				t.Fatalf("could not read file: %s", err)
 			}
@@ -55,7 +55,7 @@ func TestParserLoadGoFile(t *testing.T) {
 		}
 
 		// Drop the first byte
-		err = loadGoFile(make(FileDataSet), bytes.NewReader(data[1:]))
+		err = loadGoFile(make(FileDataSet), bytes.NewReader(data[1:]), loadOptions{})
 		if err == nil {
 			t.Errorf("expected an error")
 		}
@@ -70,6 +70,7 @@ func TestParserLoadGoFile(t *testing.T) {
 		ndx := bytes.IndexByte(data, ',')
 		err = loadGoFile(make(FileDataSet),
 			bytes.NewReader(append(data[:ndx], data[ndx+1:]...)),
+			loadOptions{},
 		)
 		if err == nil {
 			t.Errorf("expected an error")
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"path"
+)
+
+// covdirNode is a directory or a source file in the covdir report written by
+// grcov.  Directories have children, and source files have the coverage for
+// each line.
+type covdirNode struct {
+	Name     string                 `json:"name"`
+	Children map[string]*covdirNode `json:"children"`
+	// Hit counts for each line, starting with the first line.  Lines that
+	// do not contain code have a count of -1.
+	Coverage []int64 `json:"coverage"`
+}
+
+func loadCovdirNode(fds FileDataSet, filename string, node *covdirNode) {
+	if node.Children == nil {
+		currentData := fds.FileData(filename)
+		for i, v := range node.Coverage {
+			if v >= 0 {
+				currentData.AppendLineCountData(i+1, uint64(v))
+			}
+		}
+		return
+	}
+
+	for name, child := range node.Children {
+		loadCovdirNode(fds, path.Join(filename, name), child)
+	}
+}
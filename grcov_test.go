@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadJSONFileCovdir(t *testing.T) {
+	fds := make(FileDataSet)
+	err := loadFile(fds, "./testdata/example-grcov-covdir.json", loadOptions{})
+	if err != nil {
+		t.Fatalf("could not load file: %s", err)
+	}
+
+	expected := map[string]map[int]uint64{
+		"src/main.rs":      {2: 1, 3: 1, 5: 0, 6: 0, 8: 1},
+		"src/parse/mod.rs": {1: 4, 2: 4, 4: 2},
+	}
+	if len(fds) != len(expected) {
+		LogNE(t, "file count", len(expected), len(fds))
+	}
+	for name, lines := range expected {
+		data, ok := fds[name]
+		if !ok {
+			t.Errorf("missing file: %s", name)
+			continue
+		}
+		if !reflect.DeepEqual(data.LineData, lines) {
+			LogNE(t, "line data for "+name, lines, data.LineData)
+		}
+	}
+}
+
+func TestLoadJSONFile(t *testing.T) {
+	cases := []struct {
+		value string
+		files []string
+	}{
+		{`{"name":"","children":{"lib.rs":{"name":"lib.rs","coverage":[1,-1]}}}`, []string{"lib.rs"}},
+		{`{"name":"lib.rs","coverage":[1,-1]}`, []string{""}},
+		{`{"name":"","children":{}}`, []string{}},
+		{`{"type":"llvm.coverage.json.export","data":[]}`, []string{}},
+	}
+
+	for _, v := range cases {
+		t.Run(v.value, func(t *testing.T) {
+			fds := make(FileDataSet)
+			err := loadJSONFile(fds, strings.NewReader(v.value), loadOptions{})
+			if err != nil {
+				t.Fatalf("could not load file: %s", err)
+			}
+			if len(fds) != len(v.files) {
+				LogNE(t, "file count", len(v.files), len(fds))
+			}
+			for _, name := range v.files {
+				if _, ok := fds[name]; !ok {
+					t.Errorf("missing file: %q", name)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadGrcovLCovFile(t *testing.T) {
+	fds := make(FileDataSet)
+	err := loadFile(fds, "./testdata/example-grcov.lcov", loadOptions{})
+	if err != nil {
+		t.Fatalf("could not load file: %s", err)
+	}
+
+	data, ok := fds["src/main.rs"]
+	if !ok {
+		t.Fatalf("missing file")
+	}
+	expected := map[string]FuncData{
+		"example::main":  {StartLine: 2, HitCount: 1},
+		"example::usage": {StartLine: 5, HitCount: 0},
+	}
+	if !reflect.DeepEqual(data.FuncData, expected) {
+		LogNE(t, "functions", expected, data.FuncData)
+	}
+
+	// Dependencies are external, even with relative paths.
+	fds = filterExternalFileData(fds, false)
+	if len(fds) != 1 {
+		LogNE(t, "file count", 1, len(fds))
+	}
+}
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"strings"
+)
+
+// syntax describes the lexical rules for a language, as required to highlight
+// source listings.  The rules are not complete, but they only need to be good
+// enough to pick out keywords, literals, and comments.
+type syntax struct {
+	keywords      map[string]bool
+	types         map[string]bool
+	preprocessor  bool // Lines starting with '#' are directives.
+	nestedComment bool // Block comments can be nested.
+	multiString   bool // String literals can span multiple lines.
+	rawString     func(line string, pos int) (end int, terminator string, ok bool)
+	lifetimes     bool // A single quote can start a lifetime instead of a rune.
+}
+
+// Classes used for the tokens in highlighted source listings.
+const (
+	hlKeyword      = "hl-kw"
+	hlType         = "hl-ty"
+	hlString       = "hl-str"
+	hlNumber       = "hl-num"
+	hlComment      = "hl-com"
+	hlPreprocessor = "hl-pp"
+)
+
+func wordSet(words string) map[string]bool {
+	out := make(map[string]bool)
+	for _, v := range strings.Fields(words) {
+		out[v] = true
+	}
+	return out
+}
+
+const (
+	cKeywords = `auto break case const continue default do else enum extern
+		for goto if inline register restrict return sizeof static struct switch
+		typedef union volatile while _Alignas _Alignof _Atomic _Generic
+		_Noreturn _Static_assert _Thread_local`
+	cTypes = `void char short int long float double signed unsigned _Bool
+		_Complex bool size_t ssize_t ptrdiff_t int8_t int16_t int32_t int64_t
+		uint8_t uint16_t uint32_t uint64_t intptr_t uintptr_t FILE`
+	cppKeywords = cKeywords + ` alignas alignof and asm catch class
+		co_await co_return co_yield concept const_cast consteval constexpr
+		constinit decltype delete dynamic_cast explicit export false final
+		friend mutable namespace new noexcept not nullptr operator or override
+		private protected public reinterpret_cast requires static_assert
+		static_cast template this thread_local throw true try typeid typename
+		using virtual`
+	cppTypes   = cTypes + ` wchar_t char8_t char16_t char32_t auto`
+	goKeywords = `break case chan const continue default defer else fallthrough
+		for func go goto if import interface map package range return select
+		struct switch type var true false nil iota`
+	goTypes = `bool byte complex64 complex128 error float32 float64 int int8
+		int16 int32 int64 rune string uint uint8 uint16 uint32 uint64 uintptr`
+	rustKeywords = `as async await break const continue crate dyn else enum
+		extern false fn for if impl in let loop match mod move mut pub ref
+		return self Self static struct super trait true type union unsafe use
+		where while`
+	rustTypes = `bool char str i8 i16 i32 i64 i128 isize u8 u16 u32 u64 u128
+		usize f32 f64 String Vec Option Result Box Some None Ok Err`
+)
+
+var (
+	syntaxC = &syntax{
+		keywords:     wordSet(cKeywords),
+		types:        wordSet(cTypes),
+		preprocessor: true,
+	}
+	syntaxCPP = &syntax{
+		keywords:     wordSet(cppKeywords),
+		types:        wordSet(cppTypes),
+		preprocessor: true,
+		rawString:    cppRawString,
+	}
+	syntaxGo = &syntax{
+		keywords:  wordSet(goKeywords),
+		types:     wordSet(goTypes),
+		rawString: goRawString,
+	}
+	syntaxRust = &syntax{
+		keywords:      wordSet(rustKeywords),
+		types:         wordSet(rustTypes),
+		nestedComment: true,
+		multiString:   true,
+		rawString:     rustRawString,
+		lifetimes:     true,
+	}
+)
+
+// syntaxForFile selects the syntax based on the file's extension.  If the
+// language is not supported, the return is nil.
+func syntaxForFile(filename string) *syntax {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".c":
+		return syntaxC
+	case ".h", ".cc", ".cpp", ".cxx", ".c++", ".hh", ".hpp", ".hxx", ".h++", ".inl":
+		return syntaxCPP
+	case ".go":
+		return syntaxGo
+	case ".rs":
+		return syntaxRust
+	}
+	return nil
+}
+
+// goRawString checks for a raw string literal, which is delimited by
+// backticks.
+func goRawString(line string, pos int) (int, string, bool) {
+	if line[pos] != '`' {
+		return 0, "", false
+	}
+	return pos + 1, "`", true
+}
+
+// cppRawString checks for a raw string literal, such as R"delim(...)delim".
+// The literal can have an encoding prefix.
+func cppRawString(line string, pos int) (int, string, bool) {
+	i := pos
+	for _, prefix := range []string{"u8", "u", "U", "L"} {
+		if strings.HasPrefix(line[i:], prefix+`R"`) {
+			i += len(prefix)
+			break
+		}
+	}
+	if !strings.HasPrefix(line[i:], `R"`) {
+		return 0, "", false
+	}
+	open := strings.IndexByte(line[i+2:], '(')
+	if open < 0 || open > 16 {
+		return 0, "", false
+	}
+	delim := line[i+2 : i+2+open]
+	return i + 3 + open, ")" + delim + `"`, true
+}
+
+// rustRawString checks for a raw string literal, such as r#"..."#.  The
+// literal can have a byte prefix.
+func rustRawString(line string, pos int) (int, string, bool) {
+	i := pos
+	if strings.HasPrefix(line[i:], "br") {
+		i++
+	}
+	if line[i] != 'r' {
+		return 0, "", false
+	}
+	j := i + 1
+	for j < len(line) && line[j] == '#' {
+		j++
+	}
+	if j >= len(line) || line[j] != '"' {
+		return 0, "", false
+	}
+	return j + 1, `"` + line[i+1:j], true
+}
+
+// hlToken is a span of text within a line with the same highlighting.  An
+// empty class means that the text is not highlighted.
+type hlToken struct {
+	Class      string
+	Start, End int
+}
+
+// byteRange is a span of text within a line, with a hit count.
+type byteRange struct {
+	Start, End int
+	Count      uint64
+}
+
+// Modes for the highlighter that can extend past the end of a line.
+const (
+	hlModeNormal = iota
+	hlModeComment
+	hlModeString
+	hlModeRawString
+)
+
+// highlighter converts lines of source code to HTML.  Lines must be
+// highlighted in order, as block comments and some string literals can span
+// multiple lines.
+type highlighter struct {
+	syntax     *syntax
+	out        []hlToken
+	mode       int
+	depth      int    // Nesting depth for block comments.
+	terminator string // End of the current raw string literal.
+	directive  bool   // Continuation of a preprocessor directive.
+}
+
+func newHighlighter(filename string) *highlighter {
+	return &highlighter{syntax: syntaxForFile(filename)}
+}
+
+// tokens splits the line of source code into tokens.  Text that is not
+// highlighted is returned in tokens with an empty class.
+func (h *highlighter) tokens(line string) []hlToken {
+	h.out = h.out[:0]
+	if h.syntax == nil {
+		h.emit("", 0, len(line))
+		return h.out
+	}
+
+	pos := 0
+	if h.directive || (h.mode == hlModeNormal && h.syntax.preprocessor && strings.HasPrefix(strings.TrimSpace(line), "#")) {
+		pos = h.directiveToken(line)
+	}
+	for pos < len(line) {
+		switch h.mode {
+		case hlModeComment:
+			pos = h.comment(line, pos, pos)
+		case hlModeString:
+			pos = h.str(line, pos, pos, `"`)
+		case hlModeRawString:
+			pos = h.rawString(line, pos, pos)
+		default:
+			pos = h.token(line, pos)
+		}
+	}
+	return h.out
+}
+
+func (h *highlighter) emit(class string, start, end int) {
+	if start >= end {
+		return
+	}
+	// Merge adjacent text with the same class.
+	if n := len(h.out); n > 0 && h.out[n-1].Class == class && h.out[n-1].End == start {
+		h.out[n-1].End = end
+		return
+	}
+	h.out = append(h.out, hlToken{class, start, end})
+}
+
+// writeLine writes the HTML for the line of source code.  Any bytes within
+// the ranges in misses, which must be sorted and must not overlap, are also
+// marked as not executed.
+func (h *highlighter) writeLine(w *bufio.Writer, line string, misses []byteRange) {
+	// Ignore write errors.
+	// Since we are using a bufio.Writer, write errors will be reported when
+	// we flush.
+
+	tokens := h.tokens(line)
+	for len(misses) > 0 && misses[0].Start < len(line) {
+		miss := misses[0]
+		if miss.End > len(line) {
+			miss.End = len(line)
+		}
+		misses = misses[1:]
+
+		tokens = writeTokens(w, line, tokens, miss.Start)
+		_, _ = fmt.Fprintf(w, `<span class="region-miss" title="Region count: %d">`, miss.Count)
+		tokens = writeTokens(w, line, tokens, miss.End)
+		_, _ = w.WriteString(`</span>`)
+	}
+	writeTokens(w, line, tokens, len(line))
+}
+
+// writeTokens writes the tokens up to the byte offset end.  If a token
+// crosses end, it is split.  The remaining tokens are returned.
+func writeTokens(w *bufio.Writer, line string, tokens []hlToken, end int) []hlToken {
+	for len(tokens) > 0 && tokens[0].Start < end {
+		token := tokens[0]
+		if token.End > end {
+			tokens[0].Start = end
+			token.End = end
+		} else {
+			tokens = tokens[1:]
+		}
+
+		text := template.HTMLEscapeString(line[token.Start:token.End])
+		if token.Class == "" {
+			_, _ = w.WriteString(text)
+		} else {
+			_, _ = fmt.Fprintf(w, `<span class="%s">%s</span>`, token.Class, text)
+		}
+	}
+	return tokens
+}
+
+// directiveToken scans a preprocessor directive, up to any comment.  Directives
+// can be continued onto the next line with a trailing backslash.
+func (h *highlighter) directiveToken(line string) int {
+	end := len(line)
+	if ndx := strings.Index(line, "//"); ndx >= 0 {
+		end = ndx
+	}
+	if ndx := strings.Index(line[:end], "/*"); ndx >= 0 {
+		end = ndx
+	}
+	h.directive = end == len(line) && strings.HasSuffix(line, "\\")
+	h.emit(hlPreprocessor, 0, end)
+	return end
+}
+
+// comment scans a block comment.  The token starts at start, and the scan
+// for the end of the comment starts at pos.
+func (h *highlighter) comment(line string, start, pos int) int {
+	i := pos
+	for i < len(line) {
+		if strings.HasPrefix(line[i:], "*/") {
+			i += 2
+			h.depth--
+			if h.depth == 0 {
+				h.mode = hlModeNormal
+				break
+			}
+		} else if h.syntax.nestedComment && strings.HasPrefix(line[i:], "/*") {
+			i += 2
+			h.depth++
+		} else {
+			i++
+		}
+	}
+	h.emit(hlComment, start, i)
+	return i
+}
+
+// str scans a string or character literal.  The token starts at start, and
+// the scan for the closing quote starts at pos.
+func (h *highlighter) str(line string, start, pos int, quote string) int {
+	i := pos
+	for i < len(line) {
+		if line[i] == '\\' {
+			i += 2
+			continue
+		}
+		if strings.HasPrefix(line[i:], quote) {
+			i += len(quote)
+			h.mode = hlModeNormal
+			h.emit(hlString, start, i)
+			return i
+		}
+		i++
+	}
+	if i > len(line) {
+		i = len(line)
+	}
+	// The literal is not terminated.  Only some literals can span lines.
+	if quote == `"` && (h.syntax.multiString || strings.HasSuffix(line, "\\")) {
+		h.mode = hlModeString
+	} else {
+		h.mode = hlModeNormal
+	}
+	h.emit(hlString, start, i)
+	return i
+}
+
+func (h *highlighter) rawString(line string, start, pos int) int {
+	if ndx := strings.Index(line[pos:], h.terminator); ndx >= 0 {
+		end := pos + ndx + len(h.terminator)
+		h.mode = hlModeNormal
+		h.emit(hlString, start, end)
+		return end
+	}
+	h.emit(hlString, start, len(line))
+	return len(line)
+}
+
+func (h *highlighter) token(line string, pos int) int {
+	c := line[pos]
+
+	if strings.HasPrefix(line[pos:], "//") {
+		h.emit(hlComment, pos, len(line))
+		return len(line)
+	}
+	if strings.HasPrefix(line[pos:], "/*") {
+		h.mode = hlModeComment
+		h.depth = 1
+		return h.comment(line, pos, pos+2)
+	}
+	if h.syntax.rawString != nil {
+		if end, terminator, ok := h.syntax.rawString(line, pos); ok {
+			h.mode = hlModeRawString
+			h.terminator = terminator
+			return h.rawString(line, pos, end)
+		}
+	}
+	if c == '"' {
+		return h.str(line, pos, pos+1, `"`)
+	}
+	if c == '\'' {
+		if h.syntax.lifetimes && isLifetime(line, pos) {
+			end := scanWord(line, pos+1)
+			h.emit(hlType, pos, end)
+			return end
+		}
+		return h.str(line, pos, pos+1, `'`)
+	}
+	if isDigit(c) || (c == '.' && pos+1 < len(line) && isDigit(line[pos+1]) && (pos == 0 || line[pos-1] != '.')) {
+		end := scanNumber(line, pos)
+		h.emit(hlNumber, pos, end)
+		return end
+	}
+	if isWordStart(c) {
+		end := scanWord(line, pos)
+		word := line[pos:end]
+		if h.syntax.keywords[word] {
+			h.emit(hlKeyword, pos, end)
+		} else if h.syntax.types[word] {
+			h.emit(hlType, pos, end)
+		} else {
+			h.emit("", pos, end)
+		}
+		return end
+	}
+
+	// Copy any other text until the start of the next possible token.
+	end := pos + 1
+	for end < len(line) && !isTokenStart(line[end]) {
+		end++
+	}
+	h.emit("", pos, end)
+	return end
+}
+
+// isLifetime distinguishes a lifetime, such as 'a, from a character literal,
+// such as 'a'.
+func isLifetime(line string, pos int) bool {
+	if pos+1 >= len(line) || !isWordStart(line[pos+1]) {
+		return false
+	}
+	end := scanWord(line, pos+1)
+	return end >= len(line) || line[end] != '\''
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isWordStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isWordChar(c byte) bool {
+	return isWordStart(c) || isDigit(c)
+}
+
+func isTokenStart(c byte) bool {
+	return isWordChar(c) || c == '/' || c == '"' || c == '\'' || c == '`' || c == '.'
+}
+
+func scanWord(line string, pos int) int {
+	for pos < len(line) && isWordChar(line[pos]) {
+		pos++
+	}
+	return pos
+}
+
+// scanNumber finds the end of a numeric literal.  This includes prefixes,
+// digit separators, exponents, and suffixes, for all of the languages.
+func scanNumber(line string, pos int) int {
+	for pos < len(line) {
+		c := line[pos]
+		if c == '.' && pos+1 < len(line) && line[pos+1] == '.' {
+			// Range operator, such as 0..10.
+			break
+		} else if isWordChar(c) || c == '.' || c == '\'' {
+			pos++
+		} else if (c == '+' || c == '-') && pos > 0 && strings.ContainsRune("eEpP", rune(line[pos-1])) {
+			pos++
+		} else {
+			break
+		}
+	}
+	return pos
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func highlightLines(filename string, lines ...string) []string {
+	h := newHighlighter(filename)
+
+	out := make([]string, 0, len(lines))
+	for _, v := range lines {
+		buffer := bytes.NewBuffer(nil)
+		w := bufio.NewWriter(buffer)
+		h.writeLine(w, v, nil)
+		w.Flush()
+		out = append(out, buffer.String())
+	}
+	return out
+}
+
+func TestSyntaxForFile(t *testing.T) {
+	cases := []struct {
+		filename string
+		expected *syntax
+	}{
+		{"example.c", syntaxC},
+		{"src/example.h", syntaxCPP},
+		{"src/example.cpp", syntaxCPP},
+		{"src/example.CC", syntaxCPP},
+		{"main.go", syntaxGo},
+		{"src/lib.rs", syntaxRust},
+		{"README.md", nil},
+		{"Makefile", nil},
+	}
+
+	for _, v := range cases {
+		if got := syntaxForFile(v.filename); got != v.expected {
+			t.Errorf("Case %s: syntax does not match", v.filename)
+		}
+	}
+}
+
+func TestHighlighter(t *testing.T) {
+	cases := []struct {
+		filename string
+		lines    []string
+		expected []string
+	}{
+		{
+			"example.txt",
+			[]string{"int a < b;"},
+			[]string{"int a &lt; b;"},
+		},
+		{
+			"example.c",
+			[]string{"int main(void) {", "\treturn 0x10;", "}"},
+			[]string{
+				`<span class="hl-ty">int</span> main(<span class="hl-ty">void</span>) {`,
+				"\t" + `<span class="hl-kw">return</span> <span class="hl-num">0x10</span>;`,
+				"}",
+			},
+		},
+		{
+			"example.c",
+			[]string{`#include <stdio.h> // io`, `x = "a\"<" + 'c';`},
+			[]string{
+				`<span class="hl-pp">#include &lt;stdio.h&gt; </span><span class="hl-com">// io</span>`,
+				`x = <span class="hl-str">&#34;a\&#34;&lt;&#34;</span> + <span class="hl-str">&#39;c&#39;</span>;`,
+			},
+		},
+		{
+			"example.c",
+			[]string{"#define A \\", "  (1)", "x = 1; /* a", "b */ y"},
+			[]string{
+				`<span class="hl-pp">#define A \</span>`,
+				`<span class="hl-pp">  (1)</span>`,
+				`x = <span class="hl-num">1</span>; <span class="hl-com">/* a</span>`,
+				`<span class="hl-com">b */</span> y`,
+			},
+		},
+		{
+			"example.cpp",
+			[]string{`auto s = R"x(a`, `)" b)x";`},
+			[]string{
+				`<span class="hl-kw">auto</span> s = <span class="hl-str">R&#34;x(a</span>`,
+				`<span class="hl-str">)&#34; b)x&#34;</span>;`,
+			},
+		},
+		{
+			"main.go",
+			[]string{"var s = `a", "b` // c"},
+			[]string{
+				"<span class=\"hl-kw\">var</span> s = <span class=\"hl-str\">`a</span>",
+				"<span class=\"hl-str\">b`</span> <span class=\"hl-com\">// c</span>",
+			},
+		},
+		{
+			"lib.rs",
+			[]string{"/* a /* b */", "c */ fn f<'a>(x: &'a str) {", `let c = 'x'; for i in 0..10 {}`},
+			[]string{
+				`<span class="hl-com">/* a /* b */</span>`,
+				`<span class="hl-com">c */</span> <span class="hl-kw">fn</span> f&lt;<span class="hl-ty">&#39;a</span>&gt;(x: &amp;<span class="hl-ty">&#39;a</span> <span class="hl-ty">str</span>) {`,
+				`<span class="hl-kw">let</span> c = <span class="hl-str">&#39;x&#39;</span>; <span class="hl-kw">for</span> i <span class="hl-kw">in</span> <span class="hl-num">0</span>..<span class="hl-num">10</span> {}`,
+			},
+		},
+		{
+			"lib.rs",
+			[]string{`let s = r#"a"b`, `"#; let t = "c`, `d";`},
+			[]string{
+				`<span class="hl-kw">let</span> s = <span class="hl-str">r#&#34;a&#34;b</span>`,
+				`<span class="hl-str">&#34;#</span>; <span class="hl-kw">let</span> t = <span class="hl-str">&#34;c</span>`,
+				`<span class="hl-str">d&#34;</span>;`,
+			},
+		},
+	}
+
+	for i, v := range cases {
+		out := highlightLines(v.filename, v.lines...)
+		for j := range v.expected {
+			if out[j] != v.expected[j] {
+				t.Errorf("Case %d, line %d: expected %q, got %q", i, j+1, v.expected[j], out[j])
+			}
+		}
+	}
+}
+
+func TestHighlighterMisses(t *testing.T) {
+	cases := []struct {
+		line     string
+		misses   []byteRange
+		expected string
+	}{
+		{"if (a && b)", nil, `<span class="hl-kw">if</span> (a &amp;&amp; b)`},
+		{"if (a && b)", []byteRange{{9, 10, 0}}, `<span class="hl-kw">if</span> (a &amp;&amp; <span class="region-miss" title="Region count: 0">b</span>)`},
+		{"if (a && b)", []byteRange{{1, 5, 0}}, `<span class="hl-kw">i</span><span class="region-miss" title="Region count: 0"><span class="hl-kw">f</span> (a</span> &amp;&amp; b)`},
+		{"if (a && b)", []byteRange{{0, 2, 0}, {9, 100, 0}}, `<span class="region-miss" title="Region count: 0"><span class="hl-kw">if</span></span> (a &amp;&amp; <span class="region-miss" title="Region count: 0">b)</span>`},
+		{"x", []byteRange{{4, 8, 0}}, `x`},
+	}
+
+	for i, v := range cases {
+		buffer := bytes.NewBuffer(nil)
+		w := bufio.NewWriter(buffer)
+		newHighlighter("example.c").writeLine(w, v.line, v.misses)
+		w.Flush()
+		if out := buffer.String(); out != v.expected {
+			t.Errorf("Case %d: expected %q, got %q", i, v.expected, out)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"git.sr.ht/~rj/sgr"
+	"gitlab.com/stone.code/scov/internal/tool"
+)
+
+// HistoryRecord is the coverage summary for a single run.  Records use the
+// same format as the JSON report, so that past JSON reports can be imported.
+// Records are identified by their source ID and date.
+type HistoryRecord jsonReport
+
+// The history is stored as JSON lines, with one record per run, ordered by
+// date.
+
+func loadHistory(filename string) ([]HistoryRecord, error) {
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		// The first run will create the history.
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return readHistory(file)
+}
+
+func readHistory(r io.Reader) ([]HistoryRecord, error) {
+	out := []HistoryRecord(nil)
+
+	decoder := json.NewDecoder(r)
+	for {
+		record := HistoryRecord{}
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			return out, nil
+		} else if err != nil {
+			return nil, err
+		}
+		out = addHistoryRecord(out, record)
+	}
+}
+
+// saveHistory writes the history.  The history is first written to a
+// temporary file, so that a failure does not lose the previous runs.
+func saveHistory(filename string, records []HistoryRecord) error {
+	tmpname := filename + ".tmp"
+	err := createHistory(tmpname, records)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpname, filename)
+}
+
+func createHistory(filename string, records []HistoryRecord) error {
+	w, err := tool.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	err = writeHistory(w.File(), records)
+	w.Keep(err)
+	return err
+}
+
+func writeHistory(out io.Writer, records []HistoryRecord) error {
+	w := bufio.NewWriter(out)
+
+	encoder := json.NewEncoder(w)
+	for i := range records {
+		err := encoder.Encode(&records[i])
+		if err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// importHistoryRecord reads a JSON report, so that it can be added to the
+// history.
+func importHistoryRecord(filename string) (HistoryRecord, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return HistoryRecord{}, err
+	}
+	defer file.Close()
+
+	record := HistoryRecord{}
+	err = json.NewDecoder(file).Decode(&record)
+	if err != nil {
+		return HistoryRecord{}, fmt.Errorf("could not read %s: %s", filename, err)
+	}
+	if record.Date.IsZero() {
+		return HistoryRecord{}, fmt.Errorf("could not read %s: missing date", filename)
+	}
+	return record, nil
+}
+
+// addHistoryRecord adds the record to the history, keeping the records
+// ordered by date.  If there is already a record with the same source ID and
+// date, it is replaced.
+func addHistoryRecord(records []HistoryRecord, record HistoryRecord) []HistoryRecord {
+	ndx := sort.Search(len(records), func(i int) bool {
+		return !records[i].Date.Before(record.Date)
+	})
+	for i := ndx; i < len(records) && records[i].Date.Equal(record.Date); i++ {
+		if records[i].SrcID == record.SrcID {
+			records[i] = record
+			return records
+		}
+	}
+
+	records = append(records, HistoryRecord{})
+	copy(records[ndx+1:], records[ndx:])
+	records[ndx] = record
+	return records
+}
+
+// pruneHistory removes the oldest records, so that at most keep records
+// remain.  If keep is zero, all of the records are kept.
+func pruneHistory(records []HistoryRecord, keep int) []HistoryRecord {
+	if keep <= 0 || len(records) <= keep {
+		return records
+	}
+	return records[len(records)-keep:]
+}
+
+// updateHistory adds the report, and any imported JSON reports, to the
+// history.  The return is the updated history.
+func updateHistory(filename string, imports []string, report *Report, keep int) ([]HistoryRecord, error) {
+	records, err := loadHistory(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range imports {
+		record, err := importHistoryRecord(v)
+		if err != nil {
+			return nil, err
+		}
+		records = addHistoryRecord(records, record)
+	}
+	records = addHistoryRecord(records, HistoryRecord(newJSONReport(report)))
+	records = pruneHistory(records, keep)
+
+	err = saveHistory(filename, records)
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func createHistoryReport(filename string, report *Report) error {
+	w, err := tool.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	err = writeHistoryReport(w.File(), report)
+	w.Keep(err)
+	return err
+}
+
+func writeHistoryReport(writer io.Writer, report *Report) error {
+	w := bufio.NewWriter(writer)
+	f := sgr.NewFormatterForWriter(writer)
+
+	// Head
+	_, _ = fmt.Fprintf(w, "%v\n%v\n",
+		f.Bold(" Lines\t Funcs\tBranch\tRegion\tDate                \tSource ID"),
+		f.Dim("------\t------\t------\t------\t--------------------\t---------"))
+
+	// Body
+	for _, v := range report.History {
+		fmt.Fprintf(w, "%5.1f%%\t%5.1f%%\t%5.1f%%\t%5.1f%%\t%s\t%s\n",
+			Coverage(v.LCoverage),
+			Coverage(v.FCoverage),
+			Coverage(v.BCoverage),
+			Coverage(v.RCoverage),
+			v.Date.UTC().Format("2006-01-02 15:04:05Z"),
+			v.SrcID)
+	}
+
+	return w.Flush()
+}
+
+// Dimensions of the trend chart, in SVG user units.
+const (
+	trendWidth  = 600
+	trendHeight = 160
+	trendLeft   = 40
+	trendTop    = 10
+	trendBottom = 20
+	trendRight  = 10
+)
+
+// trendSeries describes one of the lines in the trend chart.
+type trendSeries struct {
+	Name     string
+	Color    string
+	Coverage func(HistoryRecord) jsonCoverage
+}
+
+var trendSeriesList = []trendSeries{
+	{"Lines", "#1f77b4", func(r HistoryRecord) jsonCoverage { return r.LCoverage }},
+	{"Functions", "#2ca02c", func(r HistoryRecord) jsonCoverage { return r.FCoverage }},
+	{"Branches", "#ff7f0e", func(r HistoryRecord) jsonCoverage { return r.BCoverage }},
+	{"Regions", "#9467bd", func(r HistoryRecord) jsonCoverage { return r.RCoverage }},
+}
+
+// trendChart renders an SVG chart with the coverage for the runs in the
+// history.  The chart does not require any scripting.  A series is only
+// included if the most recent run has data for that metric.
+func trendChart(records []HistoryRecord) template.HTML {
+	if len(records) == 0 {
+		return ""
+	}
+
+	w := bytes.Buffer{}
+	fmt.Fprintf(&w, `<svg class="trend" viewBox="0 0 %d %d" role="img" aria-label="Coverage trend">`, trendWidth, trendHeight)
+
+	// Axes
+	plotWidth := float32(trendWidth - trendLeft - trendRight)
+	plotHeight := float32(trendHeight - trendTop - trendBottom)
+	for _, v := range []int{0, 50, 100} {
+		y := trendTop + plotHeight*float32(100-v)/100
+		fmt.Fprintf(&w, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#cbcbcb"/>`, trendLeft, y, trendWidth-trendRight, y)
+		fmt.Fprintf(&w, `<text x="%d" y="%.1f" font-size="10" text-anchor="end" dominant-baseline="middle">%d%%</text>`, trendLeft-4, y, v)
+	}
+
+	x := func(i int) float32 {
+		if len(records) == 1 {
+			return trendLeft + plotWidth/2
+		}
+		return trendLeft + plotWidth*float32(i)/float32(len(records)-1)
+	}
+	y := func(c Coverage) float32 {
+		return trendTop + plotHeight*(100-c.P())/100
+	}
+
+	last := records[len(records)-1]
+	legend := 0
+	for _, series := range trendSeriesList {
+		if !Coverage(series.Coverage(last)).Valid() {
+			continue
+		}
+
+		points := []string(nil)
+		for i, v := range records {
+			if c := Coverage(series.Coverage(v)); c.Valid() {
+				points = append(points, fmt.Sprintf("%.1f,%.1f", x(i), y(c)))
+			}
+		}
+		fmt.Fprintf(&w, `<polyline fill="none" stroke="%s" stroke-width="2" points="%s"/>`, series.Color, strings.Join(points, " "))
+		for i, v := range records {
+			if c := Coverage(series.Coverage(v)); c.Valid() {
+				fmt.Fprintf(&w, `<circle cx="%.1f" cy="%.1f" r="3" fill="%s"><title>%s: %.1f%% (%s)</title></circle>`,
+					x(i), y(c), series.Color, series.Name, c.P(), template.HTMLEscapeString(historyLabel(v)))
+			}
+		}
+
+		fmt.Fprintf(&w, `<text x="%d" y="%d" font-size="10" fill="%s">%s</text>`,
+			trendLeft+8+legend*70, trendHeight-6, series.Color, series.Name)
+		legend++
+	}
+
+	w.WriteString(`</svg>`)
+	return template.HTML(w.String())
+}
+
+// historyLabel describes the run, for use in the trend chart.
+func historyLabel(record HistoryRecord) string {
+	label := record.Date.UTC().Format("2006-01-02 15:04")
+	if record.SrcID != "" {
+		label += ", " + record.SrcID
+	}
+	return label
+}
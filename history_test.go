@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func testHistoryRecord(day int, srcid string, hits int) HistoryRecord {
+	return HistoryRecord{
+		Title:     "SCov",
+		SrcID:     srcid,
+		Date:      time.Date(2006, 01, day, 15, 4, 5, 0, time.UTC),
+		LCoverage: jsonCoverage{hits, 100},
+		FCoverage: jsonCoverage{hits / 10, 10},
+		Files:     []jsonFile{},
+	}
+}
+
+func TestAddHistoryRecord(t *testing.T) {
+	records := []HistoryRecord(nil)
+	records = addHistoryRecord(records, testHistoryRecord(3, "c", 30))
+	records = addHistoryRecord(records, testHistoryRecord(1, "a", 10))
+	records = addHistoryRecord(records, testHistoryRecord(2, "b", 20))
+	records = addHistoryRecord(records, testHistoryRecord(2, "b2", 25))
+	// Same source ID and date, so this replaces an existing record.
+	records = addHistoryRecord(records, testHistoryRecord(2, "b", 22))
+
+	expected := []string{"a", "b2", "b", "c"}
+	if len(records) != len(expected) {
+		t.Fatalf("unexpected number of records: %d", len(records))
+	}
+	for i, v := range expected {
+		if records[i].SrcID != v {
+			LogNE(t, "source ID "+strconv.Itoa(i), v, records[i].SrcID)
+		}
+	}
+	if records[2].LCoverage.Hits != 22 {
+		LogNE(t, "hits", 22, records[2].LCoverage.Hits)
+	}
+}
+
+func TestPruneHistory(t *testing.T) {
+	records := []HistoryRecord{
+		testHistoryRecord(1, "a", 10),
+		testHistoryRecord(2, "b", 20),
+		testHistoryRecord(3, "c", 30),
+	}
+
+	cases := []struct {
+		keep     int
+		expected int
+	}{
+		{0, 3},
+		{1, 1},
+		{2, 2},
+		{5, 3},
+	}
+
+	for _, v := range cases {
+		out := pruneHistory(records, v.keep)
+		if len(out) != v.expected {
+			LogNE(t, "records", v.expected, len(out))
+		} else if out[len(out)-1].SrcID != "c" {
+			t.Errorf("most recent record was pruned")
+		}
+	}
+}
+
+func TestReadHistory(t *testing.T) {
+	records := []HistoryRecord{
+		testHistoryRecord(1, "a", 10),
+		testHistoryRecord(2, "b", 20),
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	err := writeHistory(buffer, records)
+	if err != nil {
+		t.Fatalf("could not write history: %s", err)
+	}
+	if lines := bytes.Count(buffer.Bytes(), []byte("\n")); lines != 2 {
+		LogNE(t, "lines", 2, lines)
+	}
+
+	out, err := readHistory(buffer)
+	if err != nil {
+		t.Fatalf("could not read history: %s", err)
+	}
+	if !reflect.DeepEqual(records, out) {
+		LogNE(t, "records", records, out)
+	}
+
+	_, err = readHistory(bytes.NewBufferString("{\n"))
+	if err == nil {
+		t.Errorf("unexpected success")
+	}
+}
+
+func TestUpdateHistory(t *testing.T) {
+	dir, cleanup := TempDirectory(t)
+	defer cleanup()
+
+	data := make(map[string]*FileData)
+	err := loadFile(data, "./testdata/example-7.4.0-branches", loadOptions{})
+	if err != nil {
+		t.Fatalf("could not read file: %s", err)
+	}
+	report := NewTestReport()
+	report.CollectStatistics(data)
+
+	// Create a JSON report from an earlier run to import.
+	earlier := *report
+	earlier.SrcID = "v1.0"
+	earlier.Date = report.Date.AddDate(0, 0, -1)
+	jsonfile := filepath.Join(dir, "earlier.json")
+	err = createJSONReport(jsonfile, &earlier)
+	if err != nil {
+		t.Fatalf("could not write JSON report: %s", err)
+	}
+
+	filename := filepath.Join(dir, "history.jsonl")
+	for i := 0; i < 3; i++ {
+		report.Date = report.Date.Add(time.Hour)
+		records, err := updateHistory(filename, []string{jsonfile}, report, 3)
+		if err != nil {
+			t.Fatalf("could not update history: %s", err)
+		}
+		if expected := i + 2; expected <= 3 && len(records) != expected {
+			LogNE(t, "records", expected, len(records))
+		}
+	}
+
+	records, err := loadHistory(filename)
+	if err != nil {
+		t.Fatalf("could not load history: %s", err)
+	}
+	if len(records) != 3 {
+		LogNE(t, "records", 3, len(records))
+	}
+	for _, v := range records {
+		if v.SrcID == "v1.0" {
+			t.Errorf("oldest record was not pruned")
+		}
+	}
+	if records[2].Date != report.Date {
+		LogNE(t, "date", report.Date, records[2].Date)
+	}
+
+	_, err = updateHistory(filename, []string{filepath.Join(dir, "missing.json")}, report, 0)
+	if err == nil {
+		t.Errorf("unexpected success")
+	}
+}
+
+func TestLoadHistoryMissing(t *testing.T) {
+	records, err := loadHistory("./testdata/missing.jsonl")
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if len(records) != 0 {
+		LogNE(t, "records", 0, len(records))
+	}
+}
+
+func TestWriteHistoryReport(t *testing.T) {
+	report := NewTestReport()
+	report.History = []HistoryRecord{
+		testHistoryRecord(1, "v1.0", 72),
+		testHistoryRecord(2, "", 80),
+		testHistoryRecord(3, "v1.1", 91),
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	err := writeHistoryReport(buffer, report)
+	if err != nil {
+		t.Fatalf("could not write output: %s", err)
+	}
+	checkGolden(t, buffer.Bytes())
+}
+
+func TestTrendChart(t *testing.T) {
+	cases := []struct {
+		name    string
+		records []HistoryRecord
+	}{
+		{"empty", nil},
+		{"single", []HistoryRecord{testHistoryRecord(1, "v1.0", 72)}},
+		{"multiple", []HistoryRecord{
+			testHistoryRecord(1, "v1.0", 72),
+			testHistoryRecord(2, "<b>", 80),
+			testHistoryRecord(3, "v1.1", 91),
+		}},
+	}
+
+	for _, v := range cases {
+		v := v
+		t.Run(v.name, func(t *testing.T) {
+			checkGolden(t, []byte(trendChart(v.records)))
+		})
+	}
+}
+
+func checkGolden(t *testing.T, out []byte) {
+	if *update {
+		err := ioutil.WriteFile(filepath.Join("./testdata", t.Name()+".golden"), out, 0600)
+		if err != nil {
+			t.Fatalf("could not write golden file: %s", err)
+		}
+	}
+
+	expected, err := ioutil.ReadFile(filepath.Join("./testdata", t.Name()+".golden"))
+	if err != nil {
+		t.Fatalf("could not read golden file: %s", err)
+	}
+	if !bytes.Equal(expected, out) {
+		t.Errorf("output does not match golden file")
+	}
+}
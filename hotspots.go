@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"git.sr.ht/~rj/sgr"
+	"gitlab.com/stone.code/scov/internal/tool"
+)
+
+// Number of levels used to colour lines in the heatmap.
+const heatLevels = 5
+
+// HotLine identifies a line with a high hit count.  Partial is set if some
+// of the code on the line was not executed.
+type HotLine struct {
+	Filename string
+	Line     int
+	HitCount uint64
+	Partial  bool
+}
+
+// hotterLine provides the order for the hottest lines.  Lines are sorted by
+// decreasing hit count, but the filename and line number break ties so that
+// the order does not depend on the order in which the files were loaded.
+func hotterLine(a, b HotLine) bool {
+	if a.HitCount != b.HitCount {
+		return a.HitCount > b.HitCount
+	}
+	if a.Filename != b.Filename {
+		return a.Filename < b.Filename
+	}
+	return a.Line < b.Line
+}
+
+// addHotLines merges the executed lines from the file into the list of the
+// hottest lines, which is limited to at most limit entries.
+func addHotLines(hot []HotLine, filename string, data *FileData, limit int) []HotLine {
+	if limit <= 0 {
+		return hot
+	}
+
+	for lineNo, hitCount := range data.LineData {
+		if hitCount == 0 {
+			continue
+		}
+		v := HotLine{filename, lineNo, hitCount, data.PartialLine(lineNo)}
+		if len(hot) == limit && !hotterLine(v, hot[limit-1]) {
+			continue
+		}
+
+		ndx := sort.Search(len(hot), func(i int) bool {
+			return hotterLine(v, hot[i])
+		})
+		if len(hot) < limit {
+			hot = append(hot, HotLine{})
+		}
+		copy(hot[ndx+1:], hot[ndx:])
+		hot[ndx] = v
+	}
+	return hot
+}
+
+// HotFuncs returns the functions with the highest hit counts.  The number of
+// functions is limited by the report's Hotspots.
+func (r *Report) HotFuncs() []FuncStatistics {
+	if r.Hotspots <= 0 {
+		return nil
+	}
+
+	out := []FuncStatistics(nil)
+	for _, v := range r.Funcs {
+		if v.HitCount > 0 {
+			out = append(out, v)
+		}
+	}
+
+	// Ties are already sorted by name and filename.
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].HitCount > out[j].HitCount
+	})
+	if len(out) > r.Hotspots {
+		out = out[:r.Hotspots]
+	}
+	return out
+}
+
+// heatLevel returns the colour for a line in the heatmap, using a logarithmic
+// scale for the hit count.  Lines that were not executed are not coloured,
+// and have level zero.  Otherwise, the level is between 1 and heatLevels.
+func heatLevel(hitCount, maxCount uint64) int {
+	if hitCount == 0 || maxCount == 0 {
+		return 0
+	}
+	if hitCount >= maxCount {
+		return heatLevels
+	}
+
+	scale := math.Log1p(float64(hitCount)) / math.Log1p(float64(maxCount))
+	return 1 + int(scale*(heatLevels-1))
+}
+
+func createHotspotsReport(filename string, report *Report) error {
+	w, err := tool.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	err = writeHotspotsReport(w.File(), report)
+	w.Keep(err)
+	return err
+}
+
+func writeHotspotsReport(writer io.Writer, report *Report) error {
+	w := bufio.NewWriter(writer)
+	f := sgr.NewFormatterForWriter(writer)
+
+	fmt.Fprintf(w, "%v\n%v\n",
+		f.Bold("    Hits\tLine"),
+		f.Dim("--------\t----"))
+	for _, v := range report.HotLines {
+		// Like gcov, partially executed lines are marked with an asterisk.
+		if v.Partial {
+			fmt.Fprintf(w, "%7d*\t%s:%d\n", v.HitCount, v.Filename, v.Line)
+		} else {
+			fmt.Fprintf(w, "%8d\t%s:%d\n", v.HitCount, v.Filename, v.Line)
+		}
+	}
+
+	if funcs := report.HotFuncs(); len(funcs) > 0 {
+		fmt.Fprintf(w, "\n%v\n%v\n",
+			f.Bold("    Hits\tFunction"),
+			f.Dim("--------\t--------"))
+		for _, v := range funcs {
+			fmt.Fprintf(w, "%8d\t%s", v.HitCount, v.Name)
+			if v.StartLine > 0 {
+				fmt.Fprintf(w, " (%s:%d)\n", v.Filename, v.StartLine)
+			} else {
+				fmt.Fprintf(w, " (%s)\n", v.Filename)
+			}
+		}
+	}
+
+	return w.Flush()
+}
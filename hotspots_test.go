@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestAddHotLines(t *testing.T) {
+	cases := []struct {
+		limit    int
+		expected []HotLine
+	}{
+		{0, nil},
+		{1, []HotLine{{"a.c", 4, 9, false}}},
+		{3, []HotLine{{"a.c", 4, 9, false}, {"a.c", 1, 5, true}, {"b.c", 2, 5, false}}},
+		{10, []HotLine{{"a.c", 4, 9, false}, {"a.c", 1, 5, true}, {"b.c", 2, 5, false}, {"a.c", 2, 1, false}}},
+	}
+
+	a := NewFileData("a.c")
+	a.LineData = map[int]uint64{1: 5, 2: 1, 3: 0, 4: 9}
+	a.AppendPartialLine(1)
+	a.AppendPartialLine(3)
+	b := NewFileData("b.c")
+	b.LineData = map[int]uint64{1: 0, 2: 5}
+
+	for _, v := range cases {
+		t.Run(strconv.Itoa(v.limit), func(t *testing.T) {
+			out := addHotLines(nil, "b.c", b, v.limit)
+			out = addHotLines(out, "a.c", a, v.limit)
+			if !reflect.DeepEqual(out, v.expected) {
+				LogNE(t, "hot lines", v.expected, out)
+			}
+		})
+	}
+}
+
+func TestHeatLevel(t *testing.T) {
+	cases := []struct {
+		hitCount uint64
+		maxCount uint64
+		expected int
+	}{
+		{0, 0, 0},
+		{0, 100, 0},
+		{1, 1, 5},
+		{1, 1000000, 1},
+		{1000, 1000000, 3},
+		{999999, 1000000, 4},
+		{1000000, 1000000, 5},
+	}
+
+	for _, v := range cases {
+		if out := heatLevel(v.hitCount, v.maxCount); out != v.expected {
+			LogNE(t, "heat level for "+strconv.FormatUint(v.hitCount, 10), v.expected, out)
+		}
+	}
+}
+
+func TestReport_HotFuncs(t *testing.T) {
+	report := NewTestReport()
+	report.Hotspots = 2
+	report.Funcs = []FuncStatistics{
+		{Name: "a", Filename: "a.c", HitCount: 1},
+		{Name: "b", Filename: "a.c", HitCount: 0},
+		{Name: "c", Filename: "a.c", HitCount: 7},
+		{Name: "d", Filename: "b.c", HitCount: 7},
+	}
+
+	out := report.HotFuncs()
+	if len(out) != 2 {
+		t.Fatalf("unexpected number of functions: %d", len(out))
+	}
+	if out[0].Name != "c" || out[1].Name != "d" {
+		t.Errorf("unexpected functions: %s, %s", out[0].Name, out[1].Name)
+	}
+
+	for _, limit := range []int{0, -1} {
+		report.Hotspots = limit
+		if out := report.HotFuncs(); len(out) != 0 {
+			t.Errorf("unexpected functions for limit %d: %v", limit, out)
+		}
+	}
+}
+
+func TestWriteHotspotsReport(t *testing.T) {
+	data := make(map[string]*FileData)
+	err := loadFile(data, "./testdata/example-7.4.0-branches", loadOptions{})
+	if err != nil {
+		t.Fatalf("could not read file: %s", err)
+	}
+
+	report := NewTestReport()
+	report.Hotspots = 10
+	report.CollectStatistics(data)
+
+	buffer := bytes.NewBuffer(nil)
+	err = writeHotspotsReport(buffer, report)
+	if err != nil {
+		t.Fatalf("could not write output: %s", err)
+	}
+
+	if *update {
+		err := ioutil.WriteFile(filepath.Join("./testdata", t.Name()+".golden"), buffer.Bytes(), 0600)
+		if err != nil {
+			t.Fatalf("could not write golden file: %s", err)
+		}
+	}
+
+	expected, err := ioutil.ReadFile(filepath.Join("./testdata", t.Name()+".golden"))
+	if err != nil {
+		t.Fatalf("could not read golden file: %s", err)
+	}
+	if !bytes.Equal(expected, buffer.Bytes()) {
+		t.Errorf("output does not match golden file")
+	}
+}
+
+func TestCreateHotspotsReportFail(t *testing.T) {
+	report := NewTestReport()
+	report.CollectStatistics(map[string]*FileData{})
+
+	err := createHotspotsReport(".", report)
+	if err == nil {
+		t.Errorf("unexpected success")
+	}
+}
@@ -5,14 +5,21 @@ import (
 	"fmt"
 	"html/template"
 	"io"
+	"math"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 
 	"gitlab.com/stone.code/scov/internal/tool"
 )
 
 var (
-	tmpl1 = template.New("html").Funcs(template.FuncMap{"htmlSafe": htmlSafe})
+	tmpl1 = template.New("html").Funcs(template.FuncMap{"htmlSafe": htmlSafe, "base": path.Base, "rate": rateCoverage, "add": addInts, "sourceURL": sourceURL, "reportPath": reportPath})
 	_     = template.Must(tmpl1.New("sparkbar").Parse(
 		`<div class="sparkbar">{{if gt .P 99.0}}<div class="fill {{.Rating}}" style="width:100%"></div>{{else}}<div class="fill {{.Rating}}" style="width:{{printf "%.1f" .P}}%"></div><div class="empty" style="width:{{printf "%.1f" .Q}}%"></div>{{end}}</div>`,
 	))
@@ -23,13 +30,7 @@ var (
 <title>{{.Title}}</title>
 <meta name="description" content="Code coverage report">
 <meta name="generator" content="https://gitlab.com/stone.code/scov">
-<link rel="stylesheet" href="https://unpkg.com/purecss@1.0.0/build/pure-min.css" integrity="sha384-nn4HPE8lTHyVtfCBi5yW9d20FjT8BJwUXyWZT9InLYax14RDjBj46LmSztkmNP9w" crossorigin="anonymous">
-{{htmlSafe "<!--[if lte IE 8]>"}}
-	<link rel="stylesheet" href="https://unpkg.com/purecss@1.0.0/build/grids-responsive-old-ie-min.css">
-{{htmlSafe "<![endif]-->"}}
-{{htmlSafe "<!--[if gt IE 8]><!-->"}}
-	<link rel="stylesheet" href="https://unpkg.com/purecss@1.0.0/build/grids-responsive-min.css">
-{{htmlSafe "<!--<![endif]-->"}}
+<link rel="stylesheet" href="{{.Root}}style.css">
 {{ if .ProjectURL -}}
 <link rel="project" href="{{.ProjectURL}}">
 {{ end -}}
@@ -43,16 +44,39 @@ table { margin-bottom: 1em; }
 .coverage td:nth-child(4), .coverage th:nth-child(4) { text-align:center; }
 .sparkbar { border: 1px solid black; border-radius:1px; min-width:50px; height:1em; }
 .sparkbar .fill { display: inline-block; height: 100%; }
-.sparkbar .high { background-color:lightgreen; }
-.sparkbar .medium { background-color:yellow; }
-.sparkbar .low { background-color:red; }
-.sparkbar .empty { display: inline-block; height: 1em; background-color: white; }
+{{.Ratings.CSS}}.sparkbar .empty { display: inline-block; height: 1em; background-color: white; }
 {{ if .Source -}}
 .source { font-family: monospace; width:100%; margin:0; }
 .source th { padding: .1em .5em; text-align:left; border-bottom: 1px solid black; }
 .source td { padding: .1em .5em; white-space: pre; }
 .source .hit { background:lightblue; }
 .source .miss { background:LightCoral; }
+{{ if .HeatMap -}}
+.source tr.heat-1, .heat-legend .heat-1 { background:#fee6ce; }
+.source tr.heat-2, .heat-legend .heat-2 { background:#fdd0a2; }
+.source tr.heat-3, .heat-legend .heat-3 { background:#fdae6b; }
+.source tr.heat-4, .heat-legend .heat-4 { background:#fd8d3c; }
+.source tr.heat-5, .heat-legend .heat-5 { background:#e6550d; }
+.heat-legend span { display:inline-block; width:1.5em; height:1em; vertical-align:middle; border:1px solid #cbcbcb; }
+{{ end -}}
+.source tr.partial td:nth-child(2) { background:#ffd27f; }
+.source tr:target td { outline: 2px solid #ff8c00; }
+.source-nav { margin-bottom: .5em; }
+.source-nav .pure-button { margin-right: .5em; }
+.minimap { position: fixed; top: 0; right: 0; width: 12px; height: 100%; background: #f0f0f0; border-left: 1px solid #cbcbcb; }
+.minimap a { position: absolute; left: 0; width: 100%; min-height: 2px; }
+.minimap .miss { background: #b22222; }
+.minimap .partial { background: #ff8c00; }
+.source .region-miss { background:LightCoral; outline:1px solid #b22222; }
+.source details { position: relative; }
+.source summary { cursor: pointer; }
+.source ul.branches { position: absolute; z-index: 1; margin: 0; padding: .5em 1em .5em 2em; background: white; border: 1px solid #cbcbcb; }
+.hl-kw { color:#1a1a80; font-weight:bold; }
+.hl-ty { color:#00582b; }
+.hl-str { color:#7a3000; }
+.hl-num { color:#5c1f66; }
+.hl-com { color:#4a4a4a; font-style:italic; }
+.hl-pp { color:#6b4700; }
 .source td:nth-child(1), .source th:nth-child(1) { background:PaleGoldenrod; text-align:right; }
 {{ if .BCoverage.Valid -}}
 .source td:nth-child(2), .source th:nth-child(2) { background:#f2edbf; text-align:right; }
@@ -66,6 +90,11 @@ th .reveal { float:right; transition: opacity 0.5s; opacity: 0.1; }
 th .reveal .pure-button { padding: 0 0.5em; }
 th:hover .reveal { opacity: 1; }
 {{ end -}}
+.breadcrumbs { margin-bottom: 1em; }
+.missing { color: #b22222; }
+{{ if .Trend -}}
+.trend { width:100%; max-height:20em; }
+{{ end -}}
 footer { border-top: 1px solid rgb(203, 203, 203); margin-top: 1em; background: #e0e0e0; padding: .5em 1em; }
 @media screen and (min-width: 48em) {
 	.pure-gutter-md > div { box-sizing: border-box; padding: 0 0.5em; }
@@ -77,7 +106,7 @@ footer { border-top: 1px solid rgb(203, 203, 203); margin-top: 1em; background:
 }
 </style>
 {{ if .Script -}}
-<script src="index.js" ></script>
+<script src="{{.Root}}index.js" ></script>
 {{ end -}}
 </head>
 `,
@@ -85,6 +114,12 @@ footer { border-top: 1px solid rgb(203, 203, 203); margin-top: 1em; background:
 	_ = template.Must(tmpl1.New("h1").Parse(
 		`<div class="pure-g"><h1 class="pure-u">{{.Title}}</h1></div>`,
 	))
+	_ = template.Must(tmpl1.New("breadcrumbs").Parse(
+		`<div class="pure-g"><nav class="pure-u breadcrumbs">
+{{- range $ndx, $data := .Breadcrumbs}}{{if $ndx}} &rsaquo; {{end}}<a href="{{.URL}}">{{.Name}}</a>{{end -}}
+{{if .Filename}} &rsaquo; {{base .Filename}}{{end -}}
+</nav></div>`,
+	))
 	_ = template.Must(tmpl1.New("coverageRow").Parse(
 		`<td>{{.Hits}}</td><td>{{.Total}}</td><td>{{printf "%.1f" .P}}%</td>`,
 	))
@@ -125,6 +160,26 @@ footer { border-top: 1px solid rgb(203, 203, 203); margin-top: 1em; background:
 </table>
 {{- else -}}
 <p>Date: {{.Date}}</p>
+{{ end -}}`,
+	))
+	_ = template.Must(tmpl1.New("groupTable").Parse(
+		`{{ if .Groups -}}
+<div class="pure-g"><div class="pure-u-1">
+<h2>{{.Title}}</h2>
+<table class="pure-table pure-table-bordered table-md" style="width:100%">
+<thead><tr><th{{if .Script}} data-sort="text"{{end}}>{{.Heading}}</th><th{{if .Script}} data-sort="perc"{{end}}>Files</th><th colspan="3"{{if .Script}} data-sort="perc"{{end}}>Line Coverage</th>{{if .UseFunc}}<th colspan="3"{{if .Script}} data-sort="perc"{{end}}>Function Coverage</th>{{end}}{{if .UseBranch}}<th colspan="3"{{if .Script}} data-sort="perc"{{end}}>Branch Coverage</th>{{end}}{{if .UseRegion}}<th colspan="3"{{if .Script}} data-sort="perc"{{end}}>Region Coverage</th>{{end}}{{if .UseThreshold}}<th>Threshold</th>{{end}}</tr></thead>
+<tbody>
+{{range $ndx, $data := .Groups -}}
+<tr><td>{{.Name}}</td><td>{{.FileCount}}</td>{{template "coverageDetail" (rate $.Ratings.Lines .LCoverage)}}
+{{- if $.UseFunc -}}{{ template "coverageDetail" (rate $.Ratings.Funcs .FCoverage) }}{{- end -}}
+{{- if $.UseBranch -}}{{ template "coverageDetail" (rate $.Ratings.Branches .BCoverage) }}{{- end -}}
+{{- if $.UseRegion -}}{{ template "coverageDetail" (rate $.Ratings.Regions .RCoverage) }}{{- end -}}
+{{- if $.UseThreshold -}}<td>{{if .HasThreshold}}{{printf "%.1f" .Threshold}}%{{if .BelowThreshold}} (failed){{end}}{{end}}</td>{{- end -}}
+</tr>
+{{end -}}
+</tbody>
+</table>
+</div></div>
 {{ end -}}`,
 	))
 	_ = template.Must(tmpl1.New("footer").Parse(
@@ -143,19 +198,44 @@ footer { border-top: 1px solid rgb(203, 203, 203); margin-top: 1em; background:
 <h2>Coverage Summary</h2>
 {{ template "coverage" . -}}
 </div></div>
+{{ if .Trend -}}
 <div class="pure-g"><div class="pure-u-1">
-<h2>By File</h2>
-<table class="pure-table pure-table-bordered table-md" style="width:100%">
+<h2>Trend</h2>
+{{.Trend}}
+</div></div>
+{{ end -}}
 {{ $useFunc := .FCoverage.Valid -}}
 {{ $useBranch := .BCoverage.Valid -}}
 {{ $useRegion := .RCoverage.Valid -}}
+{{ if .Dirs -}}
+<div class="pure-g"><div class="pure-u-1">
+<h2>By Directory</h2>
+<table class="pure-table pure-table-bordered table-md" style="width:100%">
+<thead><tr><th{{if .Script}} data-sort="text"{{end}}>Directory</th><th colspan="3"{{if .Script}} data-sort="perc"{{end}}>Line Coverage</th>{{if $useFunc}}<th colspan="3"{{if .Script}} data-sort="perc"{{end}}>Function Coverage</th>{{end}}{{if $useBranch}}<th colspan="3"{{if .Script}} data-sort="perc"{{end}}>Branch Coverage</th>{{end}}{{if $useRegion}}<th colspan="3"{{if .Script}} data-sort="perc"{{end}}>Region Coverage</th>{{end}}</tr></thead>
+<tbody>
+{{range $ndx, $data := .Dirs -}}
+<tr><td><a href="{{reportPath .Name}}/index.html">{{.Name}}/</a></td>{{template "coverageDetail" (rate $.Ratings.Lines .LCoverage)}}
+{{- if $useFunc -}}{{ template "coverageDetail" (rate $.Ratings.Funcs .FCoverage) }}{{- end -}}
+{{- if $useBranch -}}{{ template "coverageDetail" (rate $.Ratings.Branches .BCoverage) }}{{- end -}}
+{{- if $useRegion -}}{{ template "coverageDetail" (rate $.Ratings.Regions .RCoverage) }}{{- end -}}
+</tr>
+{{end -}}
+</tbody>
+</table>
+</div></div>
+{{ end -}}
+{{ template "groupTable" .Components -}}
+{{ template "groupTable" .Owners -}}
+<div class="pure-g"><div class="pure-u-1">
+<h2>By File</h2>
+<table class="pure-table pure-table-bordered table-md" style="width:100%"{{if .Script}} data-filter="{{$.Ratings.Lines.Names}}"{{end}}>
 <thead><tr><th{{if .Script}} data-sort="text"{{end}}>Filename</th><th colspan="3"{{if .Script}} data-sort="perc"{{end}}>Line Coverage</th>{{if $useFunc}}<th colspan="3"{{if .Script}} data-sort="perc"{{end}}>Function Coverage</th>{{end}}{{if $useBranch}}<th colspan="3"{{if .Script}} data-sort="perc"{{end}}>Branch Coverage</th>{{end}}{{if $useRegion}}<th colspan="3"{{if .Script}} data-sort="perc"{{end}}>Region Coverage</th>{{end}}</tr></thead>
 <tbody>
 {{range $ndx, $data := .Files -}}
-<tr><td><a href="{{.Name}}.html">{{.Name}}</a></td>{{template "coverageDetail" .LCoverage}}
-{{- if $useFunc -}}{{ template "coverageDetail" .FCoverage }}{{- end -}}
-{{- if $useBranch -}}{{ template "coverageDetail" .BCoverage }}{{- end -}}
-{{- if $useRegion -}}{{ template "coverageDetail" .RCoverage }}{{- end -}}
+<tr{{if $.Script}} data-rating="{{if .LCoverage.Valid}}{{(rate $.Ratings.Lines .LCoverage).Rating}}{{end}}" data-uncovered="{{.LCoverage.Misses}}"{{end}}><td>{{if and $.SkipMissing (index $.Missing .Name)}}{{.Name}}{{else}}<a href="{{sourceURL .Name}}{{if and .FirstMiss (not (index $.Missing .Name))}}#L{{.FirstMiss}}{{end}}">{{.Name}}</a>{{end}}{{if index $.Missing .Name}} <span class="missing">(source missing)</span>{{end}}</td>{{template "coverageDetail" (rate $.Ratings.Lines .LCoverage)}}
+{{- if $useFunc -}}{{ template "coverageDetail" (rate $.Ratings.Funcs .FCoverage) }}{{- end -}}
+{{- if $useBranch -}}{{ template "coverageDetail" (rate $.Ratings.Branches .BCoverage) }}{{- end -}}
+{{- if $useRegion -}}{{ template "coverageDetail" (rate $.Ratings.Regions .RCoverage) }}{{- end -}}
 </tr>
 {{end -}}
 </tbody>
@@ -168,12 +248,86 @@ footer { border-top: 1px solid rgb(203, 203, 203); margin-top: 1em; background:
 <thead><tr><th{{if .Script}} data-sort="text"{{end}}>Function</th><th{{if .Script}} data-sort="perc"{{end}}>Hits</th></tr></thead>
 <tbody>
 {{range $ndx, $data := .Funcs -}}
-<tr><td><a href="{{.Filename}}.html#L{{.StartLine}}">{{.Name}}</a></td><td>{{.HitCount}}</td></tr>
+<tr><td><a href="{{sourceURL .Filename}}{{if and .StartLine (not (index $.Missing .Filename))}}#L{{.StartLine}}{{end}}">{{.Name}}</a></td><td>{{.HitCount}}</td></tr>
 {{- end -}}
 </tbody>
 </table>
 </div></div>
 {{- end}}
+{{if .HeatMap -}}
+<div class="pure-g pure-gutter-md"><div class="pure-u-1 pure-u-md-1-2">
+<h2>Hottest Lines</h2>
+{{if .HotLines -}}
+<table class="pure-table pure-table-bordered table-md" style="width:100%">
+<thead><tr><th>Line</th><th>Hits</th></tr></thead>
+<tbody>
+{{range .HotLines -}}
+<tr><td><a href="{{sourceURL .Filename}}{{if not (index $.Missing .Filename)}}#L{{.Line}}{{end}}">{{.Filename}}:{{.Line}}</a></td><td>{{.HitCount}}{{if .Partial}}*{{end}}</td></tr>
+{{end -}}
+</tbody>
+</table>
+{{else -}}
+<p>No lines were executed.</p>
+{{end -}}
+</div><div class="pure-u-1 pure-u-md-1-2">
+<h2>Hottest Functions</h2>
+{{if .HotFuncs -}}
+<table class="pure-table pure-table-bordered table-md" style="width:100%">
+<thead><tr><th>Function</th><th>Hits</th></tr></thead>
+<tbody>
+{{range .HotFuncs -}}
+<tr><td><a href="{{sourceURL .Filename}}{{if and .StartLine (not (index $.Missing .Filename))}}#L{{.StartLine}}{{end}}">{{.Name}}</a></td><td>{{.HitCount}}</td></tr>
+{{end -}}
+</tbody>
+</table>
+{{else -}}
+<p>No functions were executed.</p>
+{{end -}}
+</div></div>
+{{end -}}
+{{ template "footer" . }}
+</body>
+</html>`,
+	))
+	tmplDir = template.Must(tmpl1.New("dir").Parse(
+		`<!DOCTYPE html>
+<html>
+{{template "head" . -}}
+<body>
+{{template "h1" .}}
+{{template "breadcrumbs" .}}
+<div class="pure-g pure-gutter-md"><div class="pure-u-1 pure-u-md-1-2">
+<h2>Metadata</h2>
+{{ template "metadata" . -}}
+</div><div class="pure-u-1 pure-u-md-1-2">
+<h2>Coverage Summary</h2>
+{{ template "coverage" . -}}
+</div></div>
+<div class="pure-g"><div class="pure-u-1">
+<h2>By File</h2>
+<table class="pure-table pure-table-bordered table-md" style="width:100%"{{if .Script}} data-filter="{{$.Ratings.Lines.Names}}"{{end}}>
+{{ $useFunc := .FCoverage.Valid -}}
+{{ $useBranch := .BCoverage.Valid -}}
+{{ $useRegion := .RCoverage.Valid -}}
+<thead><tr><th{{if .Script}} data-sort="text"{{end}}>Filename</th><th colspan="3"{{if .Script}} data-sort="perc"{{end}}>Line Coverage</th>{{if $useFunc}}<th colspan="3"{{if .Script}} data-sort="perc"{{end}}>Function Coverage</th>{{end}}{{if $useBranch}}<th colspan="3"{{if .Script}} data-sort="perc"{{end}}>Branch Coverage</th>{{end}}{{if $useRegion}}<th colspan="3"{{if .Script}} data-sort="perc"{{end}}>Region Coverage</th>{{end}}</tr></thead>
+<tbody>
+{{range $ndx, $data := .Dirs -}}
+<tr{{if $.Script}} data-dir="" data-rating="{{if .LCoverage.Valid}}{{(rate $.Ratings.Lines .LCoverage).Rating}}{{end}}" data-uncovered="{{.LCoverage.Misses}}"{{end}}><td><a href="{{reportPath (base .Name)}}/index.html">{{base .Name}}/</a></td>{{template "coverageDetail" (rate $.Ratings.Lines .LCoverage)}}
+{{- if $useFunc -}}{{ template "coverageDetail" (rate $.Ratings.Funcs .FCoverage) }}{{- end -}}
+{{- if $useBranch -}}{{ template "coverageDetail" (rate $.Ratings.Branches .BCoverage) }}{{- end -}}
+{{- if $useRegion -}}{{ template "coverageDetail" (rate $.Ratings.Regions .RCoverage) }}{{- end -}}
+</tr>
+{{end -}}
+{{range $ndx, $data := .Files -}}
+<tr{{if $.Script}} data-rating="{{if .LCoverage.Valid}}{{(rate $.Ratings.Lines .LCoverage).Rating}}{{end}}" data-uncovered="{{.LCoverage.Misses}}"{{end}}><td>{{if and $.SkipMissing (index $.Missing .Name)}}{{base .Name}}{{else}}<a href="{{base .Name}}.html{{if and .FirstMiss (not (index $.Missing .Name))}}#L{{.FirstMiss}}{{end}}">{{base .Name}}</a>{{end}}{{if index $.Missing .Name}} <span class="missing">(source missing)</span>{{end}}</td>{{template "coverageDetail" (rate $.Ratings.Lines .LCoverage)}}
+{{- if $useFunc -}}{{ template "coverageDetail" (rate $.Ratings.Funcs .FCoverage) }}{{- end -}}
+{{- if $useBranch -}}{{ template "coverageDetail" (rate $.Ratings.Branches .BCoverage) }}{{- end -}}
+{{- if $useRegion -}}{{ template "coverageDetail" (rate $.Ratings.Regions .RCoverage) }}{{- end -}}
+</tr>
+{{end -}}
+</tbody>
+</table>
+</div></div>
 {{ template "footer" . }}
 </body>
 </html>`,
@@ -184,6 +338,7 @@ footer { border-top: 1px solid rgb(203, 203, 203); margin-top: 1em; background:
 {{template "head" . -}}
 <body>
 {{template "h1" .}}
+{{template "breadcrumbs" .}}
 <div class="pure-g pure-gutter-md"><div class="pure-u-1 pure-u-md-1-2">
 <h2>Metadata</h2>
 {{ template "metadata" . }}
@@ -191,32 +346,84 @@ footer { border-top: 1px solid rgb(203, 203, 203); margin-top: 1em; background:
 <h2>Coverage</h2>
 {{ template "coverage" . }}
 </div></div>
+{{if .Funcs -}}
+<div class="pure-g"><div class="pure-u-1">
+<h2>Functions</h2>
+<table class="pure-table pure-table-bordered table-md" style="width:100%">
+<thead><tr><th{{if .Script}} data-sort="text"{{end}}>Function</th><th{{if .Script}} data-sort="perc"{{end}}>Line</th><th{{if .Script}} data-sort="perc"{{end}}>Hits</th><th colspan="3"{{if .Script}} data-sort="perc"{{end}}>Line Coverage</th></tr></thead>
+<tbody>
+{{range .Funcs -}}
+<tr><td>{{if and .StartLine (not $.SourceMissing)}}<a href="#L{{.StartLine}}">{{.Name}}</a>{{else}}{{.Name}}{{end}}</td><td>{{if .StartLine}}{{.StartLine}}{{end}}</td><td>{{.HitCount}}</td>{{template "coverageDetail" (rate $.Ratings.Lines .LCoverage)}}</tr>
+{{end -}}
+</tbody>
+</table>
+</div></div>
+{{end -}}
+{{if .SourceMissing -}}
+<div class="pure-g"><div class="pure-u-1">
+<h2>Lines</h2>
+<p class="missing">The source file could not be found, so the listing is not available.</p>
+<table class="pure-table pure-table-bordered table-md">
+<tbody>
+<tr><th>Executed lines</th><td>{{.Covered}}</td></tr>
+<tr><th>Lines not executed</th><td>{{.Uncovered}}</td></tr>
+</tbody>
+</table>
+{{else -}}
 <div class="pure-g"><div class="pure-u">
 <h2>File Listing</h2>
+<nav class="source-nav">{{if .FirstMiss}}<a href="#L{{.FirstMiss}}">First uncovered line</a>{{else}}All lines were executed.{{end}}</nav>
+{{if .HeatMap -}}
+<p class="heat-legend">Hit counts, on a logarithmic scale: 1 <span class="heat-1"></span><span class="heat-2"></span><span class="heat-3"></span><span class="heat-4"></span><span class="heat-5"></span> {{.HeatMax}}</p>
+{{end -}}
 <table class="source"><thead>
 <tr><th>Line #</th>{{if .BCoverage.Valid}}<th>Branches</th>{{end}}<th>Hit count</th><th>Source code</th></tr>
 </thead><tbody>
+{{end -}}
 `,
 	))
 	tmplSource2 = template.Must(tmpl1.New("sourcePostfix").Parse(
-		`</tbody></table>
+		`{{if not .SourceMissing}}</tbody></table>
+{{end -}}
+{{if .Minimap -}}
+<nav class="minimap" aria-label="Uncovered lines">
+{{- range .Minimap}}<a href="#L{{.Line}}" class="{{.Class}}" style="top:{{printf "%.2f" .Top}}%;height:{{printf "%.2f" .Height}}%" title="{{if eq .Class "miss"}}Not executed{{else}}Partially executed{{end}}: line {{.Line}}{{if gt .Count 1}}-{{add .Line .Count -1}}{{end}}"></a>{{end -}}
+</nav>
+{{end -}}
 </div></div>
 {{ template "footer" . }}
 </body></html>`,
 	))
 )
 
-func createHTML(outdir string, data map[string]*FileData, report *Report) error {
+func createHTML(out io.Writer, outdir string, data fileDataSource, report *Report) error {
 	err := os.MkdirAll(outdir, 0700)
 	if err != nil {
 		return err
 	}
 
+	report.MissingSources = make(map[string]bool)
+	for _, v := range report.Files {
+		if _, ok := report.findSource(v.Name); !ok {
+			report.MissingSources[v.Name] = true
+			if report.SkipMissingSources {
+				fmt.Fprintf(out, "warning: skipping missing source file: %s\n", v.Name)
+			} else {
+				fmt.Fprintf(out, "warning: source file not found, writing a summary instead: %s\n", v.Name)
+			}
+		}
+	}
+
 	err = createHTMLIndex(filepath.Join(outdir, "index.html"), report)
 	if err != nil {
 		return err
 	}
 
+	err = createCSS(filepath.Join(outdir, "style.css"))
+	if err != nil {
+		return err
+	}
+
 	if report.AllowHTMLScripting {
 		err = createJS(filepath.Join(outdir, "index.js"))
 		if err != nil {
@@ -224,15 +431,79 @@ func createHTML(outdir string, data map[string]*FileData, report *Report) error
 		}
 	}
 
-	for name, data := range data {
-		filename := filepath.Join(outdir, name+".html")
-		err = createHTMLForSource(filename, name, data, report)
-		if err != nil {
-			return err
+	err = createHTMLForDirs(outdir, report)
+	if err != nil {
+		return err
+	}
+
+	return createHTMLForSources(out, outdir, data, report)
+}
+
+// createHTMLForSources writes the annotated source pages.  The pages are
+// rendered in parallel, with the number of workers limited by the report's
+// configuration.  Rendering continues after a failure, so that all of the
+// errors can be reported together.
+func createHTMLForSources(out io.Writer, outdir string, data fileDataSource, report *Report) error {
+	jobs := report.HTMLJobs
+	if jobs < 1 {
+		jobs = runtime.NumCPU()
+	}
+
+	type result struct {
+		name string
+		err  error
+	}
+	names := make(chan string)
+	errs := make(chan result)
+
+	wg := sync.WaitGroup{}
+	wg.Add(jobs)
+	for i := 0; i < jobs; i++ {
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				filename := filepath.Join(outdir, filepath.FromSlash(reportPath(name))+".html")
+				err := createHTMLForSource(filename, name, data.Lookup(name), report)
+				if err != nil {
+					errs <- result{name, err}
+				}
+			}
+		}()
+	}
+	go func() {
+		for _, v := range report.Files {
+			if report.SkipMissingSources && report.MissingSources[v.Name] {
+				continue
+			}
+			names <- v.Name
 		}
+		close(names)
+		wg.Wait()
+		close(errs)
+	}()
+
+	// The workers finish in any order, so sort the errors by filename to
+	// keep the output stable.
+	results := []result(nil)
+	for v := range errs {
+		results = append(results, v)
 	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].name < results[j].name
+	})
 
-	return nil
+	list := tool.Errors(nil)
+	for _, v := range results {
+		list = list.Append(v.err)
+	}
+	return list.Err()
+}
+
+// findSource locates the source file.  The source directory is checked first,
+// followed by each of the directories in the search path.  If the file can't
+// be found, the return is the location in the source directory, and false.
+func (r *Report) findSource(sourcename string) (string, bool) {
+	return findSourceFile(r.SrcDir, r.SrcPath, sourcename)
 }
 
 func createHTMLIndex(filename string, report *Report) error {
@@ -249,102 +520,131 @@ func createHTMLIndex(filename string, report *Report) error {
 
 func writeHTMLIndex(out io.Writer, report *Report) error {
 	params := map[string]interface{}{
-		"Title":      report.Title,
-		"SrcID":      report.SrcID,
-		"TestID":     report.TestID,
-		"ProjectURL": report.ProjectURL,
-		"LCoverage":  report.LCoverage,
-		"FCoverage":  report.FCoverage,
-		"BCoverage":  report.BCoverage,
-		"RCoverage":  report.RCoverage,
-		"Files":      report.Files,
-		"Funcs":      report.Funcs,
-		"Date":       report.UnixDate(),
-		"Script":     report.AllowHTMLScripting,
+		"Title":       report.Title,
+		"SrcID":       report.SrcID,
+		"TestID":      report.TestID,
+		"ProjectURL":  report.ProjectURL,
+		"LCoverage":   report.LCoverage,
+		"FCoverage":   report.FCoverage,
+		"BCoverage":   report.BCoverage,
+		"RCoverage":   report.RCoverage,
+		"Files":       report.Files,
+		"Funcs":       report.Funcs,
+		"Dirs":        topLevelDirs(report),
+		"Components":  newHTMLGroupTable("By Component", "Component", report.Components, report),
+		"Owners":      newHTMLGroupTable("By Owner", "Owner", report.Owners, report),
+		"Date":        report.UnixDate(),
+		"Script":      report.AllowHTMLScripting,
+		"Root":        "",
+		"Missing":     report.MissingSources,
+		"SkipMissing": report.SkipMissingSources,
+		"HeatMap":     report.HeatMap,
+		"HotLines":    report.HotLines,
+		"HotFuncs":    report.HotFuncs(),
+		"Trend":       trendChart(report.History),
+		"Ratings":     report.Ratings,
 	}
 
 	return tmpl.Execute(out, params)
 }
 
-func createJS(filename string) error {
-	w, err := tool.Open(filename)
-	if err != nil {
-		return err
-	}
-	defer w.Close()
-
-	err = writeJS(w.File())
-	w.Keep(err)
-	return err
+// htmlGroupTable contains the parameters for a table listing the coverage for
+// components or owners.
+type htmlGroupTable struct {
+	Title        string
+	Heading      string
+	Groups       []GroupStatistics
+	UseFunc      bool
+	UseBranch    bool
+	UseRegion    bool
+	UseThreshold bool
+	Script       bool
+	Ratings      Ratings
 }
 
-func writeJS(out io.Writer) error {
-	const js = `function sortTable( table, cmp ) {
-	var tbody = table.getElementsByTagName('tbody')[0]
-
-	var list = tbody.childNodes;
-	var arr = [];
-	for ( var i in list ) {
-		if ( list[i].nodeType==1 ) arr.push( list[i].cloneNode(true) )
+func newHTMLGroupTable(title, heading string, groups []GroupStatistics, report *Report) htmlGroupTable {
+	useThreshold := false
+	for _, v := range groups {
+		useThreshold = useThreshold || v.HasThreshold()
 	}
-	arr.sort( cmp )
-	while ( tbody.firstChild ) tbody.removeChild(tbody.firstChild )
-	for ( var i in arr ) {
-		tbody.appendChild( arr[i] )
+
+	return htmlGroupTable{
+		Title:        title,
+		Heading:      heading,
+		Groups:       groups,
+		UseFunc:      report.FCoverage.Valid(),
+		UseBranch:    report.BCoverage.Valid(),
+		UseRegion:    report.RCoverage.Valid(),
+		UseThreshold: useThreshold,
+		Script:       report.AllowHTMLScripting,
+		Ratings:      report.Ratings,
 	}
 }
 
-var cmpTable = {
-	'text' : function(a) {
-		return a.textContent
-	},
-	'perc' : function(a) {
-		return parseFloat(a.textContent)
+func topLevelDirs(report *Report) []*DirStatistics {
+	if report.Dirs == nil {
+		return nil
 	}
+	return report.Dirs.Dirs
 }
 
-function makeOnClickCallback(column,cmp,dir) {
-	return function() {
-		var table = this.parentElement.parentElement.parentElement.parentElement.parentElement
-		sortTable( table, function(a,b) {
-			var v1 = cmp(a.childNodes[column])
-			var v2 = cmp(b.childNodes[column])
-			return v1 < v2 ? -dir : v1 > v2 ? +dir : 0
-		})
+// createHTMLForDirs writes an index page for every directory, except for the
+// root, which is covered by the main index.
+func createHTMLForDirs(outdir string, report *Report) error {
+	if report.Dirs == nil {
+		return nil
 	}
+
+	list := tool.Errors(nil)
+	report.Dirs.Walk(func(dir *DirStatistics) {
+		if dir.Name == "" {
+			return
+		}
+		filename := filepath.Join(outdir, filepath.FromSlash(reportPath(dir.Name)), "index.html")
+		list = list.Append(createHTMLForDir(filename, dir, report))
+	})
+	return list.Err()
 }
 
-function cellIndex(e) {
-	var thead = e.parentElement
-	var arr = thead.getElementsByTagName('th')
-	var cellindex = 0
+func createHTMLForDir(filename string, dir *DirStatistics, report *Report) error {
+	err := os.MkdirAll(filepath.Dir(filename), 0700)
+	if err != nil {
+		return err
+	}
 
-	for ( var i of arr ) {
-		if ( i == e ) {
-			return cellindex
-		}
-		cellindex += i.colSpan
+	w, err := tool.Open(filename)
+	if err != nil {
+		return err
 	}
+	defer w.Close()
 
-	return -1
+	err = writeHTMLForDir(w.File(), dir, report)
+	w.Keep(err)
+	return err
 }
 
-window.onload = function() {
-	var elems = document.getElementsByTagName('th')
-	for ( let elem of elems ) {
-		var attr = elem.getAttribute('data-sort')
-		if ( !attr ) continue
-
-		var cellindex = cellIndex(elem)
-		var colspan = elem.colSpan
-		elem.innerHTML = elem.innerHTML + ' <span class="reveal"><a class="pure-button">▲</a><a class="pure-button">▼</a></span>'
-		elem.getElementsByTagName('a')[0].onclick = makeOnClickCallback(cellindex+(colspan-1), cmpTable[attr], +1)
-		elem.getElementsByTagName('a')[1].onclick = makeOnClickCallback(cellindex+(colspan-1), cmpTable[attr], -1)
+func writeHTMLForDir(out io.Writer, dir *DirStatistics, report *Report) error {
+	params := map[string]interface{}{
+		"Title":       report.Title + " > " + dir.Name,
+		"SrcID":       report.SrcID,
+		"TestID":      report.TestID,
+		"ProjectURL":  report.ProjectURL,
+		"LCoverage":   dir.LCoverage,
+		"FCoverage":   dir.FCoverage,
+		"BCoverage":   dir.BCoverage,
+		"RCoverage":   dir.RCoverage,
+		"Dirs":        dir.Dirs,
+		"Files":       dir.Files,
+		"Date":        report.UnixDate(),
+		"Script":      report.AllowHTMLScripting,
+		"Root":        relativeRoot(dir.Name),
+		"Breadcrumbs": Breadcrumbs(dir.Name),
+		"Missing":     report.MissingSources,
+		"SkipMissing": report.SkipMissingSources,
+		"Ratings":     report.Ratings,
 	}
-}`
 
-	_, err := out.Write([]byte(js))
-	return err
+	return tmplDir.Execute(out, params)
 }
 
 func createHTMLForSource(filename string, sourcename string, data *FileData, report *Report) error {
@@ -367,55 +667,138 @@ func createHTMLForSource(filename string, sourcename string, data *FileData, rep
 func writeHTMLForSource(out io.Writer, sourcename string, data *FileData, report *Report) error {
 	bcov := data.BranchCoverage()
 	params := map[string]interface{}{
-		"Title":     report.Title + " > " + filepath.Base(sourcename),
-		"SrcID":     report.SrcID,
-		"TestID":    report.TestID,
-		"Source":    true,
-		"Date":      report.UnixDate(),
-		"Filename":  sourcename,
-		"LCoverage": data.LineCoverage(),
-		"FCoverage": data.FuncCoverage(),
-		"BCoverage": bcov,
-		"RCoverage": data.RegionCoverage(),
+		"Title":       report.Title + " > " + filepath.Base(sourcename),
+		"SrcID":       report.SrcID,
+		"TestID":      report.TestID,
+		"Source":      true,
+		"Date":        report.UnixDate(),
+		"Filename":    sourcename,
+		"Root":        relativeRoot(parentDir(sourcename)),
+		"Breadcrumbs": Breadcrumbs(parentDir(sourcename)),
+		"LCoverage":   data.LineCoverage(),
+		"FCoverage":   data.FuncCoverage(),
+		"BCoverage":   bcov,
+		"RCoverage":   data.RegionCoverage(),
+		"FirstMiss":   data.FirstMiss(),
+		"Funcs":       data.FuncStatistics(sourcename),
+		"Script":      report.AllowHTMLScripting,
+		"HeatMap":     report.HeatMap,
+		"Ratings":     report.Ratings,
+	}
+
+	heatMax := uint64(0)
+	if report.HeatMap {
+		heatMax = maxLineCount(data.LineData)
+		params["HeatMax"] = heatMax
+	}
+
+	filename, ok := report.findSource(sourcename)
+	if !ok {
+		// Without the source, the page can only summarize the coverage.
+		params["SourceMissing"] = true
+		params["Covered"] = lineRanges(data.LineData, true)
+		params["Uncovered"] = lineRanges(data.LineData, false)
+		err := tmplSource1.Execute(out, params)
+		if err != nil {
+			return err
+		}
+		return tmplSource2.Execute(out, params)
 	}
 
 	err := tmplSource1.Execute(out, params)
 	if err != nil {
 		return err
 	}
-	err = writeSourceListing(out, filepath.Join(report.SrcDir, sourcename), data.LineData, bcov.Valid(), data.BranchData)
+	lines, err := writeSourceListing(out, filename, data, bcov.Valid(), heatMax)
 	if err != nil {
 		return err
 	}
+	params["Minimap"] = minimapMarks(data, lines)
 	return tmplSource2.Execute(out, params)
 }
 
-func rowClassAttribute(hitCount uint64, ok bool) string {
+// lineRanges lists the lines that were executed, or that were not executed,
+// combining consecutive lines into ranges.
+func lineRanges(lineData map[int]uint64, executed bool) string {
+	lines := make([]int, 0, len(lineData))
+	for lineNo, hitCount := range lineData {
+		if (hitCount != 0) == executed {
+			lines = append(lines, lineNo)
+		}
+	}
+	if len(lines) == 0 {
+		return "None"
+	}
+	sort.Ints(lines)
+
+	out := []string(nil)
+	for i := 0; i < len(lines); {
+		j := i + 1
+		for j < len(lines) && lines[j] == lines[j-1]+1 {
+			j++
+		}
+		if j-i == 1 {
+			out = append(out, strconv.Itoa(lines[i]))
+		} else {
+			out = append(out, strconv.Itoa(lines[i])+"-"+strconv.Itoa(lines[j-1]))
+		}
+		i = j
+	}
+	return strings.Join(out, ", ")
+}
+
+// rowClassAttribute returns the class attribute for a row in the source
+// listing.  If heat is not zero, the row is coloured for the heatmap.
+func rowClassAttribute(hitCount uint64, ok bool, partial bool, heat int) string {
 	if !ok {
 		return ""
 	}
-	if hitCount > 0 {
-		return ` class="hit"`
+	if hitCount == 0 && !partial {
+		return ` class="miss"`
+	}
+
+	class := "hit"
+	if partial {
+		class += " partial"
+	}
+	if heat > 0 {
+		class += " heat-" + strconv.Itoa(heat)
 	}
-	return ` class="miss"`
+	return ` class="` + class + `"`
 }
 
-func writeSourceListing(writer io.Writer, filename string, lineCountData map[int]uint64, withBranchData bool, branchData map[int][]BranchStatus) error {
+// maxLineCount returns the highest hit count for any line.
+func maxLineCount(lineData map[int]uint64) uint64 {
+	max := uint64(0)
+	for _, v := range lineData {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+// writeSourceListing writes the rows for the annotated source file.  If
+// heatMax is not zero, executed lines are coloured by their hit count
+// relative to heatMax.  The return is the number of lines in the file.
+func writeSourceListing(writer io.Writer, filename string, data *FileData, withBranchData bool, heatMax uint64) (int, error) {
 	file, err := os.Open(filename)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer file.Close()
 
 	w := bufio.NewWriter(writer)
+	h := newHighlighter(filename)
+	misses := regionMisses(data.RegionData)
 
 	lineNo := 1
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		hitCount, ok := lineCountData[lineNo]
-		fmt.Fprintf(w, `<tr id="L%d"%s>`, lineNo, rowClassAttribute(hitCount, ok))
+		hitCount, ok := data.LineData[lineNo]
+		fmt.Fprintf(w, `<tr id="L%d"%s>`, lineNo, rowClassAttribute(hitCount, ok, data.PartialLine(lineNo), heatLevel(hitCount, heatMax)))
 		fmt.Fprintf(w, "<td>%d</td>", lineNo)
-		writeBranchDescription(w, withBranchData, branchData[lineNo])
+		writeBranchDescription(w, withBranchData, data.BranchData[lineNo])
 		if ok {
 			fmt.Fprintf(w, `<td>%d</td>`, hitCount)
 		} else {
@@ -423,21 +806,130 @@ func writeSourceListing(writer io.Writer, filename string, lineCountData map[int
 			// reported when we flush.
 			_, _ = w.WriteString(`<td></td>`)
 		}
-		fmt.Fprintf(w, "<td>%s</td></tr>\n", template.HTMLEscapeString(scanner.Text()))
+		_, _ = w.WriteString("<td>")
+		if ok && hitCount == 0 {
+			// The entire line is already marked as not executed.
+			h.writeLine(w, scanner.Text(), nil)
+		} else {
+			h.writeLine(w, scanner.Text(), misses[lineNo])
+		}
+		_, _ = w.WriteString("</td></tr>\n")
 		lineNo++
 	}
 	if err := scanner.Err(); err != nil {
-		return err
+		return 0, err
+	}
+
+	return lineNo - 1, w.Flush()
+}
+
+// minimapMark is a marker in the minimap for a run of lines that were not
+// executed, or that have partially covered branches.
+type minimapMark struct {
+	Class  string
+	Line   int
+	Count  int
+	Top    float32 // Position of the marker, as a percentage.
+	Height float32 // Height of the marker, as a percentage.
+}
+
+// minimapMarks creates the markers for the minimap.  Consecutive lines with
+// the same status are combined into a single marker.
+func minimapMarks(data *FileData, lines int) []minimapMark {
+	if lines <= 0 {
+		return nil
+	}
+
+	out := []minimapMark(nil)
+	last := ""
+	for lineNo := 1; lineNo <= lines; lineNo++ {
+		class := ""
+		if hitCount, ok := data.LineData[lineNo]; ok && hitCount == 0 {
+			class = "miss"
+		} else if data.PartialLine(lineNo) {
+			class = "partial"
+		}
+
+		if class != "" && class == last {
+			out[len(out)-1].Count++
+		} else if class != "" {
+			out = append(out, minimapMark{Class: class, Line: lineNo, Count: 1})
+		}
+		last = class
+	}
+
+	for i := range out {
+		out[i].Top = float32(out[i].Line-1) * 100 / float32(lines)
+		out[i].Height = float32(out[i].Count) * 100 / float32(lines)
+	}
+	return out
+}
+
+// regionMisses finds the regions that were not executed, and splits them into
+// byte ranges for each line.  Columns in the regions start at one, and the
+// end column is exclusive.  The ranges for each line are sorted, and any
+// overlapping ranges are merged.
+func regionMisses(regionData map[Region]uint64) map[int][]byteRange {
+	out := make(map[int][]byteRange)
+	for k, hitCount := range regionData {
+		if hitCount != 0 {
+			continue
+		}
+		for i := k.StartLine; i <= k.EndLine; i++ {
+			r := byteRange{Start: 0, End: math.MaxInt32, Count: hitCount}
+			if i == k.StartLine {
+				r.Start = k.StartByte - 1
+			}
+			if i == k.EndLine {
+				r.End = k.EndByte - 1
+			}
+			if r.Start < 0 {
+				r.Start = 0
+			}
+			if r.Start < r.End {
+				out[i] = append(out[i], r)
+			}
+		}
 	}
 
-	return w.Flush()
+	for lineNo, ranges := range out {
+		sort.Slice(ranges, func(i, j int) bool {
+			return ranges[i].Start < ranges[j].Start
+		})
+		merged := ranges[:1]
+		for _, v := range ranges[1:] {
+			if last := &merged[len(merged)-1]; v.Start <= last.End {
+				if v.End > last.End {
+					last.End = v.End
+				}
+			} else {
+				merged = append(merged, v)
+			}
+		}
+		out[lineNo] = merged
+	}
+	return out
+}
+
+// sourceURL returns the URL, relative to the root of the HTML report, for the
+// page with the annotated source file.
+func sourceURL(filename string) string {
+	return reportPath(filename) + ".html"
+}
+
+func addInts(values ...int) int {
+	sum := 0
+	for _, v := range values {
+		sum += v
+	}
+	return sum
 }
 
 func htmlSafe(text string) template.HTML {
 	return template.HTML(text)
 }
 
-func writeBranchDescription(w *bufio.Writer, withBranchData bool, data []BranchStatus) {
+func writeBranchDescription(w *bufio.Writer, withBranchData bool, data []BranchData) {
 	// Ignore write errors.
 	// Since we are using a bufio.Writer, write errors will be reported when
 	// we flush.
@@ -449,18 +941,60 @@ func writeBranchDescription(w *bufio.Writer, withBranchData bool, data []BranchS
 		_, _ = w.WriteString(`<td></td>`)
 		return
 	}
-	if data[0] == BranchNotExec {
-		_, _ = w.WriteString(`<td>[ NE ]</td>`)
-		return
-	}
 
-	_, _ = w.WriteString(`<td>[`)
-	for _, v := range data {
-		if v == BranchTaken {
-			_, _ = w.WriteString(" +")
-		} else {
-			_, _ = w.WriteString(" -")
+	_, _ = w.WriteString(`<td><details><summary>`)
+	if data[0].Status == BranchNotExec {
+		_, _ = w.WriteString(`[ NE ]`)
+	} else {
+		_, _ = w.WriteString(`[`)
+		for _, v := range data {
+			if v.Status == BranchTaken {
+				_, _ = w.WriteString(" +")
+			} else {
+				_, _ = w.WriteString(" -")
+			}
 		}
+		_, _ = w.WriteString(` ]`)
+	}
+	_, _ = w.WriteString(`</summary><ul class="branches">`)
+	for i, v := range data {
+		fmt.Fprintf(w, `<li>%s: %s</li>`, branchName(i, v), branchDetail(v))
+	}
+	_, _ = w.WriteString(`</ul></details></td>`)
+}
+
+// branchName identifies the branch using the block and branch numbers, if
+// available, or by the position of the branch on the line.
+func branchName(index int, data BranchData) string {
+	if data.Block >= 0 && data.Branch >= 0 {
+		return fmt.Sprintf("Block %d, branch %d", data.Block, data.Branch)
+	}
+	if data.Branch >= 0 {
+		return fmt.Sprintf("Branch %d", data.Branch)
+	}
+	return fmt.Sprintf("Branch %d", index)
+}
+
+func branchDetail(data BranchData) string {
+	text := ""
+	switch {
+	case data.Status == BranchNotExec:
+		text = "not executed"
+	case data.Status == BranchNotTaken:
+		text = "never taken"
+	case !data.HasCount:
+		text = "taken"
+	case data.Count == 1:
+		text = "taken 1 time"
+	default:
+		text = fmt.Sprintf("taken %d times", data.Count)
+	}
+
+	if data.Throw {
+		text += " (throw)"
+	}
+	if data.Fallthrough {
+		text += " (fallthrough)"
 	}
-	_, _ = w.WriteString(` ]</td>`)
+	return text
 }
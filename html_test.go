@@ -3,11 +3,18 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"io"
 	"io/ioutil"
+	"math"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 	"testing"
+
+	"gitlab.com/stone.code/scov/internal/tool"
 )
 
 func TempDirectory(t *testing.T) (filename string, cleanup func()) {
@@ -39,8 +46,8 @@ func TestCreateHTML(t *testing.T) {
 	for _, v := range cases {
 		v := v
 		t.Run(v.filename+"("+strconv.FormatBool(v.js)+")", func(t *testing.T) {
-			data := make(map[string]*FileData)
-			err := loadFile(data, "./testdata/example-7.4.0.c.gcov")
+			data := make(FileDataSet)
+			err := loadFile(data, "./testdata/example-7.4.0.c.gcov", loadOptions{})
 			if err != nil {
 				t.Fatalf("could not read file: %s", err)
 			}
@@ -53,7 +60,7 @@ func TestCreateHTML(t *testing.T) {
 			report.AllowHTMLScripting = v.js
 			report.SrcDir = "./example"
 
-			err = createHTML(name, data, report)
+			err = createHTML(ioutil.Discard, name, data, report)
 			if err != nil {
 				t.Fatalf("could not write output: %s", err)
 			}
@@ -79,6 +86,265 @@ func TestCreateHTML(t *testing.T) {
 	}
 }
 
+func TestCreateHTMLMissingSource(t *testing.T) {
+	cases := []struct {
+		skip bool
+	}{
+		{false},
+		{true},
+	}
+
+	for _, v := range cases {
+		v := v
+		t.Run(strconv.FormatBool(v.skip), func(t *testing.T) {
+			data := make(FileDataSet)
+			err := loadFile(data, "./testdata/example-7.4.0-branches", loadOptions{})
+			if err != nil {
+				t.Fatalf("could not read file: %s", err)
+			}
+			data["missing.c"] = NewFileData("missing.c")
+			data["missing.c"].AppendLineCountData(3, 0)
+
+			name, cleanup := TempDirectory(t)
+			defer cleanup()
+
+			report := NewTestReport()
+			report.CollectStatistics(data)
+			report.SrcDir = "./example"
+			report.HTMLJobs = 2
+			report.SkipMissingSources = v.skip
+
+			out := bytes.NewBuffer(nil)
+			err = createHTML(out, name, data, report)
+			if err != nil {
+				t.Errorf("unexpected result: %v", err)
+			}
+			if !strings.Contains(out.String(), "missing.c") {
+				t.Errorf("missing warning: %q", out.String())
+			}
+			if _, err := os.Stat(filepath.Join(name, "methods", "gauss.c.html")); err != nil {
+				t.Errorf("missing source page: %s", err)
+			}
+			if _, err := os.Stat(filepath.Join(name, "missing.c.html")); (err == nil) == v.skip {
+				t.Errorf("unexpected page for missing source: %v", err)
+			}
+
+			// The page for a missing source does not have a listing, so the
+			// links should not point to a line.
+			index, err := ioutil.ReadFile(filepath.Join(name, "index.html"))
+			if err != nil {
+				t.Fatalf("could not read the output: %s", err)
+			}
+			if strings.Contains(string(index), "missing.c.html#L") {
+				t.Errorf("link to a line in the page for a missing source")
+			}
+			if !v.skip && !strings.Contains(string(index), `href="missing.c.html"`) {
+				t.Errorf("missing link to the page for a missing source")
+			}
+		})
+	}
+}
+
+func TestCreateHTMLForSourcesErrors(t *testing.T) {
+	name, cleanup := TempDirectory(t)
+	defer cleanup()
+
+	// Each page fails, since the directory for the page is blocked by a
+	// regular file.
+	data := make(FileDataSet)
+	for i := 0; i < 20; i++ {
+		dir := "d" + strconv.Itoa(i)
+		err := ioutil.WriteFile(filepath.Join(name, dir), nil, 0600)
+		if err != nil {
+			t.Fatalf("could not write file: %s", err)
+		}
+		data.FileData(dir+"/a.c").AppendLineCountData(1, 1)
+	}
+
+	report := NewTestReport()
+	report.CollectStatistics(data)
+	report.SrcDir = "./example"
+	report.HTMLJobs = 4
+
+	expected := ""
+	for i := 0; i < 5; i++ {
+		err := createHTMLForSources(ioutil.Discard, name, data, report)
+		if err == nil {
+			t.Fatalf("expected error")
+		}
+		list := err.(tool.Errors)
+		if len(list) != len(data) {
+			t.Fatalf("unexpected number of errors: %d", len(list))
+		}
+		names := []string(nil)
+		for v := range data {
+			names = append(names, v)
+		}
+		sort.Strings(names)
+		for j, v := range list {
+			if dir := filepath.Dir(names[j]); !strings.Contains(v.Error(), filepath.Join(name, dir)) {
+				t.Errorf("error %d is not for %s: %s", j, names[j], v)
+			}
+		}
+		if i == 0 {
+			expected = err.Error()
+		} else if got := err.Error(); got != expected {
+			LogNE(t, "errors", expected, got)
+		}
+	}
+}
+
+func TestCreateHTMLParentDirs(t *testing.T) {
+	dir, cleanup := TempDirectory(t)
+	defer cleanup()
+
+	data := make(FileDataSet)
+	data.FileData("../outside/a.c").AppendLineCountData(1, 1)
+	data.FileData("src/b.c").AppendLineCountData(1, 0)
+
+	report := NewTestReport()
+	report.CollectStatistics(data)
+	report.SrcDir = "./example"
+
+	err := createHTML(ioutil.Discard, filepath.Join(dir, "html"), data, report)
+	if err != nil {
+		t.Fatalf("could not write output: %s", err)
+	}
+
+	// Nothing should be written outside of the output directory.
+	if _, err := os.Stat(filepath.Join(dir, "outside")); !os.IsNotExist(err) {
+		t.Errorf("unexpected output outside of the report: %v", err)
+	}
+	expected := []string{
+		"html/^/outside/a.c.html",
+		"html/^/outside/index.html",
+		"html/^/index.html",
+		"html/src/b.c.html",
+	}
+	for _, v := range expected {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(v))); err != nil {
+			t.Errorf("missing output: %s", err)
+		}
+	}
+
+	index, err := ioutil.ReadFile(filepath.Join(dir, "html", "index.html"))
+	if err != nil {
+		t.Fatalf("could not read the output: %s", err)
+	}
+	if !strings.Contains(string(index), `href="%5e/index.html"`) {
+		t.Errorf("missing link to the parent directory")
+	}
+}
+
+func TestWriteHTMLForDirFilter(t *testing.T) {
+	data := make(FileDataSet)
+	data.FileData("src/a.c").AppendLineCountData(1, 1)
+	data.FileData("src/sub/b.c").AppendLineCountData(1, 0)
+
+	report := NewTestReport()
+	report.CollectStatistics(data)
+	report.AllowHTMLScripting = true
+
+	buffer := bytes.NewBuffer(nil)
+	err := writeHTMLForDir(buffer, report.Dirs.Dirs[0], report)
+	if err != nil {
+		t.Fatalf("could not write output: %s", err)
+	}
+	out := buffer.String()
+
+	// Both the subdirectory and the file need the attributes used when
+	// filtering, but only the subdirectory is marked so that it is not
+	// counted as a file.
+	body := out[strings.Index(out, "<h2>By File</h2>"):]
+	body = body[strings.Index(body, "<tbody>"):strings.Index(body, "</tbody>")]
+	rows := strings.Split(body, "<tr")[1:]
+	if len(rows) != 2 {
+		t.Fatalf("unexpected number of rows: %d", len(rows))
+	}
+	for i, v := range rows {
+		if !strings.Contains(v, "data-rating=") || !strings.Contains(v, "data-uncovered=") {
+			t.Errorf("Case %d: missing attributes for filtering: %s", i, v)
+		}
+		if got := strings.Contains(v, "data-dir="); got != (i == 0) {
+			LogNE(t, "directory row", i == 0, got)
+		}
+	}
+}
+
+func TestCreateHTMLForMissingSource(t *testing.T) {
+	data := make(FileDataSet)
+	err := loadFile(data, "./testdata/example-7.4.0-branches", loadOptions{})
+	if err != nil {
+		t.Fatalf("could not read file: %s", err)
+	}
+
+	report := NewTestReport()
+	report.CollectStatistics(data)
+	report.SrcDir = "./testdata"
+
+	buffer := bytes.NewBuffer(nil)
+	err = writeHTMLForSource(buffer, "methods/gauss.c", data["methods/gauss.c"], report)
+	if err != nil {
+		t.Fatalf("could not write output: %s", err)
+	}
+	out := buffer.Bytes()
+
+	if *update {
+		err := ioutil.WriteFile(filepath.Join("./testdata", t.Name()+".golden"), out, 0600)
+		if err != nil {
+			t.Fatalf("could not write golden file: %s", err)
+		}
+	}
+
+	expected, err := ioutil.ReadFile(filepath.Join("./testdata", t.Name()+".golden"))
+	if err != nil {
+		t.Fatalf("could not read golden file: %s", err)
+	}
+	if !bytes.Equal(expected, out) {
+		t.Errorf("output does not match golden file")
+	}
+}
+
+func TestReportFindSource(t *testing.T) {
+	cases := []struct {
+		srcdir   string
+		srcpath  []string
+		name     string
+		expected string
+		ok       bool
+	}{
+		{"./example", nil, "example.c", "example/example.c", true},
+		{"./example", nil, "gauss.c", "example/gauss.c", false},
+		{".", []string{"./testdata", "./example/methods"}, "gauss.c", "example/methods/gauss.c", true},
+		{".", []string{"./testdata"}, "gauss.c", "gauss.c", false},
+	}
+
+	for _, v := range cases {
+		report := NewTestReport()
+		report.SrcDir = v.srcdir
+		report.SrcPath = v.srcpath
+
+		filename, ok := report.findSource(v.name)
+		if filepath.ToSlash(filename) != v.expected || ok != v.ok {
+			t.Errorf("Case %s: expected %s and %v, got %s and %v", v.name, v.expected, v.ok, filename, ok)
+		}
+	}
+}
+
+func TestLineRanges(t *testing.T) {
+	data := map[int]uint64{1: 1, 2: 1, 3: 0, 4: 1, 6: 1, 7: 1, 8: 1, 9: 0}
+
+	if out := lineRanges(data, true); out != "1-2, 4, 6-8" {
+		t.Errorf("expected %q, got %q", "1-2, 4, 6-8", out)
+	}
+	if out := lineRanges(data, false); out != "3, 9" {
+		t.Errorf("expected %q, got %q", "3, 9", out)
+	}
+	if out := lineRanges(nil, false); out != "None" {
+		t.Errorf("expected %q, got %q", "None", out)
+	}
+}
+
 func TestCreateHTMLIndex(t *testing.T) {
 	cases := []struct {
 		filename string
@@ -93,7 +359,7 @@ func TestCreateHTMLIndex(t *testing.T) {
 		v := v
 		t.Run(v.filename, func(t *testing.T) {
 			data := make(map[string]*FileData)
-			err := loadFile(data, filepath.Join("./testdata", v.filename))
+			err := loadFile(data, filepath.Join("./testdata", v.filename), loadOptions{})
 			if err != nil {
 				t.Fatalf("could not read file: %s", err)
 			}
@@ -132,13 +398,223 @@ func TestCreateHTMLIndex(t *testing.T) {
 	}
 }
 
-func TestCreateJS(t *testing.T) {
-	name, cleanup := TempFilename(t)
+func TestCreateHTMLForDir(t *testing.T) {
+	data := make(map[string]*FileData)
+	err := loadFile(data, "./testdata/example-7.4.0-branches", loadOptions{})
+	if err != nil {
+		t.Fatalf("could not read file: %s", err)
+	}
+
+	filename, cleanup := TempFilename(t)
 	defer cleanup()
 
-	err := createJS(name)
+	report := NewTestReport()
+	report.CollectStatistics(data)
+	report.AllowHTMLScripting = true
+
+	err = createHTMLForDir(filename, report.Dirs.Dirs[0], report)
+	if err != nil {
+		t.Fatalf("could not write output: %s", err)
+	}
+	out, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("could not read the output: %s", err)
+	}
+
+	if *update {
+		err := ioutil.WriteFile(filepath.Join("./testdata", t.Name()+".golden"), out, 0600)
+		if err != nil {
+			t.Fatalf("could not write golden file: %s", err)
+		}
+	}
+
+	expected, err := ioutil.ReadFile(filepath.Join("./testdata", t.Name()+".golden"))
 	if err != nil {
-		t.Errorf("could not write output: %s", err)
+		t.Fatalf("could not read golden file: %s", err)
+	}
+	if !bytes.Equal(expected, out) {
+		t.Errorf("output does not match golden file")
+	}
+}
+
+func TestCreateHTMLHeatMap(t *testing.T) {
+	data := make(FileDataSet)
+	err := loadFile(data, "./testdata/example-8.3.0-branches.c.gcov", loadOptions{})
+	if err != nil {
+		t.Fatalf("could not read file: %s", err)
+	}
+
+	report := NewTestReport()
+	report.Hotspots = 5
+	report.CollectStatistics(data)
+	report.SrcDir = "./example"
+	report.HeatMap = true
+
+	cases := []struct {
+		name  string
+		write func(io.Writer) error
+	}{
+		{"index", func(w io.Writer) error {
+			return writeHTMLIndex(w, report)
+		}},
+		{"source", func(w io.Writer) error {
+			return writeHTMLForSource(w, "example.c", data["example.c"], report)
+		}},
+	}
+
+	for _, v := range cases {
+		v := v
+		t.Run(v.name, func(t *testing.T) {
+			buffer := bytes.NewBuffer(nil)
+			err := v.write(buffer)
+			if err != nil {
+				t.Fatalf("could not write output: %s", err)
+			}
+
+			if *update {
+				err := ioutil.WriteFile(filepath.Join("./testdata", t.Name()+".golden"), buffer.Bytes(), 0600)
+				if err != nil {
+					t.Fatalf("could not write golden file: %s", err)
+				}
+			}
+
+			expected, err := ioutil.ReadFile(filepath.Join("./testdata", t.Name()+".golden"))
+			if err != nil {
+				t.Fatalf("could not read golden file: %s", err)
+			}
+			if !bytes.Equal(expected, buffer.Bytes()) {
+				t.Errorf("output does not match golden file")
+			}
+		})
+	}
+}
+
+// cssBackground returns the background for a table row in the annotated
+// source listing with the given classes.  Only the simple selectors used in
+// the report are supported, and the winning rule is chosen by specificity,
+// and then by order.
+func cssBackground(css string, classes ...string) string {
+	has := make(map[string]bool)
+	for _, v := range classes {
+		has[v] = true
+	}
+	matches := func(compound string, tag string, classes map[string]bool) (int, bool) {
+		if strings.ContainsAny(compound, ":[>+~") {
+			return 0, false
+		}
+		parts := strings.Split(compound, ".")
+		specificity := 10 * (len(parts) - 1)
+		if parts[0] != "" {
+			if parts[0] != tag {
+				return 0, false
+			}
+			specificity++
+		}
+		for _, v := range parts[1:] {
+			if !classes[v] {
+				return 0, false
+			}
+		}
+		return specificity, true
+	}
+
+	best, background := -1, ""
+	for _, rule := range strings.Split(css, "}") {
+		ndx := strings.Index(rule, "{")
+		if ndx < 0 || !strings.Contains(rule[ndx:], "background:") {
+			continue
+		}
+		value := rule[ndx+1:]
+		value = strings.TrimSpace(value[strings.Index(value, "background:")+len("background:"):])
+		value = strings.TrimSpace(strings.SplitN(value, ";", 2)[0])
+
+		for _, selector := range strings.Split(rule[:ndx], ",") {
+			compounds := strings.Fields(selector)
+			if len(compounds) == 0 || len(compounds) > 2 {
+				continue
+			}
+			specificity, ok := matches(compounds[len(compounds)-1], "tr", has)
+			if !ok {
+				continue
+			}
+			if len(compounds) == 2 {
+				s, ok := matches(compounds[0], "table", map[string]bool{"source": true})
+				if !ok {
+					continue
+				}
+				specificity += s
+			}
+			if specificity >= best {
+				best, background = specificity, value
+			}
+		}
+	}
+	return background
+}
+
+func TestHeatMapCSS(t *testing.T) {
+	report := NewTestReport()
+	report.HeatMap = true
+	params := map[string]interface{}{
+		"Title":   "Example",
+		"Source":  true,
+		"HeatMap": true,
+		"Ratings": report.Ratings,
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	err := tmplSource1.Execute(buffer, params)
+	if err != nil {
+		t.Fatalf("could not write output: %s", err)
+	}
+	out := buffer.String()
+	start, end := strings.Index(out, "<style>"), strings.Index(out, "</style>")
+	if start < 0 || end < start {
+		t.Fatalf("missing style sheet")
+	}
+	css := out[start:end]
+
+	if got := cssBackground(css, "hit"); got != "lightblue" {
+		LogNE(t, "background", "lightblue", got)
+	}
+	if got := cssBackground(css, "miss"); got != "LightCoral" {
+		LogNE(t, "background", "LightCoral", got)
+	}
+	for heat := 1; heat <= heatLevels; heat++ {
+		class := "heat-" + strconv.Itoa(heat)
+		want := cssBackground(css, class)
+		if want == "" || want == "lightblue" {
+			t.Fatalf("missing rule for %s", class)
+		}
+		if got := cssBackground(css, "hit", class); got != want {
+			LogNE(t, "background for "+class, want, got)
+		}
+		if got := cssBackground(css, "hit", "partial", class); got != want {
+			LogNE(t, "background for partial "+class, want, got)
+		}
+	}
+}
+
+func TestRowClassAttribute(t *testing.T) {
+	cases := []struct {
+		hitCount uint64
+		ok       bool
+		partial  bool
+		heat     int
+		expected string
+	}{
+		{0, false, false, 0, ""},
+		{0, true, false, 0, ` class="miss"`},
+		{3, true, false, 0, ` class="hit"`},
+		{3, true, true, 0, ` class="hit partial"`},
+		{3, true, false, 2, ` class="hit heat-2"`},
+		{3, true, true, 5, ` class="hit partial heat-5"`},
+	}
+
+	for _, v := range cases {
+		if out := rowClassAttribute(v.hitCount, v.ok, v.partial, v.heat); out != v.expected {
+			LogNE(t, "class attribute", v.expected, out)
+		}
 	}
 }
 
@@ -150,16 +626,18 @@ func TestCreateHTMLForSource(t *testing.T) {
 		{"example-7.4.0-branches.c.gcov"},
 		{"example-8.3.0.c.gcov"},
 		{"example-8.3.0-branches.c.gcov"},
+		{"example-llvm-8.0.1.json"},
 	}
 
 	for _, v := range cases {
 		v := v
 		t.Run(v.filename, func(t *testing.T) {
-			data := make(map[string]*FileData)
-			err := loadFile(data, filepath.Join("./testdata", v.filename))
+			data := make(FileDataSet)
+			err := loadFile(data, filepath.Join("./testdata", v.filename), loadOptions{})
 			if err != nil {
 				t.Fatalf("could not read file: %s", err)
 			}
+			data.ConvertRegionToLineData()
 
 			filename, cleanup := TempFilename(t)
 			defer cleanup()
@@ -197,15 +675,32 @@ func TestCreateHTMLForSource(t *testing.T) {
 
 func TestWriteBranchDescription(t *testing.T) {
 	cases := []struct {
-		data     []BranchStatus
+		data     []BranchData
 		withData bool
 		out      string
 	}{
 		{nil, false, ""},
 		{nil, true, `<td></td>`},
-		{[]BranchStatus{}, true, `<td></td>`},
-		{[]BranchStatus{BranchNotExec}, true, `<td>[ NE ]</td>`},
-		{[]BranchStatus{BranchTaken, BranchNotTaken}, true, `<td>[ + - ]</td>`},
+		{[]BranchData{}, true, `<td></td>`},
+		{
+			[]BranchData{{Status: BranchNotExec, Block: -1, Branch: -1}},
+			true,
+			`<td><details><summary>[ NE ]</summary><ul class="branches"><li>Branch 0: not executed</li></ul></details></td>`,
+		},
+		{
+			[]BranchData{{Status: BranchTaken, Block: -1, Branch: -1}, {Status: BranchNotTaken, Block: -1, Branch: -1}},
+			true,
+			`<td><details><summary>[ + - ]</summary><ul class="branches"><li>Branch 0: taken</li><li>Branch 1: never taken</li></ul></details></td>`,
+		},
+		{
+			[]BranchData{
+				{Status: BranchTaken, Count: 1, HasCount: true, Block: 0, Branch: 0, Fallthrough: true},
+				{Status: BranchTaken, Count: 12, HasCount: true, Block: 0, Branch: 1},
+				{Status: BranchNotTaken, HasCount: true, Block: 1, Branch: 0, Throw: true},
+			},
+			true,
+			`<td><details><summary>[ + + - ]</summary><ul class="branches"><li>Block 0, branch 0: taken 1 time (fallthrough)</li><li>Block 0, branch 1: taken 12 times</li><li>Block 1, branch 0: never taken (throw)</li></ul></details></td>`,
+		},
 	}
 
 	for i, v := range cases {
@@ -222,3 +717,64 @@ func TestWriteBranchDescription(t *testing.T) {
 		}
 	}
 }
+
+func TestRegionMisses(t *testing.T) {
+	regions := map[Region]uint64{
+		{1, 1, 1, 20}:  1,
+		{1, 10, 1, 12}: 0,
+		{1, 11, 1, 15}: 0,
+		{1, 18, 1, 20}: 0,
+		{3, 5, 5, 2}:   0,
+	}
+	expected := map[int][]byteRange{
+		1: {{9, 14, 0}, {17, 19, 0}},
+		3: {{4, math.MaxInt32, 0}},
+		4: {{0, math.MaxInt32, 0}},
+		5: {{0, 1, 0}},
+	}
+
+	out := regionMisses(regions)
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("expected %v, got %v", expected, out)
+	}
+}
+
+func TestMinimapMarks(t *testing.T) {
+	data := NewFileData("example.c")
+	data.AppendLineCountData(1, 1)
+	data.AppendLineCountData(2, 0)
+	data.AppendLineCountData(3, 0)
+	data.AppendLineCountData(5, 1)
+	data.AppendBranchData(5, BranchData{Status: BranchTaken})
+	data.AppendBranchData(5, BranchData{Status: BranchNotTaken})
+	data.AppendLineCountData(7, 0)
+
+	expected := []minimapMark{
+		{"miss", 2, 2, 12.5, 25},
+		{"partial", 5, 1, 50, 12.5},
+		{"miss", 7, 1, 75, 12.5},
+	}
+	if out := minimapMarks(data, 8); !reflect.DeepEqual(out, expected) {
+		t.Errorf("expected %v, got %v", expected, out)
+	}
+	if out := minimapMarks(data, 0); out != nil {
+		t.Errorf("expected nil, got %v", out)
+	}
+}
+
+func TestSourceURL(t *testing.T) {
+	cases := []struct {
+		filename string
+		expected string
+	}{
+		{"example.c", "example.c.html"},
+		{"methods/gauss.c", "methods/gauss.c.html"},
+		{"/usr/include/stdio.h", "usr/include/stdio.h.html"},
+	}
+
+	for _, v := range cases {
+		if got := sourceURL(v.filename); got != v.expected {
+			t.Errorf("Case %s: expected %s, got %s", v.filename, v.expected, got)
+		}
+	}
+}
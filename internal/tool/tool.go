@@ -75,3 +75,35 @@ func (w *File) Keep(err error) {
 		w.flags |= flagKeep
 	}
 }
+
+// Errors collects multiple errors, such as those reported by independent
+// tasks, so that they can be reported together.
+type Errors []error
+
+// Append adds err to the list, but only if err is not nil.
+func (e Errors) Append(err error) Errors {
+	if err == nil {
+		return e
+	}
+	return append(e, err)
+}
+
+// Err returns nil if the list is empty, and otherwise returns the list.
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Error returns the messages of all the errors in the list, one per line.
+func (e Errors) Error() string {
+	buffer := make([]byte, 0, 64*len(e))
+	for i, v := range e {
+		if i > 0 {
+			buffer = append(buffer, '\n')
+		}
+		buffer = append(buffer, v.Error()...)
+	}
+	return string(buffer)
+}
@@ -93,3 +93,34 @@ func TestCombineErrors(t *testing.T) {
 		}
 	}
 }
+
+func TestErrors(t *testing.T) {
+	mock1 := errors.New("mock1")
+	mock2 := errors.New("mock2")
+
+	cases := []struct {
+		in       []error
+		ok       bool
+		expected string
+	}{
+		{nil, true, ""},
+		{[]error{nil}, true, ""},
+		{[]error{mock1}, false, "mock1"},
+		{[]error{mock1, nil, mock2}, false, "mock1\nmock2"},
+	}
+
+	for i, v := range cases {
+		list := tool.Errors(nil)
+		for _, err := range v.in {
+			list = list.Append(err)
+		}
+
+		err := list.Err()
+		if (err == nil) != v.ok {
+			t.Errorf("Case %d: want %v, got %v", i, v.ok, err == nil)
+		}
+		if err != nil && err.Error() != v.expected {
+			t.Errorf("Case %d: want %q, got %q", i, v.expected, err.Error())
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+// jacocoPackage is a package in a JaCoCo report.  The coverage for lines is
+// reported for each source file, and the coverage for methods is reported
+// for each class.
+type jacocoPackage struct {
+	Name        string             `xml:"name,attr"`
+	Classes     []jacocoClass      `xml:"class"`
+	SourceFiles []jacocoSourceFile `xml:"sourcefile"`
+}
+
+type jacocoClass struct {
+	Name           string         `xml:"name,attr"`
+	SourceFilename string         `xml:"sourcefilename,attr"`
+	Methods        []jacocoMethod `xml:"method"`
+}
+
+type jacocoMethod struct {
+	Name     string          `xml:"name,attr"`
+	Desc     string          `xml:"desc,attr"`
+	Line     int             `xml:"line,attr"`
+	Counters []jacocoCounter `xml:"counter"`
+}
+
+type jacocoCounter struct {
+	Type    string `xml:"type,attr"`
+	Missed  int    `xml:"missed,attr"`
+	Covered int    `xml:"covered,attr"`
+}
+
+type jacocoSourceFile struct {
+	Name  string       `xml:"name,attr"`
+	Lines []jacocoLine `xml:"line"`
+}
+
+// jacocoLine contains the counts of missed and covered instructions (mi and
+// ci), and of missed and covered branches (mb and cb).  Hit counts are not
+// available.
+type jacocoLine struct {
+	Number int `xml:"nr,attr"`
+	MI     int `xml:"mi,attr"`
+	CI     int `xml:"ci,attr"`
+	MB     int `xml:"mb,attr"`
+	CB     int `xml:"cb,attr"`
+}
+
+func loadJaCoCoPackage(fds FileDataSet, pkg *jacocoPackage) {
+	for _, file := range pkg.SourceFiles {
+		currentData := fds.FileData(path.Join(pkg.Name, file.Name))
+
+		for _, v := range file.Lines {
+			if v.MI+v.CI == 0 {
+				continue
+			}
+
+			hitCount := uint64(0)
+			if v.CI > 0 {
+				hitCount = 1
+			}
+			currentData.AppendLineCountData(v.Number, hitCount)
+
+			for i := 0; i < v.MB+v.CB; i++ {
+				data := BranchData{Block: -1, Branch: i}
+				switch {
+				case i < v.CB:
+					data.Status = BranchTaken
+				case v.CI > 0:
+					data.Status = BranchNotTaken
+				default:
+					data.Status = BranchNotExec
+				}
+				currentData.AppendBranchData(v.Number, data)
+			}
+		}
+	}
+
+	for _, class := range pkg.Classes {
+		if class.SourceFilename == "" {
+			continue
+		}
+		currentData := fds.FileData(path.Join(pkg.Name, class.SourceFilename))
+
+		overloaded := make(map[string]int, len(class.Methods))
+		for _, v := range class.Methods {
+			overloaded[v.Name]++
+		}
+		className := strings.Replace(class.Name, "/", ".", -1)
+		for _, v := range class.Methods {
+			name := className + "." + v.Name
+			if overloaded[v.Name] > 1 {
+				name += v.Desc
+			}
+
+			hitCount := uint64(0)
+			for _, c := range v.Counters {
+				if c.Type == "METHOD" && c.Covered > 0 {
+					hitCount = 1
+				}
+			}
+			currentData.AppendFunctionData(name, v.Line, 0, hitCount)
+		}
+	}
+}
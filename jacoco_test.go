@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLoadJaCoCoFile(t *testing.T) {
+	fds := make(FileDataSet)
+	err := loadFile(fds, "./testdata/example-jacoco.xml", loadOptions{})
+	if err != nil {
+		t.Fatalf("could not load file: %s", err)
+	}
+	if len(fds) != 2 {
+		LogNE(t, "file count", 2, len(fds))
+	}
+
+	data, ok := fds["com/example/Gauss.java"]
+	if !ok {
+		t.Fatalf("missing file")
+	}
+
+	lines := map[int]uint64{3: 1, 5: 1, 6: 1, 7: 1, 10: 0, 11: 0}
+	if !reflect.DeepEqual(data.LineData, lines) {
+		LogNE(t, "line data", lines, data.LineData)
+	}
+
+	funcs := map[string]FuncData{
+		"com.example.Gauss.<init>":  {StartLine: 3, HitCount: 1},
+		"com.example.Gauss.sum(I)I": {StartLine: 5, HitCount: 1},
+		"com.example.Gauss.sum(J)J": {StartLine: 10, HitCount: 0},
+	}
+	if !reflect.DeepEqual(data.FuncData, funcs) {
+		LogNE(t, "function data", funcs, data.FuncData)
+	}
+
+	branches := map[int][]BranchData{
+		6: {
+			{Status: BranchTaken, Block: -1, Branch: 0},
+			{Status: BranchNotTaken, Block: -1, Branch: 1},
+		},
+		11: {
+			{Status: BranchNotExec, Block: -1, Branch: 0},
+			{Status: BranchNotExec, Block: -1, Branch: 1},
+		},
+	}
+	if !reflect.DeepEqual(data.BranchData, branches) {
+		LogNE(t, "branch data", branches, data.BranchData)
+	}
+
+	// Classes in the default package.
+	data, ok = fds["Main.java"]
+	if !ok {
+		t.Fatalf("missing file")
+	}
+	if _, ok := data.FuncData["Main.main"]; !ok {
+		t.Errorf("missing function")
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"gitlab.com/stone.code/scov/internal/tool"
+)
+
+// jsonCoverage is the representation of a Coverage in the JSON report.
+type jsonCoverage struct {
+	Hits  int `json:"hits"`
+	Total int `json:"total"`
+}
+
+// jsonFile is the representation of a FileStatistics in the JSON report.
+type jsonFile struct {
+	Name      string       `json:"name"`
+	LCoverage jsonCoverage `json:"lines"`
+	FCoverage jsonCoverage `json:"functions"`
+	BCoverage jsonCoverage `json:"branches"`
+	RCoverage jsonCoverage `json:"regions"`
+}
+
+// jsonGroup is the representation of a GroupStatistics in the JSON report.
+type jsonGroup struct {
+	Name      string       `json:"name"`
+	FileCount int          `json:"fileCount"`
+	LCoverage jsonCoverage `json:"lines"`
+	FCoverage jsonCoverage `json:"functions"`
+	BCoverage jsonCoverage `json:"branches"`
+	RCoverage jsonCoverage `json:"regions"`
+	Threshold float32      `json:"threshold,omitempty"`
+}
+
+// jsonReport is the representation of a Report in the JSON report.
+type jsonReport struct {
+	Title      string       `json:"title"`
+	TestID     string       `json:"testID,omitempty"`
+	SrcID      string       `json:"srcID,omitempty"`
+	Date       time.Time    `json:"date"`
+	LCoverage  jsonCoverage `json:"lines"`
+	FCoverage  jsonCoverage `json:"functions"`
+	BCoverage  jsonCoverage `json:"branches"`
+	RCoverage  jsonCoverage `json:"regions"`
+	Files      []jsonFile   `json:"files"`
+	Components []jsonGroup  `json:"components,omitempty"`
+	Owners     []jsonGroup  `json:"owners,omitempty"`
+}
+
+func createJSONReport(filename string, report *Report) error {
+	w, err := tool.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	err = writeJSONReport(w.File(), report)
+	w.Keep(err)
+	return err
+}
+
+func writeJSONReport(out io.Writer, report *Report) error {
+	data := newJSONReport(report)
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "\t")
+	return encoder.Encode(&data)
+}
+
+// newJSONReport converts the report to its representation in the JSON report.
+func newJSONReport(report *Report) jsonReport {
+	data := jsonReport{
+		Title:     report.Title,
+		TestID:    report.TestID,
+		SrcID:     report.SrcID,
+		Date:      report.Date,
+		LCoverage: jsonCoverage(report.LCoverage),
+		FCoverage: jsonCoverage(report.FCoverage),
+		BCoverage: jsonCoverage(report.BCoverage),
+		RCoverage: jsonCoverage(report.RCoverage),
+		Files:     make([]jsonFile, 0, len(report.Files)),
+	}
+	for _, v := range report.Files {
+		data.Files = append(data.Files, jsonFile{
+			Name:      v.Name,
+			LCoverage: jsonCoverage(v.LCoverage),
+			FCoverage: jsonCoverage(v.FCoverage),
+			BCoverage: jsonCoverage(v.BCoverage),
+			RCoverage: jsonCoverage(v.RCoverage),
+		})
+	}
+
+	data.Components = newJSONGroups(report.Components)
+	data.Owners = newJSONGroups(report.Owners)
+	return data
+}
+
+func newJSONGroups(groups []GroupStatistics) []jsonGroup {
+	if len(groups) == 0 {
+		return nil
+	}
+
+	out := make([]jsonGroup, 0, len(groups))
+	for _, v := range groups {
+		out = append(out, jsonGroup{
+			Name:      v.Name,
+			FileCount: v.FileCount,
+			LCoverage: jsonCoverage(v.LCoverage),
+			FCoverage: jsonCoverage(v.FCoverage),
+			BCoverage: jsonCoverage(v.BCoverage),
+			RCoverage: jsonCoverage(v.RCoverage),
+			Threshold: v.Threshold,
+		})
+	}
+	return out
+}
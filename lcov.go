@@ -1,78 +1,262 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
-	"os"
+	"io"
 	"strconv"
+	"strings"
 )
 
-func loadLCovFile(fds FileDataSet, file *os.File) error {
-	currentData := (*FileData)(nil)
+func loadLCovFile(fds FileDataSet, file io.Reader, opts loadOptions) error {
+	return streamLCovFile(fds, file, opts, nil)
+}
+
+// streamLCovFile loads the coverage data from a tracefile.  If flush is not
+// nil, it is called at the end of every record, after which the data for
+// that record is removed from fds.
+func streamLCovFile(fds FileDataSet, file io.Reader, opts loadOptions, flush func(FileDataSet) error) error {
+	section := (*lcovSection)(nil)
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		t, value := recordType(scanner.Text())
+	s := newRecordScanner(file, opts)
+	for s.scan() {
+		t, value := recordType(s.text())
 		switch t {
-		case "TN": // Title
+		case "", "TN", "VER": // Blank line, title, or version of the source file
 			// ignore
 
 		case "SF": // Source file
-			currentData = fds.FileData(value)
+			if section != nil && opts.validate {
+				s.warnf("missing end_of_record for %s", section.data.Filename)
+			}
+			section = newLCovSection(fds.FileData(value), opts.validate)
 
-		case "FN": // Function
-			funcName, funcStart, err := parseFNRecord(value)
-			if err != nil {
-				return err
+		case "FN", "FNDA", "FNL", "FNA", "DA", "BRDA":
+			if section == nil {
+				if err := s.missingFile(t); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := section.appendRecord(t, value); err != nil {
+				if err := s.badRecord(err); err != nil {
+					return err
+				}
 			}
-			currentData.AppendFunctionData(funcName, funcStart, 0)
 
-		case "FNDA": // Function data
-			funcName, hitCount, err := parseFNDARecord(value)
-			if err != nil {
-				return err
+		case "LF", "LH", "FNF", "FNH", "BRF", "BRH":
+			// These records provide summaries of the counts in the data
+			// records.  We calculate the statistics ourselves, but the
+			// summaries can be used to check the integrity of the tracefile.
+			if section == nil || !opts.validate {
+				continue
+			}
+			if err := section.appendSummary(t, value); err != nil {
+				if err := s.badRecord(err); err != nil {
+					return err
+				}
 			}
-			currentData.AppendFunctionData(funcName, 0, hitCount)
 
-		case "DA": // Line data
-			lineNo, hitCount, err := parseDARecord(value)
-			if err != nil {
-				return err
+		case "end_of_record":
+			if section != nil && opts.validate {
+				for _, v := range section.validate() {
+					s.warnf("%s: %s", section.data.Filename, v)
+				}
+			}
+			if flush != nil {
+				err := flushFileData(fds, flush)
+				if err != nil {
+					return err
+				}
 			}
-			currentData.AppendLineCountData(lineNo, hitCount)
+			section = nil
 
-		case "BRDA": // Branch data
-			lineNo, branchStatus, err := parseBRDARecord(value)
-			if err != nil {
+		default:
+			if err := s.unknownRecord(t); err != nil {
 				return err
 			}
-			currentData.AppendBranchData(lineNo, branchStatus)
+		}
+	}
+	if section != nil && opts.validate {
+		s.warnf("missing end_of_record for %s", section.data.Filename)
+	}
+	if err := s.finish(); err != nil {
+		return err
+	}
 
-		default:
-			// Unknown records are ignored.  If future versions of the file
-			// format introduce new records, we don't want to have an error.
-			//
-			// We are also skipping known records:
-			//    LF  lines found
-			//    LH  lines hit
-			//    FNF functions found
-			//    FNH functions hit
-			//    BRF branches found
-			//    BRH branches hit
-			//
-			// The above records provides summaries of the counts in the data
-			// records, but we will calculate that ourselves.
+	// Handle any data following the last end_of_record.
+	if flush != nil && len(fds) > 0 {
+		return flushFileData(fds, flush)
+	}
+	return nil
+}
+
+// lcovSection holds the state for one section of a tracefile, which starts
+// with an SF record and ends with an end_of_record record.  When validating,
+// the section also counts the data records so that they can be compared
+// with the summary records.
+type lcovSection struct {
+	data    *FileData
+	leaders map[string]lcovLeader
+
+	lines     map[int]bool
+	functions map[string]bool
+	branches  Coverage
+	summary   map[string]int
+	order     []string
+}
+
+// lcovLeader is the location of a function, given by an FNL record.  The
+// names of the function, and the hit counts, are given by FNA records.
+type lcovLeader struct {
+	StartLine int
+	EndLine   int
+}
+
+func newLCovSection(data *FileData, validate bool) *lcovSection {
+	section := &lcovSection{data: data}
+	if validate {
+		section.lines = make(map[int]bool)
+		section.functions = make(map[string]bool)
+		section.summary = make(map[string]int)
+	}
+	return section
+}
+
+// appendRecord parses a data record from a tracefile, and adds the data to
+// the source file.
+func (s *lcovSection) appendRecord(t, value string) error {
+	switch t {
+	case "FN": // Function
+		funcName, funcStart, funcEnd, err := parseFNRecord(value)
+		if err != nil {
+			return err
+		}
+		s.data.AppendFunctionData(demangleRust(funcName), funcStart, funcEnd, 0)
+		s.countFunction(funcName, 0)
+
+	case "FNDA": // Function data
+		funcName, hitCount, err := parseFNDARecord(value)
+		if err != nil {
+			return err
+		}
+		s.data.AppendFunctionData(demangleRust(funcName), 0, 0, hitCount)
+		s.countFunction(funcName, hitCount)
+
+	case "FNL": // Function leader, from lcov 2.x
+		index, leader, err := parseFNLRecord(value)
+		if err != nil {
+			return err
+		}
+		if s.leaders == nil {
+			s.leaders = make(map[string]lcovLeader)
+		}
+		s.leaders[index] = leader
+		s.countFunction("\x00"+index, 0)
+
+	case "FNA": // Function alias, from lcov 2.x
+		index, hitCount, funcName, err := parseFNARecord(value)
+		if err != nil {
+			return err
+		}
+		leader, ok := s.leaders[index]
+		if !ok {
+			return fmt.Errorf("can't parse function alias record: unknown index %s", index)
+		}
+		s.data.AppendFunctionData(demangleRust(funcName), leader.StartLine, leader.EndLine, hitCount)
+		s.countFunction("\x00"+index, hitCount)
+
+	case "DA": // Line data
+		lineNo, hitCount, err := parseDARecord(value)
+		if err != nil {
+			return err
+		}
+		s.data.AppendLineCountData(lineNo, hitCount)
+		if s.lines != nil {
+			s.lines[lineNo] = s.lines[lineNo] || hitCount > 0
+		}
+
+	case "BRDA": // Branch data
+		lineNo, branchData, err := parseBRDARecord(value)
+		if err != nil {
+			return err
+		}
+		s.data.AppendBranchData(lineNo, branchData)
+		s.branches.Total++
+		if branchData.Count > 0 {
+			s.branches.Hits++
 		}
 	}
+	return nil
+}
 
-	return scanner.Err()
+func (s *lcovSection) countFunction(key string, hitCount uint64) {
+	if s.functions != nil {
+		s.functions[key] = s.functions[key] || hitCount > 0
+	}
 }
 
+// appendSummary parses a summary record.
+func (s *lcovSection) appendSummary(t, value string) error {
+	tmp, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return fmt.Errorf("can't parse %s record: %s", t, err)
+	}
+	if _, ok := s.summary[t]; !ok {
+		s.order = append(s.order, t)
+	}
+	s.summary[t] = int(tmp)
+	return nil
+}
+
+// validate compares the summary records in the section with the totals
+// calculated from the data records, and returns a description of each
+// mismatch.
+func (s *lcovSection) validate() []string {
+	lines, functions := Coverage{Total: len(s.lines)}, Coverage{Total: len(s.functions)}
+	for _, v := range s.lines {
+		if v {
+			lines.Hits++
+		}
+	}
+	for _, v := range s.functions {
+		if v {
+			functions.Hits++
+		}
+	}
+	computed := map[string]int{
+		"LF":  lines.Total,
+		"LH":  lines.Hits,
+		"FNF": functions.Total,
+		"FNH": functions.Hits,
+		"BRF": s.branches.Total,
+		"BRH": s.branches.Hits,
+	}
+
+	out := []string(nil)
+	for _, t := range s.order {
+		if declared := s.summary[t]; declared != computed[t] {
+			out = append(out, fmt.Sprintf("%s record gives %d, but the data records give %d", t, declared, computed[t]))
+		}
+	}
+	return out
+}
+
+func flushFileData(fds FileDataSet, flush func(FileDataSet) error) error {
+	err := flush(fds)
+	for key := range fds {
+		delete(fds, key)
+	}
+	return err
+}
+
+// parseDARecord parses a line record, which has the format
+// <line>,<count>[,<checksum>].  The checksum of the source line is optional,
+// and is ignored.
 func parseDARecord(value string) (lineNo int, hitCount uint64, err error) {
 	buffer := [4]string{}
 	values := splitOnComma(buffer[:], value)
 
-	if l := len(values); l != 2 {
+	if l := len(values); l != 2 && l != 3 {
 		return 0, 0, fmt.Errorf("can't parse DA record")
 	}
 
@@ -89,20 +273,30 @@ func parseDARecord(value string) (lineNo int, hitCount uint64, err error) {
 	return lineNo, hitCount, nil
 }
 
-func parseFNRecord(value string) (funcName string, funcStart int, err error) {
+// parseFNRecord parses a function record, which has the format
+// <start>,[<end>,]<name>.  The end line is only present in newer versions of
+// lcov, and is zero if missing.
+func parseFNRecord(value string) (funcName string, funcStart, funcEnd int, err error) {
 	buffer := [4]string{}
 	values := splitOnComma(buffer[:], value)
 
-	if len(values) != 2 {
-		return "", 0, fmt.Errorf("can't parse function record")
+	if len(values) != 2 && len(values) != 3 {
+		return "", 0, 0, fmt.Errorf("can't parse function record")
 	}
 
 	line, err := strconv.ParseInt(values[0], 10, 64)
 	if err != nil {
-		return "", 0, fmt.Errorf("can't parse function record: %s", err)
+		return "", 0, 0, fmt.Errorf("can't parse function record: %s", err)
 	}
-	funcName = values[1]
-	return funcName, int(line), nil
+	if len(values) == 3 {
+		end, err := strconv.ParseInt(values[1], 10, 64)
+		if err != nil {
+			return "", 0, 0, fmt.Errorf("can't parse function record: %s", err)
+		}
+		funcEnd = int(end)
+	}
+	funcName = values[len(values)-1]
+	return funcName, int(line), funcEnd, nil
 }
 
 func parseFNDARecord(value string) (funcName string, hitCount uint64, err error) {
@@ -121,27 +315,97 @@ func parseFNDARecord(value string) (funcName string, hitCount uint64, err error)
 	return funcName, hitCount, nil
 }
 
-func parseBRDARecord(value string) (lineNo int, status BranchStatus, err error) {
+// parseFNLRecord parses a function leader record, which has the format
+// <index>,<start>[,<end>].  These records were added in lcov 2.x.
+func parseFNLRecord(value string) (index string, leader lcovLeader, err error) {
+	buffer := [4]string{}
+	values := splitOnComma(buffer[:], value)
+
+	if len(values) != 2 && len(values) != 3 {
+		return "", lcovLeader{}, fmt.Errorf("can't parse function leader record")
+	}
+
+	start, err := strconv.ParseInt(values[1], 10, 64)
+	if err != nil {
+		return "", lcovLeader{}, fmt.Errorf("can't parse function leader record: %s", err)
+	}
+	leader.StartLine = int(start)
+	if len(values) == 3 {
+		end, err := strconv.ParseInt(values[2], 10, 64)
+		if err != nil {
+			return "", lcovLeader{}, fmt.Errorf("can't parse function leader record: %s", err)
+		}
+		leader.EndLine = int(end)
+	}
+	return values[0], leader, nil
+}
+
+// parseFNARecord parses a function alias record, which has the format
+// <index>,<taken>,<name>.  The name is the remainder of the record, and can
+// contain commas.
+func parseFNARecord(value string) (index string, hitCount uint64, funcName string, err error) {
+	values := strings.SplitN(value, ",", 3)
+
+	if len(values) != 3 {
+		return "", 0, "", fmt.Errorf("can't parse function alias record")
+	}
+
+	hitCount, err = strconv.ParseUint(values[1], 10, 64)
+	if err != nil {
+		return "", 0, "", fmt.Errorf("can't parse function alias record: %s", err)
+	}
+	return values[0], hitCount, values[2], nil
+}
+
+// parseBRDARecord parses a branch record, which has the format
+// <line>,[e]<block>,<branch>,<taken>.  The optional 'e' marks branches taken
+// when an exception is thrown.  A count of '-' indicates that the block
+// containing the branch was never executed.
+func parseBRDARecord(value string) (lineNo int, data BranchData, err error) {
 	buffer := [4]string{}
 	values := splitOnComma(buffer[:], value)
 
 	if len(values) != 4 {
-		return 0, 0, fmt.Errorf("can't parse branch record")
+		return 0, BranchData{}, fmt.Errorf("can't parse branch record")
 	}
 
 	lineNoTmp, err := strconv.ParseInt(values[0], 10, 64)
 	if err != nil {
-		return 0, 0, fmt.Errorf("can't parse branch record: %s", err)
+		return 0, BranchData{}, fmt.Errorf("can't parse branch record: %s", err)
 	}
 	lineNo = int(lineNoTmp)
 
-	hitCount, err := strconv.ParseInt(values[3], 10, 64)
+	data = BranchData{Block: -1, Branch: -1}
+	block := values[1]
+	if strings.HasPrefix(block, "e") {
+		data.Throw = true
+		block = block[1:]
+	}
+	// Newer versions of lcov can use expressions to identify branches, so
+	// identifiers that are not numbers are not an error.
+	if tmp, err := strconv.ParseInt(block, 10, 32); err == nil {
+		data.Block = int(tmp)
+	}
+	if tmp, err := strconv.ParseInt(values[2], 10, 32); err == nil {
+		data.Branch = int(tmp)
+	}
+
+	if values[3] == "-" {
+		data.Status = BranchNotExec
+		return lineNo, data, nil
+	}
+
+	hitCount, err := strconv.ParseUint(values[3], 10, 64)
 	if err != nil {
-		return 0, 0, fmt.Errorf("can't parse branch record: %s", err)
+		return 0, BranchData{}, fmt.Errorf("can't parse branch record: %s", err)
 	}
 
+	data.Count = hitCount
+	data.HasCount = true
 	if hitCount > 0 {
-		return lineNo, BranchTaken, nil
+		data.Status = BranchTaken
+	} else {
+		data.Status = BranchNotTaken
 	}
-	return lineNo, BranchNotTaken, nil
+	return lineNo, data, nil
 }
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bytes"
+	"reflect"
 	"testing"
 )
 
@@ -12,7 +14,9 @@ func TestDARecord(t *testing.T) {
 		hitCount uint64
 	}{
 		{"DA:38,3", true, 38, 3},
+		{"DA:38,3,iHGQKZWSeRUSMdsNVe8lrQ", true, 38, 3},
 		{"DA:38", false, 0, 0},
+		{"DA:38,3,a,b", false, 0, 0},
 		{"DA:#,3", false, 0, 0},
 		{"DA:38,#", false, 0, 0},
 	}
@@ -46,10 +50,13 @@ func TestFNRecord(t *testing.T) {
 		ok       bool
 		funcName string
 		location int
+		endLine  int
 	}{
-		{"FN:38,gauss_get_sum", true, "gauss_get_sum", 38},
-		{"FN:3", false, "", 0},
-		{"FN:#,gauss_get_sum", false, "", 0},
+		{"FN:38,gauss_get_sum", true, "gauss_get_sum", 38, 0},
+		{"FN:38,44,gauss_get_sum", true, "gauss_get_sum", 38, 44},
+		{"FN:3", false, "", 0, 0},
+		{"FN:#,gauss_get_sum", false, "", 0, 0},
+		{"FN:38,#,gauss_get_sum", false, "", 0, 0},
 	}
 
 	for _, v := range cases {
@@ -58,13 +65,16 @@ func TestFNRecord(t *testing.T) {
 			if rt != "FN" {
 				LogNE(t, "record type", "FN", rt)
 			}
-			funcName, location, err := parseFNRecord(value)
+			funcName, location, endLine, err := parseFNRecord(value)
 			if funcName != v.funcName {
 				LogNE(t, "function name", v.funcName, funcName)
 			}
 			if location != v.location {
 				LogNE(t, "hit count", v.location, location)
 			}
+			if endLine != v.endLine {
+				LogNE(t, "end line", v.endLine, endLine)
+			}
 			if (err == nil) != v.ok {
 				LogNE(t, "ok", v.ok, err == nil)
 				if err != nil {
@@ -115,13 +125,16 @@ func TestBRDARecord(t *testing.T) {
 		value  string
 		ok     bool
 		lineNo int
-		status BranchStatus
+		data   BranchData
 	}{
-		{"BRDA:42,0,0,0", true, 42, BranchNotTaken},
-		{"BRDA:42,0,1,3", true, 42, BranchTaken},
-		{"BRDA:42,0,1", false, 0, 0},
-		{"BRDA:#,0,0,0", false, 0, 0},
-		{"BRDA:42,0,0,#", false, 0, 0},
+		{"BRDA:42,0,0,0", true, 42, BranchData{Status: BranchNotTaken, HasCount: true, Block: 0, Branch: 0}},
+		{"BRDA:42,0,1,3", true, 42, BranchData{Status: BranchTaken, Count: 3, HasCount: true, Block: 0, Branch: 1}},
+		{"BRDA:42,2,1,-", true, 42, BranchData{Status: BranchNotExec, Block: 2, Branch: 1}},
+		{"BRDA:42,e1,0,1", true, 42, BranchData{Status: BranchTaken, Count: 1, HasCount: true, Block: 1, Branch: 0, Throw: true}},
+		{"BRDA:42,0,a == b,1", true, 42, BranchData{Status: BranchTaken, Count: 1, HasCount: true, Block: 0, Branch: -1}},
+		{"BRDA:42,0,1", false, 0, BranchData{}},
+		{"BRDA:#,0,0,0", false, 0, BranchData{}},
+		{"BRDA:42,0,0,#", false, 0, BranchData{}},
 	}
 
 	for _, v := range cases {
@@ -130,12 +143,89 @@ func TestBRDARecord(t *testing.T) {
 			if rt != "BRDA" {
 				LogNE(t, "record type", "BRDA", rt)
 			}
-			lineNo, status, err := parseBRDARecord(value)
+			lineNo, data, err := parseBRDARecord(value)
 			if lineNo != v.lineNo {
 				LogNE(t, "line number", v.lineNo, lineNo)
 			}
-			if status != v.status {
-				LogNE(t, "branch status", v.status, status)
+			if data != v.data {
+				LogNE(t, "branch data", v.data, data)
+			}
+			if (err == nil) != v.ok {
+				LogNE(t, "ok", v.ok, err == nil)
+				if err != nil {
+					t.Logf("err = %s", err)
+				}
+			}
+		})
+	}
+}
+
+func TestFNLRecord(t *testing.T) {
+	cases := []struct {
+		value  string
+		ok     bool
+		index  string
+		leader lcovLeader
+	}{
+		{"FNL:0,38", true, "0", lcovLeader{38, 0}},
+		{"FNL:1,38,44", true, "1", lcovLeader{38, 44}},
+		{"FNL:1", false, "", lcovLeader{}},
+		{"FNL:1,#", false, "", lcovLeader{}},
+		{"FNL:1,38,#", false, "", lcovLeader{}},
+	}
+
+	for _, v := range cases {
+		t.Run(v.value, func(t *testing.T) {
+			rt, value := recordType(v.value)
+			if rt != "FNL" {
+				LogNE(t, "record type", "FNL", rt)
+			}
+			index, leader, err := parseFNLRecord(value)
+			if index != v.index {
+				LogNE(t, "index", v.index, index)
+			}
+			if leader != v.leader {
+				LogNE(t, "leader", v.leader, leader)
+			}
+			if (err == nil) != v.ok {
+				LogNE(t, "ok", v.ok, err == nil)
+				if err != nil {
+					t.Logf("err = %s", err)
+				}
+			}
+		})
+	}
+}
+
+func TestFNARecord(t *testing.T) {
+	cases := []struct {
+		value    string
+		ok       bool
+		index    string
+		hitCount uint64
+		funcName string
+	}{
+		{"FNA:0,3,gauss_get_sum", true, "0", 3, "gauss_get_sum"},
+		{"FNA:1,0,std::pair<int, int> swap(std::pair<int, int>)", true, "1", 0, "std::pair<int, int> swap(std::pair<int, int>)"},
+		{"FNA:1,3", false, "", 0, ""},
+		{"FNA:1,#,gauss_get_sum", false, "", 0, ""},
+	}
+
+	for _, v := range cases {
+		t.Run(v.value, func(t *testing.T) {
+			rt, value := recordType(v.value)
+			if rt != "FNA" {
+				LogNE(t, "record type", "FNA", rt)
+			}
+			index, hc, funcName, err := parseFNARecord(value)
+			if index != v.index {
+				LogNE(t, "index", v.index, index)
+			}
+			if hc != v.hitCount {
+				LogNE(t, "hit count", v.hitCount, hc)
+			}
+			if funcName != v.funcName {
+				LogNE(t, "function name", v.funcName, funcName)
 			}
 			if (err == nil) != v.ok {
 				LogNE(t, "ok", v.ok, err == nil)
@@ -146,3 +236,56 @@ func TestBRDARecord(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadLCovFileFunctionAliases(t *testing.T) {
+	const value = "SF:a.cpp\nFNL:0,3,9\nFNA:0,2,swap<int, int>\nFNA:0,1,swap<long, long>\nFNL:1,12\nFNA:1,0,unused\nFNA:2,1,missing\nend_of_record\n"
+
+	fds := make(FileDataSet)
+	err := loadLCovString(fds, value, loadOptions{})
+	if err == nil || err.Error() != "input:7: can't parse function alias record: unknown index 2" {
+		LogNE(t, "error", "input:7: can't parse function alias record: unknown index 2", err)
+	}
+
+	expected := map[string]FuncData{
+		"swap<int, int>":   {StartLine: 3, EndLine: 9, HitCount: 2},
+		"swap<long, long>": {StartLine: 3, EndLine: 9, HitCount: 1},
+		"unused":           {StartLine: 12},
+	}
+	if got := fds["a.cpp"].FuncData; !reflect.DeepEqual(got, expected) {
+		LogNE(t, "function data", expected, got)
+	}
+}
+
+func TestLoadLCovFileValidate(t *testing.T) {
+	const section = "SF:a.c\nFN:1,main\nFN:5,unused\nFNDA:1,main\nFNDA:0,unused\nDA:1,1\nDA:2,0\nDA:2,0\nBRDA:1,0,0,1\nBRDA:1,0,1,0\nBRDA:2,0,0,-\n"
+
+	cases := []struct {
+		name     string
+		value    string
+		warnings string
+	}{
+		{"match", section + "FNF:2\nFNH:1\nLF:2\nLH:1\nBRF:3\nBRH:1\nend_of_record\n", ""},
+		{"missing", section + "end_of_record\n", ""},
+		{"mismatch", section + "FNF:2\nFNH:2\nLF:2\nLH:1\nBRF:4\nBRH:1\nend_of_record\n",
+			"warning: input:18: a.c: FNH record gives 2, but the data records give 1\n" +
+				"warning: input:18: a.c: BRF record gives 4, but the data records give 3\n"},
+		{"truncated", section + "LF:2\nLH:1\n",
+			"warning: input:13: missing end_of_record for a.c\n"},
+		{"no-end", section + section + "end_of_record\n",
+			"warning: input:12: missing end_of_record for a.c\n"},
+		{"aliases", "SF:a.cpp\nFNL:0,3\nFNA:0,2,f<int>\nFNA:0,1,f<long>\nFNL:1,9\nFNA:1,0,g\nFNF:2\nFNH:1\nend_of_record\n", ""},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(t *testing.T) {
+			warnings := bytes.NewBuffer(nil)
+			err := loadLCovString(make(FileDataSet), v.value, loadOptions{warnings: warnings, validate: true})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := warnings.String(); got != v.warnings {
+				LogNE(t, "warnings", v.warnings, got)
+			}
+		})
+	}
+}
@@ -2,9 +2,8 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
 	"errors"
-	"io"
+	"fmt"
 	"strconv"
 )
 
@@ -106,42 +105,52 @@ func (s *LLVMSegment) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-func loadLLVMFile(fds FileDataSet, file io.Reader) error {
-	data := LLVMData{}
-
-	err := json.NewDecoder(file).Decode(&data)
-	if err != nil {
-		return err
-	}
-
+// loadLLVMData loads the coverage data from the export from llvm-cov.  The
+// name identifies the export in errors and warnings.
+func loadLLVMData(fds FileDataSet, data *LLVMData, name string, opts loadOptions) error {
 	if data.Type != "llvm.coverage.json.export" {
-		return errors.New("incorrect type for JSON data from LLVM: " + data.Type)
+		return fmt.Errorf("%s: incorrect type for JSON data from LLVM: %s", name, data.Type)
 	}
 
+	skipped := 0
 	for _, v := range data.Data {
 		for _, w := range v.Files {
-			currentData := fds.FileData(w.Filename)
-
-			for i := range w.Segments[:len(w.Segments)-1] {
-				hasCount := w.Segments[i].HasCount
-				isRegionEntry := w.Segments[i].IsRegionEntry
-
-				if isRegionEntry && hasCount {
-					currentData.AppendRegionData(
-						w.Segments[i].Line,
-						w.Segments[i].Column,
-						w.Segments[i+1].Line,
-						w.Segments[i+1].Column,
-						uint64(w.Segments[i].Count),
-					)
-				}
-			}
+			appendLLVMSegments(fds.FileData(w.Filename), w.Segments)
 		}
 		for _, w := range v.Functions {
+			if len(w.Filenames) == 0 || len(w.Regions) == 0 || len(w.Regions[0]) < 3 {
+				if opts.mode != ParseLenient {
+					return fmt.Errorf("%s: missing filenames or regions for function %s", name, w.Name)
+				}
+				skipped++
+				continue
+			}
+
 			currentData := fds.FileData(w.Filenames[0])
-			currentData.AppendFunctionData(w.Name, w.Regions[0][0], w.Count)
+			// The first region covers the body of the function.
+			currentData.AppendFunctionData(demangleRust(w.Name), w.Regions[0][0], w.Regions[0][2], w.Count)
 		}
 	}
+	if skipped > 0 {
+		opts.warnf("%s: skipped %d bad records", name, skipped)
+	}
 
 	return nil
 }
+
+// appendLLVMSegments adds the region data for a list of segments.  Each
+// segment that starts a region with a count creates a region that continues
+// until the next segment.
+func appendLLVMSegments(currentData *FileData, segments []LLVMSegment) {
+	for i := 1; i < len(segments); i++ {
+		if prev := segments[i-1]; prev.IsRegionEntry && prev.HasCount {
+			currentData.AppendRegionData(
+				prev.Line,
+				prev.Column,
+				segments[i].Line,
+				segments[i].Column,
+				prev.Count,
+			)
+		}
+	}
+}
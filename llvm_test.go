@@ -18,7 +18,7 @@ func TestLoadLLVMFile(t *testing.T) {
 	for _, v := range cases {
 		t.Run(v.value, func(t *testing.T) {
 			fds := make(FileDataSet)
-			err := loadLLVMFile(fds, strings.NewReader(v.value))
+			err := loadJSONFile(fds, strings.NewReader(v.value), loadOptions{})
 			if ok := err == nil; ok != v.ok {
 				if err != nil {
 					t.Logf("error: %s", err)
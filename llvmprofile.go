@@ -0,0 +1,480 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// Magic numbers and flags used in the profiles written by clang and rustc.
+const (
+	llvmRawMagic64   = 0xff6c70726f667281 // "\xfflprofr\x81"
+	llvmRawMagic32   = 0xff6c70726f665281 // "\xfflprofR\x81"
+	llvmIndexedMagic = 0x8169666f72706cff // "\xfflprofi\x81"
+
+	llvmVariantCSIR         = 1 << 57
+	llvmVariantByteCoverage = 1 << 60
+)
+
+var errLLVMProfileTruncated = errors.New("unexpected end of profile data")
+
+// llvmProfileKey identifies a function in a profile.  The name is identified
+// by the MD5 hash of the function's name, and the hash of the function's
+// structure is used to identify stale data.
+type llvmProfileKey struct {
+	NameRef  uint64
+	FuncHash uint64
+}
+
+// llvmProfile contains the counters for functions from one or more profiles.
+// Profiles are merged by adding the counters.
+type llvmProfile struct {
+	counts map[llvmProfileKey][]uint64
+	names  map[uint64]bool
+}
+
+func (p *llvmProfile) empty() bool {
+	return len(p.counts) == 0
+}
+
+// lookup returns the counters for a function.  The second return is false
+// if the function is not present in the profile, and an error is returned if
+// the function is present, but with a different structural hash.
+func (p *llvmProfile) lookup(nameRef, funcHash uint64) ([]uint64, bool, error) {
+	if counts, ok := p.counts[llvmProfileKey{nameRef, funcHash}]; ok {
+		return counts, true, nil
+	}
+	if p.names[nameRef] {
+		return nil, false, errors.New("hash mismatch")
+	}
+	return nil, false, nil
+}
+
+func (p *llvmProfile) add(nameRef, funcHash uint64, counts []uint64) error {
+	if p.counts == nil {
+		p.counts = make(map[llvmProfileKey][]uint64)
+		p.names = make(map[uint64]bool)
+	}
+
+	key := llvmProfileKey{nameRef, funcHash}
+	p.names[nameRef] = true
+	prev, ok := p.counts[key]
+	if !ok {
+		p.counts[key] = append([]uint64(nil), counts...)
+		return nil
+	}
+	if len(prev) != len(counts) {
+		return errors.New("number of counters for function does not match")
+	}
+	for i, v := range counts {
+		prev[i] += v
+	}
+	return nil
+}
+
+// loadFile reads a raw (.profraw) or indexed (.profdata) profile, and merges
+// the counters into the profile.  The format is identified by the magic
+// number.
+func (p *llvmProfile) loadFile(file *os.File) error {
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	err = p.load(data)
+	if err != nil {
+		return fmt.Errorf("%s: %s", file.Name(), err)
+	}
+	return nil
+}
+
+func (p *llvmProfile) load(data []byte) error {
+	if len(data) < 8 {
+		return errLLVMProfileTruncated
+	}
+
+	le, be := binary.LittleEndian.Uint64(data), binary.BigEndian.Uint64(data)
+	switch {
+	case le == llvmRawMagic64:
+		return p.loadRaw(data, binary.LittleEndian)
+	case be == llvmRawMagic64:
+		return p.loadRaw(data, binary.BigEndian)
+	case le == llvmRawMagic32 || be == llvmRawMagic32:
+		return errors.New("raw profiles from 32-bit targets are not supported")
+	case le == llvmIndexedMagic:
+		return p.loadIndexed(data)
+	}
+	return errors.New("bad magic number")
+}
+
+// llvmRawHeader is the header of a raw profile.  Fields are added to the
+// header as the version increases, and fields that are not present are zero.
+type llvmRawHeader struct {
+	Version                      uint64
+	BinaryIdsSize                uint64
+	NumData                      uint64
+	PaddingBytesBeforeCounters   uint64
+	NumCounters                  uint64
+	PaddingBytesAfterCounters    uint64
+	NumBitmapBytes               uint64
+	PaddingBytesAfterBitmapBytes uint64
+	NamesSize                    uint64
+	CountersDelta                uint64
+	BitmapDelta                  uint64
+	NamesDelta                   uint64
+	NumVTables                   uint64
+	VNamesSize                   uint64
+	ValueKindLast                uint64
+}
+
+// loadRaw reads a raw profile.  Versions 8 to 10 are supported, which are
+// written by LLVM 14 and later.  A raw profile may contain several profiles
+// back to back.
+func (p *llvmProfile) loadRaw(data []byte, order binary.ByteOrder) error {
+	for len(data) >= 8 && order.Uint64(data) == llvmRawMagic64 {
+		n, err := p.loadRawProfile(data, order)
+		if err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+func (p *llvmProfile) loadRawProfile(data []byte, order binary.ByteOrder) (int, error) {
+	pos := 8
+	word := func() uint64 {
+		if pos+8 > len(data) {
+			pos = len(data) + 1
+			return 0
+		}
+		v := order.Uint64(data[pos:])
+		pos += 8
+		return v
+	}
+
+	h := llvmRawHeader{Version: word()}
+	version := h.Version & 0xffffffff
+	if version < 8 || version > 10 {
+		return 0, fmt.Errorf("unsupported version of raw profile: %d", version)
+	}
+	h.BinaryIdsSize = word()
+	h.NumData = word()
+	h.PaddingBytesBeforeCounters = word()
+	h.NumCounters = word()
+	h.PaddingBytesAfterCounters = word()
+	if version >= 9 {
+		h.NumBitmapBytes = word()
+		h.PaddingBytesAfterBitmapBytes = word()
+	}
+	h.NamesSize = word()
+	h.CountersDelta = word()
+	if version >= 9 {
+		h.BitmapDelta = word()
+	}
+	h.NamesDelta = word()
+	if version >= 10 {
+		h.NumVTables = word()
+		h.VNamesSize = word()
+	}
+	h.ValueKindLast = word()
+	if pos > len(data) {
+		return 0, errLLVMProfileTruncated
+	}
+
+	// The data records are followed by the counters.  Starting with version
+	// 9, records include a pointer to and the size of the bitmap for MC/DC.
+	pointers := 3
+	if version >= 9 {
+		pointers = 4
+	}
+	recordSize := 16 + 8*pointers + 4 + 2*int(h.ValueKindLast+1)
+	if version >= 9 {
+		recordSize += 4
+	}
+	recordSize = alignTo8(recordSize)
+
+	counterSize := 8
+	if h.Version&llvmVariantByteCoverage != 0 {
+		counterSize = 1
+	}
+
+	dataStart := pos + int(h.BinaryIdsSize)
+	countersStart := dataStart + int(h.NumData)*recordSize + int(h.PaddingBytesBeforeCounters)
+	countersEnd := countersStart + int(h.NumCounters)*counterSize
+	namesStart := countersEnd + int(h.PaddingBytesAfterCounters) + int(h.NumBitmapBytes) + int(h.PaddingBytesAfterBitmapBytes)
+	end := namesStart + alignTo8(int(h.NamesSize))
+	end += int(h.NumVTables)*24 + alignTo8(int(h.VNamesSize))
+	if h.BinaryIdsSize > uint64(len(data)) || h.NumData > uint64(len(data)) || h.NumCounters > uint64(len(data)) || end > len(data) {
+		return 0, errLLVMProfileTruncated
+	}
+
+	valueSites := false
+	counts := []uint64(nil)
+	for i := 0; i < int(h.NumData); i++ {
+		record := data[dataStart+i*recordSize:]
+		nameRef := order.Uint64(record)
+		funcHash := order.Uint64(record[8:])
+		counterPtr := order.Uint64(record[16:])
+		numCounters := int(order.Uint32(record[16+8*pointers:]))
+		for j := 0; j <= int(h.ValueKindLast); j++ {
+			if order.Uint16(record[16+8*pointers+4+2*j:]) != 0 {
+				valueSites = true
+			}
+		}
+
+		// The pointer to the counters is relative to the record.
+		offset := int64(counterPtr - h.CountersDelta + uint64(i*recordSize))
+		if offset < 0 || offset%int64(counterSize) != 0 || countersStart+int(offset)+numCounters*counterSize > countersEnd {
+			return 0, errors.New("counters out of range in raw profile")
+		}
+
+		counts = counts[:0]
+		for j := 0; j < numCounters; j++ {
+			ptr := countersStart + int(offset) + j*counterSize
+			if counterSize == 1 {
+				// For single byte coverage, zero indicates that the
+				// counter was executed.
+				if data[ptr] == 0 {
+					counts = append(counts, 1)
+				} else {
+					counts = append(counts, 0)
+				}
+			} else {
+				counts = append(counts, order.Uint64(data[ptr:]))
+			}
+		}
+		if err := p.add(nameRef, funcHash, counts); err != nil {
+			return 0, err
+		}
+	}
+
+	// Value profiling data follows the names, but its size is not recorded
+	// in the header.  Only the first profile can be read if it is present.
+	if valueSites {
+		return len(data), nil
+	}
+	return end, nil
+}
+
+// loadIndexed reads an indexed profile, which is written by llvm-profdata.
+// Versions 5 to 12 are supported, which are written by LLVM 6 and later.
+// The profile is a hash table, keyed by the function's name.
+func (p *llvmProfile) loadIndexed(data []byte) error {
+	le := binary.LittleEndian
+	if len(data) < 40 {
+		return errLLVMProfileTruncated
+	}
+	rawVersion := le.Uint64(data[8:])
+	version := rawVersion & 0xffffffff
+	if version < 5 || version > 12 {
+		return fmt.Errorf("unsupported version of indexed profile: %d", version)
+	}
+	if hashType := le.Uint64(data[24:]); hashType != 0 {
+		return fmt.Errorf("unsupported hash type in indexed profile: %d", hashType)
+	}
+	hashOffset := le.Uint64(data[32:])
+
+	// Skip the remainder of the header, and the summaries.
+	pos := 40
+	for _, v := range []uint64{8, 9, 10, 12} {
+		if version >= v {
+			pos += 8
+		}
+	}
+	summaries := 1
+	if rawVersion&llvmVariantCSIR != 0 {
+		summaries = 2
+	}
+	for i := 0; i < summaries; i++ {
+		if pos+16 > len(data) {
+			return errLLVMProfileTruncated
+		}
+		fields := le.Uint64(data[pos:])
+		entries := le.Uint64(data[pos+8:])
+		if fields > uint64(len(data)) || entries > uint64(len(data)) {
+			return errLLVMProfileTruncated
+		}
+		pos += 16 + 8*int(fields) + 24*int(entries)
+	}
+
+	if hashOffset > uint64(len(data)-16) {
+		return errLLVMProfileTruncated
+	}
+	numEntries := le.Uint64(data[hashOffset+8:])
+
+	// The buckets of the hash table are written in sequence, so the entries
+	// can be read without using the table.
+	r := bytes.NewReader(data[pos:hashOffset])
+	read := func(v interface{}) error {
+		err := binary.Read(r, le, v)
+		if err != nil {
+			return errLLVMProfileTruncated
+		}
+		return nil
+	}
+	for numEntries > 0 {
+		var count uint16
+		if err := read(&count); err != nil {
+			return err
+		}
+		if count == 0 || uint64(count) > numEntries {
+			return errors.New("bad bucket in indexed profile")
+		}
+		numEntries -= uint64(count)
+
+		for ; count > 0; count-- {
+			var header struct{ Hash, KeyLen, DataLen uint64 }
+			if err := read(&header); err != nil {
+				return err
+			}
+			if header.KeyLen > uint64(r.Len()) || header.DataLen > uint64(r.Len())-header.KeyLen {
+				return errLLVMProfileTruncated
+			}
+			key := make([]byte, header.KeyLen)
+			r.Read(key)
+			value := make([]byte, header.DataLen)
+			r.Read(value)
+
+			err := p.loadIndexedRecords(llvmNameRef(string(key)), value, version)
+			if err != nil {
+				return fmt.Errorf("%s: %s", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// loadIndexedRecords reads the records for a function name.  There may be
+// several records with different structural hashes.
+func (p *llvmProfile) loadIndexedRecords(nameRef uint64, data []byte, version uint64) error {
+	le := binary.LittleEndian
+	next := func() (uint64, error) {
+		if len(data) < 8 {
+			return 0, errLLVMProfileTruncated
+		}
+		v := le.Uint64(data)
+		data = data[8:]
+		return v, nil
+	}
+
+	for len(data) > 0 {
+		funcHash, err := next()
+		if err != nil {
+			return err
+		}
+		numCounts, err := next()
+		if err != nil {
+			return err
+		}
+		if numCounts > uint64(len(data)/8) {
+			return errLLVMProfileTruncated
+		}
+		counts := make([]uint64, numCounts)
+		for i := range counts {
+			counts[i], _ = next()
+		}
+
+		// Starting with version 11, records include the bitmap for MC/DC,
+		// with each byte stored as a word.
+		if version >= 11 {
+			numBytes, err := next()
+			if err != nil {
+				return err
+			}
+			if numBytes > uint64(len(data)/8) {
+				return errLLVMProfileTruncated
+			}
+			data = data[8*numBytes:]
+		}
+
+		// Skip the value profiling data.
+		if len(data) < 4 {
+			return errLLVMProfileTruncated
+		}
+		size := le.Uint32(data)
+		if uint64(size) > uint64(len(data)) {
+			return errLLVMProfileTruncated
+		}
+		data = data[size:]
+
+		if err := p.add(nameRef, funcHash, counts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// llvmNameRef computes the reference for a function's name, which is the
+// lower half of the MD5 hash.
+func llvmNameRef(name string) uint64 {
+	sum := md5.Sum([]byte(name))
+	return binary.LittleEndian.Uint64(sum[:])
+}
+
+// readLLVMNames reads the names of functions, which are stored in the binary
+// and in raw profiles.  The names are stored in chunks, which may be
+// compressed, and the names within a chunk are separated by \x01.
+func readLLVMNames(data []byte) ([]string, error) {
+	out := []string(nil)
+
+	for len(data) > 0 {
+		// The chunks are padded with zeros.
+		if data[0] == 0 && bytes.Count(data, []byte{0}) == len(data) {
+			break
+		}
+
+		r := covReader{data: data}
+		uncompressedSize := r.uleb128()
+		compressedSize := r.uleb128()
+		if r.err != nil {
+			return nil, r.err
+		}
+
+		var chunk []byte
+		if compressedSize == 0 {
+			chunk = r.bytes(uncompressedSize)
+		} else {
+			tmp, err := zlibDecompress(r.bytes(compressedSize), uncompressedSize)
+			if err != nil {
+				return nil, err
+			}
+			chunk = tmp
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+
+		for _, v := range bytes.Split(chunk, []byte{1}) {
+			out = append(out, string(v))
+		}
+		data = data[r.pos:]
+	}
+	return out, nil
+}
+
+func zlibDecompress(data []byte, size uint64) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	out, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(out)) != size {
+		return nil, errors.New("unexpected size for compressed data")
+	}
+	return out, nil
+}
+
+func alignTo8(n int) int {
+	return (n + 7) &^ 7
+}
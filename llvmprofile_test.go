@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func loadLLVMProfileForTest(t *testing.T, filenames ...string) *llvmProfile {
+	profile := &llvmProfile{}
+	for _, v := range filenames {
+		file, err := os.Open(filepath.Join("./testdata/example-rustc-1.90.0", v))
+		if err != nil {
+			t.Fatalf("could not open file: %s", err)
+		}
+		err = profile.loadFile(file)
+		file.Close()
+		if err != nil {
+			t.Fatalf("could not load file: %s", err)
+		}
+	}
+	return profile
+}
+
+func TestLLVMProfileLoadFile(t *testing.T) {
+	raw := loadLLVMProfileForTest(t, "a.profraw", "b.profraw")
+	indexed := loadLLVMProfileForTest(t, "merged.profdata")
+
+	if len(raw.counts) != 5 {
+		LogNE(t, "function count", 5, len(raw.counts))
+	}
+	if !reflect.DeepEqual(raw.counts, indexed.counts) {
+		t.Errorf("raw and indexed profiles do not match")
+	}
+
+	nameRef := llvmNameRef("_RNvCsiTHC7ExSeJm_4main4main")
+	counts, ok, err := raw.lookup(nameRef, 13296753716264188748)
+	if !ok || err != nil {
+		t.Fatalf("missing counters for main")
+	}
+	if expected := []uint64{2, 42, 22, 0}; !reflect.DeepEqual(counts, expected) {
+		LogNE(t, "counters", expected, counts)
+	}
+	if _, ok, err := raw.lookup(nameRef, 1); ok || err == nil {
+		t.Errorf("expected hash mismatch")
+	}
+	if _, ok, err := raw.lookup(llvmNameRef("missing"), 1); ok || err != nil {
+		t.Errorf("unexpected result for missing function")
+	}
+}
+
+func TestLLVMProfileLoadErrors(t *testing.T) {
+	data, err := ioutil.ReadFile("./testdata/example-rustc-1.90.0/a.profraw")
+	if err != nil {
+		t.Fatalf("could not read file: %s", err)
+	}
+	indexed, err := ioutil.ReadFile("./testdata/example-rustc-1.90.0/merged.profdata")
+	if err != nil {
+		t.Fatalf("could not read file: %s", err)
+	}
+
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"magic", []byte("\xfflprofx\x81\x00\x00\x00\x00")},
+		{"32-bit", []byte("\x81Rforpl\xff\x00\x00\x00\x00")},
+		{"raw-header", data[:40]},
+		{"raw-truncated", data[:len(data)-16]},
+		{"indexed-header", indexed[:40]},
+		{"indexed-truncated", indexed[:len(indexed)/2]},
+	}
+	for _, v := range cases {
+		t.Run(v.name, func(t *testing.T) {
+			p := llvmProfile{}
+			if err := p.load(v.data); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
+
+func TestLLVMNameRef(t *testing.T) {
+	if got := llvmNameRef("main"); got != 0xdb956436e78dd5fa {
+		LogNE(t, "name ref", uint64(0xdb956436e78dd5fa), got)
+	}
+}
+
+func TestReadLLVMNames(t *testing.T) {
+	compressed := bytes.Buffer{}
+	w := zlib.NewWriter(&compressed)
+	w.Write([]byte("foo\x01bar"))
+	w.Close()
+
+	cases := []struct {
+		name     string
+		data     []byte
+		expected []string
+		ok       bool
+	}{
+		{"empty", nil, nil, true},
+		{"plain", []byte("\x07\x00foo\x01bar\x00\x00"), []string{"foo", "bar"}, true},
+		{"compressed", append([]byte{7, byte(compressed.Len())}, compressed.Bytes()...), []string{"foo", "bar"}, true},
+		{"chunks", []byte("\x03\x00foo\x03\x00bar"), []string{"foo", "bar"}, true},
+		{"truncated", []byte("\x08\x00foo\x01bar"), nil, false},
+		{"bad-size", append([]byte{8, byte(compressed.Len())}, compressed.Bytes()...), nil, false},
+	}
+	for _, v := range cases {
+		t.Run(v.name, func(t *testing.T) {
+			got, err := readLLVMNames(v.data)
+			if !v.ok {
+				if err == nil {
+					t.Errorf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, v.expected) {
+				LogNE(t, "names", v.expected, got)
+			}
+		})
+	}
+}
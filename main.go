@@ -12,17 +12,48 @@ import (
 
 var (
 	help       = flag.Bool("h", false, "Request help")
+	badgefile  = flag.String("badge", "", "Filename for an SVG badge with the coverage, use - to direct the badge to stdout")
+	badgedir   = flag.String("badgedir", "", "Path for SVG badges and shields.io endpoints for the report, each component, and each directory")
+	badgejson  = flag.String("badgejson", "", "Filename for a shields.io endpoint with the coverage, use - to direct the endpoint to stdout")
+	badgemet   = flag.String("badgemetric", "lines", "Metric shown in badges, one of lines, functions, branches, or regions")
 	version    = flag.Bool("v", false, "Request version information")
 	external   = flag.Bool("external", false, "Set whether external files to be included")
+	codeowners = flag.String("codeowners", "", "Path to a CODEOWNERS file, to report coverage by owner")
+	components = flag.String("components", "", "Path to a file mapping source files to components")
+	parsing    = flag.String("parse", "default", "Handling of bad records in coverage data, one of default, lenient, or strict")
+	validate   = flag.Bool("validate", false, "Check the summary records in tracefiles against the data records")
+	objects    = flag.String("object", "", "List of instrumented binaries with the coverage mapping for profiles from clang or rustc")
 	exclude    = flag.String("exclude", "", "Exclude source files that match the regular expression")
+	uninstr    = flag.String("uninstrumented", "", "Comma separated list of patterns for source files to report at 0% if they have no coverage data")
 	srcdir     = flag.String("srcdir", ".", "Path for the source directory")
+	srcpath    = flag.String("srcpath", "", "List of additional directories to search for source files")
+	stream     = flag.Bool("stream", false, "Calculate statistics while loading data, only summary reports are available")
 	srcid      = flag.String("srcid", "", "String to identify revision of source")
 	testid     = flag.String("testid", "", "String to identify the test suite")
 	title      = flag.String("title", "SCov", "Title for the HTML pages")
+	heatmap    = flag.Bool("heatmap", false, "Colour executed lines in the HTML report by hit count, and list the hottest lines and functions")
+	hotcount   = flag.Int("hotcount", 10, "Number of lines and functions listed as hotspots")
+	hotspots   = flag.String("hotspots", "", "Filename for a report of the lines and functions with the highest hit counts, use - to direct the report to stdout")
+	history    = flag.String("history", "", "Filename for the history of coverage summaries, the summary for this run is appended")
+	histimport = flag.String("historyimport", "", "List of JSON reports to import into the history")
+	histkeep   = flag.Int("historykeep", 0, "Number of runs to keep in the history (default keep all)")
+	histruns   = flag.Int("historyruns", 10, "Number of runs shown in the trend chart and the history report")
+	histtext   = flag.String("historytext", "", "Filename for a text report of the recent runs, use - to direct the report to stdout")
+	ratings    = flag.String("ratings", "", "Comma separated list of rating bands as name:threshold[:colour], from highest to lowest (default high:90,medium:75,low:0)")
+	lratings   = flag.String("lineratings", "", "Rating bands for line coverage, overrides -ratings")
+	fratings   = flag.String("funcratings", "", "Rating bands for function coverage, overrides -ratings")
+	bratings   = flag.String("branchratings", "", "Rating bands for branch coverage, overrides -ratings")
+	rratings   = flag.String("regionratings", "", "Rating bands for region coverage, overrides -ratings")
 	htmldir    = flag.String("htmldir", ".", "Path for the HTML output")
 	htmljs     = flag.Bool("htmljs", false, "Use javascript to enhance reports")
+	htmljobs   = flag.Int("htmljobs", 0, "Number of source pages to render in parallel (default number of CPUs)")
+	skipmiss   = flag.Bool("skipmissing", false, "Skip source files that can not be found, instead of writing a summary page")
+	jsonfile   = flag.String("json", "", "Filename for JSON summary report, use - to direct report to stdout")
+	lowmem     = flag.Bool("lowmem", false, "Use a compact representation for the coverage data to reduce memory use")
 	markdown   = flag.String("markdown", "", "Filename for markdown report, use - to direct report to stdout")
+	mddirs     = flag.Bool("mddirs", false, "Include coverage by directory in the markdown report")
 	text       = flag.String("text", "", "Filename for text report, use - to direct the report to stdout")
+	textdepth  = flag.Int("textdepth", 0, "Depth limit for directories in the text report, deeper files are rolled up")
 	projecturl = flag.String("url", "", "URL for the project")
 )
 
@@ -36,43 +67,112 @@ func main() {
 		os.Exit(0)
 	}
 
-	// Initialize global maps used to track line and function coverage
-	fileData := make(FileDataSet)
+	if _, ok := badgeLabels[*badgemet]; !ok {
+		fmt.Fprintf(os.Stderr, "error: unknown metric for badges: %s\n", *badgemet)
+		os.Exit(1)
+	}
+	mode, ok := parseModes[*parsing]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "error: unknown parse mode: %s\n", *parsing)
+		os.Exit(1)
+	}
+	if *hotcount < 0 {
+		fmt.Fprintf(os.Stderr, "error: number of hotspots can't be negative: %d\n", *hotcount)
+		os.Exit(1)
+	}
+	ratingSchemes, err := parseRatings(*ratings, *lratings, *fratings, *bratings, *rratings)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+
+	opts := loadOptions{
+		objects:  splitList(*objects),
+		mode:     mode,
+		warnings: os.Stderr,
+		validate: *validate,
+	}
+	filter := newFileFilter(os.Stderr, *srcdir, splitList(*srcpath), *external, *exclude, splitPatterns(*uninstr))
+
+	// Load the data and calculate statistics
+	report := NewReport(*title)
+	report.Hotspots = *hotcount
+	report.Ratings = ratingSchemes
+	source := fileDataSource(nil)
+	switch {
+	case *stream:
+		if isFlagSet("htmldir") {
+			fmt.Fprintf(os.Stderr, "error: HTML report is not available when streaming\n")
+			os.Exit(1)
+		}
+		*htmldir = ""
+
+		err := streamStatistics(report, flag.Args(), opts, filter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: could not load data: %s\n", err)
+			os.Exit(1)
+		}
 
-	for _, name := range flag.Args() {
-		err := loadFile(fileData, name)
+	case *lowmem:
+		fileData, err := loadCompactFileData(flag.Args(), opts, filter)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error: could not load data: %s\n", err)
 			os.Exit(1)
 		}
+		report.CollectCompactStatistics(fileData)
+		source = fileData
+
+	default:
+		fileData, err := loadFileData(flag.Args(), opts, filter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: could not load data: %s\n", err)
+			os.Exit(1)
+		}
+		fileData.ConvertRegionToCodeLines(filter.codeLines)
+		report.CollectStatistics(fileData)
+		source = fileData
 	}
-	fileData, err := normalizeSourceFilenames(fileData, *srcdir)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+	if len(report.Files) == 0 {
+		fmt.Fprintf(os.Stderr, "error: no file data present\n")
 		os.Exit(1)
 	}
-	fileData = filterExternalFileData(fileData, *external)
-	fileData = filterExcludedFileData(os.Stderr, fileData, *exclude)
-	if len(fileData) == 0 {
-		fmt.Fprintf(os.Stderr, "error: no file data present\n")
+
+	err = collectGroups(report, *components, *codeowners)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
 		os.Exit(1)
 	}
-	fileData.ConvertRegionToLineData()
 
-	// Calculate statistics
-	report := NewReport(*title)
-	report.CollectStatistics(fileData)
 	report.TestID = *testid
 	report.SrcID = *srcid
 	report.SrcDir = *srcdir
+	report.SrcPath = splitList(*srcpath)
 	report.ProjectURL = *projecturl
 	report.AllowHTMLScripting = *htmljs
+	report.HTMLJobs = *htmljobs
+	report.SkipMissingSources = *skipmiss
+	report.MarkdownDirs = *mddirs
+	report.TextDepth = *textdepth
+	report.HeatMap = *heatmap
+
+	// Update the history, if requested.
+	if *history != "" {
+		records, err := updateHistory(*history, splitList(*histimport), report, *histkeep)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: could not update history: %s\n", err)
+			os.Exit(1)
+		}
+		report.History = pruneHistory(records, *histruns)
+	} else if *histtext != "" || *histimport != "" {
+		fmt.Fprintf(os.Stderr, "error: history is not available without -history\n")
+		os.Exit(1)
+	}
 
 	// Write the coverage to stdout, but only if we aren't sending another
 	// report to stdout.
 	// Note we ignore HTML reports, because they never go to stdout because of
 	// their complexity.
-	if *text != "-" && *markdown != "-" {
+	if *text != "-" && *markdown != "-" && *jsonfile != "-" && *hotspots != "-" && *histtext != "-" && *badgefile != "-" && *badgejson != "-" {
 		writeStdoutReport(os.Stdout, report)
 	}
 
@@ -94,14 +194,59 @@ func main() {
 		}
 	}
 
+	// Hotspots report, if requested.
+	if *hotspots != "" {
+		err := createHotspotsReport(*hotspots, report)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: could not create hotspots report: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// History report, if requested.
+	if *histtext != "" {
+		err := createHistoryReport(*histtext, report)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: could not create history report: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// JSON report, if requested.
+	if *jsonfile != "" {
+		err := createJSONReport(*jsonfile, report)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: could not create JSON report: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Badges, if requested.
+	if *badgefile != "" || *badgejson != "" || *badgedir != "" {
+		err := createBadgeReports(*badgefile, *badgejson, *badgedir, *badgemet, report)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: could not create badge: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// HTML report, if requested.
 	if *htmldir != "" {
-		err := createHTML(*htmldir, fileData, report)
+		err := createHTML(os.Stderr, *htmldir, source, report)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error: could not create HTML report: %s\n", err)
 			os.Exit(1)
 		}
 	}
+
+	// Fail if any of the components are below their threshold.
+	if failed := report.FailedComponents(); len(failed) > 0 {
+		for _, v := range failed {
+			fmt.Fprintf(os.Stderr, "error: line coverage for component %s is %.1f%%, below threshold of %.1f%%\n",
+				v.Name, v.LCoverage.P(), v.Threshold)
+		}
+		os.Exit(1)
+	}
 }
 
 func handleRequestFlags(out io.Writer, help, version bool) bool {
@@ -118,7 +263,254 @@ func handleRequestFlags(out io.Writer, help, version bool) bool {
 	return false
 }
 
-func loadFile(data FileDataSet, filename string) error {
+func collectGroups(report *Report, components, codeowners string) error {
+	cm := (*ComponentMap)(nil)
+	if components != "" {
+		tmp, err := loadComponentMap(components)
+		if err != nil {
+			return fmt.Errorf("could not load components: %s", err)
+		}
+		cm = tmp
+	}
+
+	co := (*CodeOwners)(nil)
+	if codeowners != "" {
+		tmp, err := loadCodeOwners(codeowners)
+		if err != nil {
+			return fmt.Errorf("could not load code owners: %s", err)
+		}
+		co = tmp
+	}
+
+	report.CollectGroups(cm, co)
+	return nil
+}
+
+func isFlagSet(name string) bool {
+	found := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+	return found
+}
+
+// fileDataSource is used to look up the coverage data for a source file when
+// rendering reports.
+type fileDataSource interface {
+	Lookup(filename string) *FileData
+}
+
+// fileFilter normalizes the source filenames, and removes any files that
+// should not appear in the reports.
+type fileFilter struct {
+	srcdir   string
+	srcpath  []string
+	external bool
+	exclude  *regexp.Regexp
+	// Patterns for source files that should be reported, even if there is
+	// no coverage data.
+	uninstrumented []string
+	// Receives warnings about source files that could not be read.
+	warnings io.Writer
+}
+
+func newFileFilter(out io.Writer, srcdir string, srcpath []string, external bool, exclude string, uninstrumented []string) fileFilter {
+	return fileFilter{
+		srcdir:         srcdir,
+		srcpath:        srcpath,
+		external:       external,
+		exclude:        compileExcludeFilter(out, exclude),
+		uninstrumented: uninstrumented,
+		warnings:       out,
+	}
+}
+
+func (f fileFilter) apply(fileData FileDataSet) (FileDataSet, error) {
+	fileData, err := normalizeSourceFilenames(fileData, f.srcdir)
+	if err != nil {
+		return fileData, err
+	}
+	fileData = filterExternalFileData(fileData, f.external)
+	return excludeFileData(fileData, f.exclude), nil
+}
+
+// addUninstrumented scans the source directory for any source files that
+// match the patterns, but do not have any coverage data.  Those files are
+// returned, with estimates for the executable lines, so that they can be
+// reported at 0%.
+func (f fileFilter) addUninstrumented(known func(string) bool) (FileDataSet, error) {
+	fileData := make(FileDataSet)
+	if len(f.uninstrumented) == 0 {
+		return fileData, nil
+	}
+
+	names, err := findUninstrumentedFiles(f.warnings, f.srcdir, f.uninstrumented, f.exclude, known)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		data, err := loadUninstrumentedFile(f.srcdir, name)
+		if err != nil {
+			fmt.Fprintf(f.warnings, "warning: skipping unreadable source file: %s\n", err)
+			continue
+		}
+		fileData[name] = data
+	}
+	return fileData, nil
+}
+
+// codeLines reads the source file, and returns the lines that contain code.
+// The source file is located in the same manner as for the HTML report.  If
+// the source file cannot be read, the return is nil.
+func (f fileFilter) codeLines(filename string) map[int]bool {
+	filename, ok := findSourceFile(f.srcdir, f.srcpath, filename)
+	if !ok {
+		return nil
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	lines, err := readCodeLines(file, filename)
+	if err != nil {
+		return nil
+	}
+	return lines
+}
+
+// splitList splits a list of paths, which are separated by the OS-specific
+// list separator.  Unlike filepath.SplitList, an empty list returns nil.
+func splitList(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return filepath.SplitList(list)
+}
+
+// splitPatterns splits a comma separated list of patterns.  Empty patterns
+// are dropped.
+func splitPatterns(list string) []string {
+	out := []string(nil)
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func loadFileData(filenames []string, opts loadOptions, filter fileFilter) (FileDataSet, error) {
+	fileData := make(FileDataSet)
+
+	profile, err := walkProfiles(filenames, opts, func(parser Parser, file *os.File) error {
+		return parser.loadFile(fileData, file, opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !profile.empty() {
+		err := loadLLVMProfile(fileData, profile, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	fileData, err = filter.apply(fileData)
+	if err != nil {
+		return nil, err
+	}
+
+	extra, err := filter.addUninstrumented(func(name string) bool {
+		_, ok := fileData[name]
+		return ok
+	})
+	if err != nil {
+		return nil, err
+	}
+	for name, data := range extra {
+		fileData[name] = data
+	}
+	return fileData, nil
+}
+
+// loadCompactFileData loads the coverage data, but the data is converted to
+// the compact representation as each section of the input is completed.  For
+// tracefiles from lcov, and the intermediate format from gcov, only a single
+// source file is held in the map-based representation at any time.
+func loadCompactFileData(filenames []string, opts loadOptions, filter fileFilter) (*CompactFileDataSet, error) {
+	fileData := NewCompactFileDataSet()
+
+	merge := func(tmp FileDataSet) error {
+		tmp, err := filter.apply(tmp)
+		if err != nil {
+			return err
+		}
+		fileData.Merge(tmp)
+		return nil
+	}
+
+	profile, err := walkProfiles(filenames, opts, func(parser Parser, file *os.File) error {
+		return parser.streamFile(file, opts, merge)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !profile.empty() {
+		tmp := make(FileDataSet)
+		err := loadLLVMProfile(tmp, profile, opts)
+		if err != nil {
+			return nil, err
+		}
+		err = merge(tmp)
+		if err != nil {
+			return nil, err
+		}
+	}
+	fileData.ConvertRegionToCodeLines(filter.codeLines)
+
+	extra, err := filter.addUninstrumented(fileData.Contains)
+	if err != nil {
+		return nil, err
+	}
+	fileData.Merge(extra)
+	return fileData, nil
+}
+
+func loadFile(data FileDataSet, filename string, opts loadOptions) error {
+	return walkFile(filename, opts, func(parser Parser, file *os.File) error {
+		return parser.loadFile(data, file, opts)
+	})
+}
+
+// walkProfiles calls fn for every recognized file, except for profiles from
+// clang or rustc.  Those profiles are merged, and the merged profile is
+// returned.  The counters must be merged before they are mapped to regions,
+// since regions whose counts are zero are mapped differently.
+func walkProfiles(filenames []string, opts loadOptions, fn func(Parser, *os.File) error) (*llvmProfile, error) {
+	profile := &llvmProfile{}
+
+	for _, name := range filenames {
+		err := walkFile(name, opts, func(parser Parser, file *os.File) error {
+			if parser == ParserProfile {
+				return profile.loadFile(file)
+			}
+			return fn(parser, file)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return profile, nil
+}
+
+// walkFile opens the file, identifies the file's format, and then calls fn.
+// If the file is a directory, fn is called for every recognized file in the
+// directory, but XML documents that are not coverage reports are skipped.
+func walkFile(filename string, opts loadOptions, fn func(Parser, *os.File) error) error {
 	// Open the file
 	file, err := os.Open(filename)
 	if err != nil {
@@ -131,7 +523,7 @@ func loadFile(data FileDataSet, filename string) error {
 	if err != nil {
 		return err
 	} else if stat.IsDir() {
-		return loadFilesFromDir(data, file)
+		return walkFilesFromDir(file, opts, fn)
 	}
 
 	parser, ok := identifyFileType(filename)
@@ -139,18 +531,37 @@ func loadFile(data FileDataSet, filename string) error {
 		return fmt.Errorf("unrecognized file extension: %s", filepath.Ext(filename))
 	}
 
-	return parser.loadFile(data, file)
+	return fn(parser, file)
 }
 
-func loadFilesFromDir(data FileDataSet, file *os.File) error {
+func walkFilesFromDir(file *os.File, opts loadOptions, fn func(Parser, *os.File) error) error {
 	names, err := file.Readdirnames(0)
 	if err != nil {
 		return err
 	}
 
+	// The notes files describe the same coverage as the output from gcov, so
+	// they are ignored if both are present.
+	notes := true
 	for _, v := range names {
-		if _, ok := identifyFileType(v); ok {
-			err := loadFile(data, filepath.Join(file.Name(), v))
+		if parser, ok := identifyFileType(v); ok && (parser == ParserGCov || parser == ParserGCovJS) {
+			notes = false
+		}
+	}
+
+	for _, v := range names {
+		if parser, ok := identifyFileType(v); ok {
+			if parser == ParserGCNO && !notes {
+				continue
+			}
+			err := walkFile(filepath.Join(file.Name(), v), opts, fn)
+			if _, ok := err.(unrecognizedXMLError); ok {
+				continue
+			} else if err != nil {
+				return err
+			}
+		} else if notes {
+			err := walkNotesFromDir(filepath.Join(file.Name(), v), opts, fn)
 			if err != nil {
 				return err
 			}
@@ -159,6 +570,34 @@ func loadFilesFromDir(data FileDataSet, file *os.File) error {
 	return nil
 }
 
+// walkNotesFromDir searches a subdirectory for notes files written by gcc.
+// The object files in a build directory are often spread over several
+// subdirectories.  Other reports are not searched for, since they are
+// normally written to the top of the directory.  Hidden directories are
+// skipped, as are any directories that cannot be read.
+func walkNotesFromDir(dirname string, opts loadOptions, fn func(Parser, *os.File) error) error {
+	if stat, err := os.Stat(dirname); err != nil || !stat.IsDir() {
+		return nil
+	}
+
+	return filepath.Walk(dirname, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			opts.warnf("skipping unreadable path: %s", err)
+			return nil
+		}
+		if info.IsDir() {
+			if strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if parser, ok := identifyFileType(path); ok && parser == ParserGCNO {
+			return walkFile(path, opts, fn)
+		}
+		return nil
+	})
+}
+
 func normalizeSourceFilenames(data FileDataSet, srcdir string) (FileDataSet, error) {
 	srcdir, err := filepath.Abs(srcdir)
 	if err != nil {
@@ -178,13 +617,24 @@ func normalizeSourceFilenames(data FileDataSet, srcdir string) (FileDataSet, err
 }
 
 func filterExcludedFileData(out io.Writer, fileData FileDataSet, filter string) FileDataSet {
+	return excludeFileData(fileData, compileExcludeFilter(out, filter))
+}
+
+func compileExcludeFilter(out io.Writer, filter string) *regexp.Regexp {
 	if filter == "" {
-		return fileData
+		return nil
 	}
 
 	re, err := regexp.Compile(filter)
 	if err != nil {
 		fmt.Fprintf(out, "warning: did not apply filter to exclude files: %s\n", err)
+		return nil
+	}
+	return re
+}
+
+func excludeFileData(fileData FileDataSet, re *regexp.Regexp) FileDataSet {
+	if re == nil {
 		return fileData
 	}
 
@@ -38,6 +38,7 @@ func TestFilterExternalFileData(t *testing.T) {
 	const file1 = "binc.cpp"
 	const file2 = "/usr/include/a.h"
 	const file3 = "/usr/include/b.h"
+	const file4 = ".cargo/registry/src/index.crates.io-6f17d22bba15001f/memchr-2.7.1/src/lib.rs"
 
 	cases := []struct {
 		in       []string
@@ -46,6 +47,8 @@ func TestFilterExternalFileData(t *testing.T) {
 	}{
 		{[]string{file1, file2, file3}, false, 1},
 		{[]string{file1, file2, file3}, true, 3},
+		{[]string{file1, file4}, false, 1},
+		{[]string{file1, file4}, true, 2},
 		{[]string{file1}, false, 1},
 		{[]string{file1}, true, 1},
 	}
@@ -104,3 +107,24 @@ func TestFilterExcludedFileData(t *testing.T) {
 		})
 	}
 }
+
+func TestFileFilterCodeLines(t *testing.T) {
+	filter := newFileFilter(bytes.NewBuffer(nil), "./example", nil, true, "", nil)
+
+	lines := filter.codeLines("example.c")
+	if len(lines) == 0 {
+		t.Errorf("no code lines for example.c")
+	}
+	if lines := filter.codeLines("missing.c"); lines != nil {
+		t.Errorf("unexpected code lines for missing.c")
+	}
+	if lines := filter.codeLines("gauss.c"); lines != nil {
+		t.Errorf("unexpected code lines for gauss.c")
+	}
+
+	// Source files can also be found using the search path.
+	filter = newFileFilter(bytes.NewBuffer(nil), ".", []string{"./testdata", "./example/methods"}, true, "", nil)
+	if lines := filter.codeLines("gauss.c"); len(lines) == 0 {
+		t.Errorf("no code lines for gauss.c")
+	}
+}
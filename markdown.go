@@ -73,6 +73,57 @@ Date: {{.UnixDate}}
 {{- end -}}
 |
 {{ end }}
+{{- if and .MarkdownDirs .Dirs }}
+## By Directory
+
+| Directory | Line Coverage |{{if $useFunc }} Function Coverage |{{end}}{{if $useBranch}} Branch Coverage |{{end}}
+| :-------- | :-----------: |{{if $useFunc }} :---------------: |{{end}}{{if $useBranch}} :-------------: |{{end}}
+{{range $ndx, $data := .Dirs.Descendants -}}
+| {{.Name}}/ |{{template "coverageDetail" .LCoverage}} 
+{{- if $useFunc -}}
+|{{template "coverageDetail" .FCoverage}} 
+{{- end -}}
+{{- if $useBranch -}}
+|{{template "coverageDetail" .BCoverage}} 
+{{- end -}}
+|
+{{ end -}}
+{{- end }}
+{{- if .Components }}
+## By Component
+
+| Component | Files | Line Coverage |{{if $useFunc }} Function Coverage |{{end}}{{if $useBranch}} Branch Coverage |{{end}}{{if .HasThresholds}} Threshold |{{end}}
+| :-------- | :---: | :-----------: |{{if $useFunc }} :---------------: |{{end}}{{if $useBranch}} :-------------: |{{end}}{{if .HasThresholds}} :-------: |{{end}}
+{{range $ndx, $data := .Components -}}
+| {{.Name}} | {{.FileCount}} |{{template "coverageDetail" .LCoverage}} 
+{{- if $useFunc -}}
+|{{template "coverageDetail" .FCoverage}} 
+{{- end -}}
+{{- if $useBranch -}}
+|{{template "coverageDetail" .BCoverage}} 
+{{- end -}}
+{{- if $.HasThresholds -}}
+| {{if .HasThreshold}}{{printf "%.1f%% " .Threshold}}{{if .BelowThreshold}}(failed) {{end}}{{end}}
+{{- end -}}
+|
+{{ end -}}
+{{- end }}
+{{- if .Owners }}
+## By Owner
+
+| Owner | Files | Line Coverage |{{if $useFunc }} Function Coverage |{{end}}{{if $useBranch}} Branch Coverage |{{end}}
+| :---- | :---: | :-----------: |{{if $useFunc }} :---------------: |{{end}}{{if $useBranch}} :-------------: |{{end}}
+{{range $ndx, $data := .Owners -}}
+| {{.Name}} | {{.FileCount}} |{{template "coverageDetail" .LCoverage}} 
+{{- if $useFunc -}}
+|{{template "coverageDetail" .FCoverage}} 
+{{- end -}}
+{{- if $useBranch -}}
+|{{template "coverageDetail" .BCoverage}} 
+{{- end -}}
+|
+{{ end -}}
+{{- end }}
 
 ## By Function
 
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io/ioutil"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -21,7 +22,7 @@ func TestCreateMarkdownReport(t *testing.T) {
 		v := v
 		t.Run(v.filename, func(t *testing.T) {
 			data := make(map[string]*FileData)
-			err := loadFile(data, filepath.Join("./testdata", v.filename))
+			err := loadFile(data, filepath.Join("./testdata", v.filename), loadOptions{})
 			if err != nil {
 				t.Fatalf("could not read file: %s", err)
 			}
@@ -58,6 +59,90 @@ func TestCreateMarkdownReport(t *testing.T) {
 	}
 }
 
+func TestCreateMarkdownReportDirs(t *testing.T) {
+	data := make(map[string]*FileData)
+	err := loadFile(data, "./testdata/example-7.4.0-branches", loadOptions{})
+	if err != nil {
+		t.Fatalf("could not read file: %s", err)
+	}
+
+	filename, cleanup := TempFilename(t)
+	defer cleanup()
+
+	report := NewTestReport()
+	report.CollectStatistics(data)
+	report.MarkdownDirs = true
+	err = createMarkdownReport(filename, report)
+	if err != nil {
+		t.Fatalf("could not write output: %s", err)
+	}
+	out, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("could not read the output: %s", err)
+	}
+
+	if *update {
+		err := ioutil.WriteFile(filepath.Join("./testdata", t.Name()+".golden"), out, 0600)
+		if err != nil {
+			t.Fatalf("could not write golden file: %s", err)
+		}
+	}
+
+	expected, err := ioutil.ReadFile(filepath.Join("./testdata", t.Name()+".golden"))
+	if err != nil {
+		t.Fatalf("could not read golden file: %s", err)
+	}
+	if !bytes.Equal(expected, out) {
+		t.Errorf("output does not match golden file")
+	}
+}
+
+func TestCreateMarkdownReportGroups(t *testing.T) {
+	data := make(map[string]*FileData)
+	err := loadFile(data, "./testdata/example-7.4.0-branches", loadOptions{})
+	if err != nil {
+		t.Fatalf("could not read file: %s", err)
+	}
+	cm, err := parseComponentMap(strings.NewReader(testComponentMap))
+	if err != nil {
+		t.Fatalf("could not parse components: %s", err)
+	}
+	co, err := parseCodeOwners(strings.NewReader(testCodeOwners))
+	if err != nil {
+		t.Fatalf("could not parse code owners: %s", err)
+	}
+
+	filename, cleanup := TempFilename(t)
+	defer cleanup()
+
+	report := NewTestReport()
+	report.CollectStatistics(data)
+	report.CollectGroups(cm, co)
+	err = createMarkdownReport(filename, report)
+	if err != nil {
+		t.Fatalf("could not write output: %s", err)
+	}
+	out, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("could not read the output: %s", err)
+	}
+
+	if *update {
+		err := ioutil.WriteFile(filepath.Join("./testdata", t.Name()+".golden"), out, 0600)
+		if err != nil {
+			t.Fatalf("could not write golden file: %s", err)
+		}
+	}
+
+	expected, err := ioutil.ReadFile(filepath.Join("./testdata", t.Name()+".golden"))
+	if err != nil {
+		t.Fatalf("could not read golden file: %s", err)
+	}
+	if !bytes.Equal(expected, out) {
+		t.Errorf("output does not match golden file")
+	}
+}
+
 func TestCreateMarkdownReportFail(t *testing.T) {
 	report := NewTestReport()
 	report.CollectStatistics(map[string]*FileData{})
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// ParseMode controls how the parsers handle bad records in coverage data.
+type ParseMode int
+
+// These constants identify the parse modes.  By default, a malformed record
+// is an error, but records that are not understood are ignored.  In lenient
+// mode, malformed records are skipped, and a warning with the number of
+// skipped records is printed.  In strict mode, unknown record types and
+// records that appear before the source file has been named are also errors.
+const (
+	ParseDefault ParseMode = iota
+	ParseLenient
+	ParseStrict
+)
+
+var parseModes = map[string]ParseMode{
+	"default": ParseDefault,
+	"lenient": ParseLenient,
+	"strict":  ParseStrict,
+}
+
+// readerName returns the filename for the reader, if known, for use in
+// error messages.
+func readerName(r io.Reader) string {
+	if file, ok := r.(interface{ Name() string }); ok {
+		return file.Name()
+	}
+	return "input"
+}
+
+// recordScanner reads the records from a line-based format, such as the
+// intermediate format from gcov or a tracefile from lcov.  It tracks the line
+// number so that errors can be located, and applies the parse mode to bad
+// records.
+type recordScanner struct {
+	scanner *bufio.Scanner
+	opts    loadOptions
+	name    string
+	line    int
+	skipped int
+}
+
+func newRecordScanner(r io.Reader, opts loadOptions) *recordScanner {
+	return &recordScanner{
+		scanner: bufio.NewScanner(r),
+		opts:    opts,
+		name:    readerName(r),
+	}
+}
+
+func (s *recordScanner) scan() bool {
+	if !s.scanner.Scan() {
+		return false
+	}
+	s.line++
+	return true
+}
+
+func (s *recordScanner) text() string {
+	return s.scanner.Text()
+}
+
+// errorf returns an error prefixed with the filename and line number of
+// the current record.
+func (s *recordScanner) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s:%d: %s", s.name, s.line, fmt.Sprintf(format, args...))
+}
+
+// warnf prints a warning about the current record.
+func (s *recordScanner) warnf(format string, args ...interface{}) {
+	s.opts.warnf("%s:%d: %s", s.name, s.line, fmt.Sprintf(format, args...))
+}
+
+// badRecord handles a record that could not be parsed.  In lenient mode, the
+// record is skipped, otherwise an error is returned.
+func (s *recordScanner) badRecord(err error) error {
+	if s.opts.mode == ParseLenient {
+		s.skipped++
+		return nil
+	}
+	return s.errorf("%s", err)
+}
+
+// missingFile handles a record that appears before the source file has been
+// named.  The record is skipped, except in strict mode.
+func (s *recordScanner) missingFile(recordType string) error {
+	if s.opts.mode == ParseStrict {
+		return s.errorf("%s record before source file record", recordType)
+	}
+	s.skipped++
+	return nil
+}
+
+// unknownRecord handles records with an unrecognized type.  The record is
+// ignored, except in strict mode.  If future versions of the file formats
+// introduce new records, we don't want to have an error.
+func (s *recordScanner) unknownRecord(recordType string) error {
+	if s.opts.mode == ParseStrict {
+		return s.errorf("unknown record type %q", recordType)
+	}
+	return nil
+}
+
+// finish checks for read errors, and reports the number of skipped records.
+func (s *recordScanner) finish() error {
+	if err := s.scanner.Err(); err != nil {
+		return fmt.Errorf("%s:%d: %s", s.name, s.line+1, err)
+	}
+	if s.skipped > 0 {
+		s.opts.warnf("%s: skipped %d bad records", s.name, s.skipped)
+		s.skipped = 0
+	}
+	return nil
+}
+
+// decodeJSON decodes a JSON document.  Errors from the decoder are reported
+// with the filename and line number.
+func decodeJSON(r io.Reader, name string, v interface{}) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(data, v)
+	if err == nil {
+		return nil
+	}
+
+	offset := int64(-1)
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	}
+	if offset < 0 {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	line := 1 + bytes.Count(data[:offset], []byte{'\n'})
+	return fmt.Errorf("%s:%d: %s", name, line, err)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseModes(t *testing.T) {
+	const (
+		bad     = "SF:a.c\nDA:1,1\nDA:2\nDA:3,1\nend_of_record\n"
+		orphan  = "DA:1,1\nSF:a.c\nDA:2,1\nend_of_record\n"
+		unknown = "SF:a.c\nXX:1\nDA:1,1\nend_of_record\n"
+	)
+
+	cases := []struct {
+		name     string
+		parser   func(FileDataSet, string, loadOptions) error
+		value    string
+		mode     ParseMode
+		err      string
+		warning  string
+		lineData map[int]uint64
+	}{
+		{"lcov-bad-default", loadLCovString, bad, ParseDefault, "input:3: can't parse DA record", "", nil},
+		{"lcov-bad-lenient", loadLCovString, bad, ParseLenient, "", "warning: input: skipped 1 bad records\n", map[int]uint64{1: 1, 3: 1}},
+		{"lcov-bad-strict", loadLCovString, bad, ParseStrict, "input:3: can't parse DA record", "", nil},
+		{"lcov-orphan-default", loadLCovString, orphan, ParseDefault, "", "warning: input: skipped 1 bad records\n", map[int]uint64{2: 1}},
+		{"lcov-orphan-lenient", loadLCovString, orphan, ParseLenient, "", "warning: input: skipped 1 bad records\n", map[int]uint64{2: 1}},
+		{"lcov-orphan-strict", loadLCovString, orphan, ParseStrict, "input:1: DA record before source file record", "", nil},
+		{"lcov-unknown-default", loadLCovString, unknown, ParseDefault, "", "", map[int]uint64{1: 1}},
+		{"lcov-unknown-strict", loadLCovString, unknown, ParseStrict, "input:2: unknown record type \"XX\"", "", nil},
+		{"lcov-version-strict", loadLCovString, "VER:2.0\nSF:a.c\nDA:1,1,cksum\nend_of_record\n", ParseStrict, "", "", map[int]uint64{1: 1}},
+		{"gcov-bad-default", loadGCovString, "file:a.c\nlcount:1,1\nlcount:2\n", ParseDefault, "input:3: can't parse lcount record", "", nil},
+		{"gcov-bad-lenient", loadGCovString, "file:a.c\nlcount:1,1\nlcount:2\n", ParseLenient, "", "warning: input: skipped 1 bad records\n", map[int]uint64{1: 1}},
+		{"gcov-orphan-default", loadGCovString, "lcount:1,1\nfile:a.c\nlcount:2,1\n", ParseDefault, "", "warning: input: skipped 1 bad records\n", map[int]uint64{2: 1}},
+		{"gcov-orphan-strict", loadGCovString, "lcount:1,1\nfile:a.c\nlcount:2,1\n", ParseStrict, "input:1: lcount record before source file record", "", nil},
+		{"gcov-unknown-strict", loadGCovString, "version:9.1.0\nfile:a.c\nxx:1\n", ParseStrict, "input:3: unknown record type \"xx\"", "", nil},
+		{"go-missing-mode", loadGoString, "a.c:1.1,2.1 1 1\n", ParseLenient, "input:1: format error: missing mode record", "", nil},
+		{"go-bad-default", loadGoString, "mode: set\na.c:1.1,2.1 1 1\na.c:x\n", ParseDefault, "input:3: could not find separator ',' in record", "", nil},
+		{"go-bad-lenient", loadGoString, "mode: set\na.c:1.1,2.1 1 1\na.c:x\n", ParseLenient, "", "warning: input: skipped 1 bad records\n", nil},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(t *testing.T) {
+			warnings := bytes.NewBuffer(nil)
+			fds := make(FileDataSet)
+			err := v.parser(fds, v.value, loadOptions{mode: v.mode, warnings: warnings})
+			if v.err != "" {
+				if err == nil || err.Error() != v.err {
+					LogNE(t, "error", v.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := warnings.String(); got != v.warning {
+				LogNE(t, "warning", v.warning, got)
+			}
+			if v.lineData != nil {
+				if got := fds["a.c"].LineData; !reflect.DeepEqual(got, v.lineData) {
+					LogNE(t, "line data", v.lineData, got)
+				}
+			}
+		})
+	}
+}
+
+func loadLCovString(fds FileDataSet, value string, opts loadOptions) error {
+	return loadLCovFile(fds, strings.NewReader(value), opts)
+}
+
+func loadGCovString(fds FileDataSet, value string, opts loadOptions) error {
+	return loadGCovFile(fds, strings.NewReader(value), opts)
+}
+
+func loadGoString(fds FileDataSet, value string, opts loadOptions) error {
+	return loadGoFile(fds, strings.NewReader(value), opts)
+}
+
+func TestDecodeJSON(t *testing.T) {
+	cases := []struct {
+		value string
+		err   string
+	}{
+		{"{\"a\": 1}", ""},
+		{"{\n\"a\": 1,\n\"b\" 2\n}", "example.json:3: "},
+		{"{\n\n\"a\": \"x\"\n}", "example.json:3: "},
+		{"", "example.json:1: "},
+	}
+
+	for _, v := range cases {
+		t.Run(v.value, func(t *testing.T) {
+			data := struct {
+				A int `json:"a"`
+			}{}
+			err := decodeJSON(strings.NewReader(v.value), "example.json", &data)
+			if v.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			// Only check the location, since the messages from the
+			// decoder differ between versions of Go.
+			if err == nil || !strings.HasPrefix(err.Error(), v.err) {
+				LogNE(t, "error", v.err, err)
+			}
+		})
+	}
+}
+
+func TestLoadLLVMDataMissingRegions(t *testing.T) {
+	const value = `{"type":"llvm.coverage.json.export","data":[{"functions":[{"name":"main","count":1}]}]}`
+
+	err := loadJSONFile(make(FileDataSet), strings.NewReader(value), loadOptions{})
+	if err == nil {
+		t.Errorf("expected error")
+	}
+
+	warnings := bytes.NewBuffer(nil)
+	err = loadJSONFile(make(FileDataSet), strings.NewReader(value), loadOptions{mode: ParseLenient, warnings: warnings})
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if got, expected := warnings.String(), "warning: input: skipped 1 bad records\n"; got != expected {
+		LogNE(t, "warning", expected, got)
+	}
+}
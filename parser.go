@@ -1,8 +1,13 @@
 package main
 
 import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // Parser identifies one of the parsers available to read coverage information.
@@ -14,41 +19,201 @@ const (
 	ParserGCov Parser = iota
 	ParserLCov
 	ParserGCovJS
-	ParserLLVM
+	ParserJSON // Export from llvm-cov, covdir from grcov, or report from coverage.py
 	ParserGo
+	ParserXML     // Report from Cobertura or JaCoCo
+	ParserGCNO    // Notes and data files from gcc
+	ParserProfile // Raw or indexed profiles from clang or rustc
 )
 
 func identifyFileType(filename string) (Parser, bool) {
 	ext := filepath.Ext(filename)
 	switch ext {
-	case ".info":
+	case ".info", ".lcov":
 		return ParserLCov, true
 	case ".gcov":
 		return ParserGCov, true
 	case ".gz":
 		return ParserGCovJS, true
 	case ".json":
-		return ParserLLVM, true
+		return ParserJSON, true
 	case ".out":
 		return ParserGo, true
+	case ".xml":
+		return ParserXML, true
+	case ".gcno":
+		return ParserGCNO, true
+	case ".profraw", ".profdata":
+		return ParserProfile, true
 	default:
 		return 0, false
 	}
 }
 
-func (p Parser) loadFile(data FileDataSet, file *os.File) error {
+// loadOptions controls how the coverage data is loaded.  The options are set
+// from the command line.
+type loadOptions struct {
+	// Instrumented binaries, which contain the coverage mapping for the
+	// profiles from clang or rustc.
+	objects []string
+	// Handling of bad records in the coverage data.
+	mode ParseMode
+	// Receives warnings about skipped records.  If nil, the warnings are
+	// discarded.
+	warnings io.Writer
+	// Check the summary records in tracefiles against the data records.
+	validate bool
+}
+
+// warnf prints a warning.
+func (opts loadOptions) warnf(format string, args ...interface{}) {
+	if opts.warnings != nil {
+		fmt.Fprintf(opts.warnings, "warning: "+format+"\n", args...)
+	}
+}
+
+func (p Parser) loadFile(data FileDataSet, file *os.File, opts loadOptions) error {
 	switch p {
 	case ParserLCov:
-		return loadLCovFile(data, file)
+		return loadLCovFile(data, file, opts)
 	case ParserGCov:
-		return loadGCovFile(data, file)
+		return loadGCovFile(data, file, opts)
 	case ParserGCovJS:
 		return loadGCovJSFile(data, file)
-	case ParserLLVM:
-		return loadLLVMFile(data, file)
+	case ParserJSON:
+		return loadJSONFile(data, file, opts)
 	case ParserGo:
-		return loadGoFile(data, file)
+		return loadGoFile(data, file, opts)
+	case ParserXML:
+		return loadXMLFile(data, file)
+	case ParserGCNO:
+		return loadGCNOFile(data, file)
+	case ParserProfile:
+		return loadLLVMProfileFile(data, file, opts)
 	}
 
 	panic("Unreachable")
 }
+
+// streamFile loads the coverage data from the file, calling flush as sections
+// of the data are completed.  For most formats, there is a single section
+// for the entire file, but tracefiles from lcov are flushed at the end of
+// every record, and the intermediate format from gcov is flushed after every
+// source file.
+func (p Parser) streamFile(file *os.File, opts loadOptions, flush func(FileDataSet) error) error {
+	fds := make(FileDataSet)
+	switch p {
+	case ParserLCov:
+		return streamLCovFile(fds, file, opts, flush)
+	case ParserGCov:
+		return streamGCovFile(fds, file, opts, flush)
+	}
+
+	err := p.loadFile(fds, file, opts)
+	if err != nil {
+		return err
+	}
+	return flushFileData(fds, flush)
+}
+
+// loadJSONFile loads coverage data from a JSON file.  The export from
+// llvm-cov, the covdir report from grcov, and the report from coverage.py all
+// use the extension .json, so the format is identified by the contents.
+func loadJSONFile(fds FileDataSet, file io.Reader, opts loadOptions) error {
+	data := struct {
+		LLVMData
+		covdirNode
+		coveragePyData
+	}{}
+
+	name := readerName(file)
+	err := decodeJSON(file, name, &data)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case data.Type != "":
+		return loadLLVMData(fds, &data.LLVMData, name, opts)
+	case data.Meta != nil || data.Files != nil:
+		return loadCoveragePyData(fds, &data.coveragePyData, name)
+	case data.Children != nil || data.Coverage != nil:
+		loadCovdirNode(fds, "", &data.covdirNode)
+		return nil
+	}
+	return loadLLVMData(fds, &data.LLVMData, name, opts)
+}
+
+// unrecognizedXMLError is returned when an XML document is not a coverage
+// report.  When searching a directory, these documents are skipped, since XML
+// is used for many other purposes.
+type unrecognizedXMLError string
+
+func (e unrecognizedXMLError) Error() string {
+	return "unrecognized root element in XML data: " + string(e)
+}
+
+// loadXMLFile loads coverage data from an XML file.  Both Cobertura and
+// JaCoCo write XML reports, so the format is identified by the root element.
+// The file is decoded one package or class at a time, since the reports for
+// large projects can be quite big.
+func loadXMLFile(fds FileDataSet, file io.Reader) error {
+	decoder := xml.NewDecoder(file)
+	root := ""
+	sources := []string(nil)
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			if root == "" {
+				return errors.New("missing root element in XML data")
+			}
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		elem, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if root == "" {
+			root = elem.Name.Local
+			if root != "report" && root != "coverage" {
+				return unrecognizedXMLError(root)
+			}
+			continue
+		}
+
+		switch {
+		case root == "report" && elem.Name.Local == "package":
+			pkg := jacocoPackage{}
+			err := decoder.DecodeElement(&pkg, &elem)
+			if err != nil {
+				return err
+			}
+			loadJaCoCoPackage(fds, &pkg)
+
+		case root == "coverage" && elem.Name.Local == "source":
+			source := ""
+			err := decoder.DecodeElement(&source, &elem)
+			if err != nil {
+				return err
+			}
+			if source = strings.TrimSpace(source); source != "" {
+				sources = append(sources, source)
+			}
+
+		case root == "coverage" && elem.Name.Local == "class":
+			class := coberturaClass{}
+			err := decoder.DecodeElement(&class, &elem)
+			if err != nil {
+				return err
+			}
+			err = loadCoberturaClass(fds, &class, sources)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -1,7 +1,12 @@
 package main
 
 import (
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -15,10 +20,17 @@ func TestIdentifyFileType(t *testing.T) {
 		{"/home/person/example-7.4.0.c.gcov", ParserGCov, true},
 		{"example-7.4.0.c.info", ParserLCov, true},
 		{"/home/person/example-7.4.0.c.info", ParserLCov, true},
-		{"example-7.4.0.json", ParserLLVM, true},
-		{"/home/person/example-7.4.0.json", ParserLLVM, true},
+		{"lcov.lcov", ParserLCov, true},
+		{"example-7.4.0.json", ParserJSON, true},
+		{"/home/person/example-7.4.0.json", ParserJSON, true},
 		{"example-7.4.0.out", ParserGo, true},
 		{"/home/person/example-7.4.0.out", ParserGo, true},
+		{"jacoco.xml", ParserXML, true},
+		{"/home/person/cobertura.xml", ParserXML, true},
+		{"example.gcno", ParserGCNO, true},
+		{"example.gcda", 0, false},
+		{"default.profraw", ParserProfile, true},
+		{"/home/person/merged.profdata", ParserProfile, true},
 		{"example.7.4.0.c.dummy", 0, false},
 		{"/home/person/example.7.4.0.c.dummy", 0, false},
 	}
@@ -59,6 +71,8 @@ func TestParserLoadFile(t *testing.T) {
 		{"example-8.3.0-branches", Coverage{18, 22}, Coverage{9, 10}, Coverage{1, 1}, Coverage{2, 4}, Coverage{}, 3, 28},
 		// gcc 9.1.0
 		{"example-9.1.0.c.gcov.json.gz", Coverage{9, 10}, Coverage{9, 10}, Coverage{1, 1}, Coverage{2, 4}, Coverage{}, 1, 28},
+		// gcc 12.2.0
+		{"example-12.2.0-gcno", Coverage{18, 22}, Coverage{9, 10}, Coverage{1, 1}, Coverage{2, 4}, Coverage{}, 3, 28},
 		// gcc with lcov
 		{"example-lcov-1.13.info", Coverage{18, 22}, Coverage{9, 10}, Coverage{1, 1}, Coverage{2, 4}, Coverage{}, 3, 28},
 		// clang 6.0.1
@@ -72,7 +86,7 @@ func TestParserLoadFile(t *testing.T) {
 		t.Run(v.filename, func(t *testing.T) {
 			data := make(FileDataSet)
 
-			err := loadFile(data, filepath.Join("./testdata", v.filename))
+			err := loadFile(data, filepath.Join("./testdata", v.filename), loadOptions{})
 			if err != nil {
 				t.Fatalf("could not read file: %s", err)
 			}
@@ -116,3 +130,120 @@ func TestParserLoadFile(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadXMLFile(t *testing.T) {
+	cases := []struct {
+		value string
+		ok    bool
+	}{
+		{"", false},
+		{"<?xml version=\"1.0\"?>", false},
+		{"<html></html>", false},
+		{"<report></report>", true},
+		{"<coverage><sources><source> </source></sources></coverage>", true},
+		{"<coverage><class><lines><line number=\"x\"/></lines></class></coverage>", false},
+		{"<coverage><class><lines><line number=\"1\" branch=\"true\" condition-coverage=\"x\"/></lines></class></coverage>", false},
+		{"<report><package>", false},
+	}
+
+	for _, v := range cases {
+		t.Run(v.value, func(t *testing.T) {
+			fds := make(FileDataSet)
+			err := loadXMLFile(fds, strings.NewReader(v.value))
+			if (err == nil) != v.ok {
+				LogNE(t, "ok", v.ok, err == nil)
+			}
+		})
+	}
+}
+
+func TestLoadFileUnrecognizedXML(t *testing.T) {
+	dir, cleanup := TempDirectory(t)
+	defer cleanup()
+
+	files := map[string]string{
+		"pom.xml":    "<project></project>",
+		"trace.info": "SF:a.c\nDA:1,1\nend_of_record\n",
+	}
+	for name, value := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(value), 0644)
+		if err != nil {
+			t.Fatalf("could not write file: %s", err)
+		}
+	}
+
+	// Other XML documents are skipped when searching a directory.
+	fds := make(FileDataSet)
+	err := loadFile(fds, dir, loadOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := fds["a.c"]; !ok || len(fds) != 1 {
+		t.Errorf("unexpected files: %v", fds)
+	}
+
+	// But not when the file is named explicitly.
+	err = loadFile(make(FileDataSet), filepath.Join(dir, "pom.xml"), loadOptions{})
+	if err == nil {
+		t.Errorf("unexpected success")
+	}
+}
+
+// Input with multiple sections, where the first source file appears twice.
+var streamFileCases = []struct {
+	filename string
+	value    string
+	flushes  []string
+}{
+	{"trace.info", "SF:a.c\nDA:1,1\nend_of_record\nSF:b.c\nDA:1,0\nend_of_record\nSF:a.c\nDA:2,3\nend_of_record\n", []string{"a.c", "b.c", "a.c"}},
+	{"trace.gcov", "version:8.3.0\nfile:a.c\nlcount:1,1,0\nfile:b.c\nlcount:1,0,0\nfile:a.c\nlcount:2,3,0\n", []string{"a.c", "b.c", "a.c"}},
+	{"trace.out", "mode: set\na.c:1.1,1.10 1 1\nb.c:1.1,1.10 1 0\n", []string{"a.c,b.c"}},
+}
+
+func writeStreamFileCases(t *testing.T, dir string) {
+	for _, v := range streamFileCases {
+		err := ioutil.WriteFile(filepath.Join(dir, v.filename), []byte(v.value), 0644)
+		if err != nil {
+			t.Fatalf("could not write file: %s", err)
+		}
+	}
+}
+
+func TestParserStreamFile(t *testing.T) {
+	dir, cleanup := TempDirectory(t)
+	defer cleanup()
+	writeStreamFileCases(t, dir)
+
+	for _, v := range streamFileCases {
+		t.Run(v.filename, func(t *testing.T) {
+			parser, ok := identifyFileType(v.filename)
+			if !ok {
+				t.Fatalf("could not identify file type")
+			}
+			file, err := os.Open(filepath.Join(dir, v.filename))
+			if err != nil {
+				t.Fatalf("could not open file: %s", err)
+			}
+			defer file.Close()
+
+			// Each flush should only contain the data for the section that
+			// was just completed.
+			flushes := []string(nil)
+			err = parser.streamFile(file, loadOptions{}, func(fds FileDataSet) error {
+				names := []string(nil)
+				for name := range fds {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				flushes = append(flushes, strings.Join(names, ","))
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("could not stream file: %s", err)
+			}
+			if !reflect.DeepEqual(flushes, v.flushes) {
+				LogNE(t, "flushes", v.flushes, flushes)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+
+	"git.sr.ht/~rj/sgr"
+)
+
+// ratingColor contains the representations of a colour for each of the
+// outputs.
+type ratingColor struct {
+	CSS     string    // Colour for the HTML reports.
+	Badge   string    // Colour for SVG badges.
+	Shields string    // Named colour for shields.io.
+	Term    sgr.Color // Colour for terminals.
+}
+
+// ratingColors contains the colours that can be used for rating bands.
+var ratingColors = map[string]ratingColor{
+	"green":       {"lightgreen", "#4c1", "brightgreen", sgr.BrightGreen},
+	"yellowgreen": {"greenyellow", "#a4a61d", "yellowgreen", sgr.Green},
+	"yellow":      {"yellow", "#dfb317", "yellow", sgr.BrightYellow},
+	"orange":      {"orange", "#fe7d37", "orange", sgr.Yellow},
+	"red":         {"red", "#e05d44", "red", sgr.Red},
+	"blue":        {"lightblue", "#007ec6", "blue", sgr.BrightBlue},
+	"grey":        {"lightgrey", "#9f9f9f", "lightgrey", sgr.Gray},
+}
+
+// defaultRatingColors is used to assign colours to bands when they are not
+// specified.  The colours are spread from the highest band to the lowest.
+var defaultRatingColors = []string{"green", "yellowgreen", "yellow", "orange", "red"}
+
+// A RatingBand is a classification for coverage, such as low, medium or high.
+type RatingBand struct {
+	Name      string  // Name of the band, used in the reports.
+	Threshold float32 // Minimum coverage, as a percentage.
+	Color     string  // Name of the colour for the band.
+}
+
+// String returns the name of the band.
+func (rb RatingBand) String() string {
+	return rb.Name
+}
+
+// colors returns the representations of the band's colour.
+func (rb RatingBand) colors() ratingColor {
+	if v, ok := ratingColors[rb.Color]; ok {
+		return v
+	}
+	return ratingColor{"white", "#9f9f9f", "lightgrey", sgr.Default}
+}
+
+// A RatingScheme classifies coverage into bands.  The bands are sorted from
+// the highest threshold to the lowest.
+type RatingScheme []RatingBand
+
+// DefaultRatingScheme returns the default bands, which rate coverage as
+// high, medium, or low.
+func DefaultRatingScheme() RatingScheme {
+	return RatingScheme{
+		{"high", 90, "green"},
+		{"medium", 75, "yellow"},
+		{"low", 0, "red"},
+	}
+}
+
+// Rate returns the band for the coverage.  Coverage below all of the
+// thresholds, or coverage that is not valid, is assigned to the lowest band.
+func (rs RatingScheme) Rate(c Coverage) RatingBand {
+	if !c.Valid() {
+		return rs[len(rs)-1]
+	}
+	for _, v := range rs {
+		if c.AtLeast(v.Threshold) {
+			return v
+		}
+	}
+	return rs[len(rs)-1]
+}
+
+// Names returns the names of all bands, separated by spaces, from highest to
+// lowest.
+func (rs RatingScheme) Names() string {
+	names := make([]string, 0, len(rs))
+	for _, v := range rs {
+		names = append(names, v.Name)
+	}
+	return strings.Join(names, " ")
+}
+
+// parseRatingScheme parses a list of bands, separated by commas.  Each band
+// is specified by a name, a threshold, and optionally a colour, separated by
+// colons.  For example, "high:90:green,medium:75:yellow,low:0:red".
+func parseRatingScheme(spec string) (RatingScheme, error) {
+	out := RatingScheme(nil)
+	for _, v := range strings.Split(spec, ",") {
+		band, err := parseRatingBand(strings.TrimSpace(v))
+		if err != nil {
+			return nil, err
+		}
+		if n := len(out); n > 0 && band.Threshold >= out[n-1].Threshold {
+			return nil, fmt.Errorf("thresholds for rating bands must decrease: %s", v)
+		}
+		for _, prev := range out {
+			if prev.Name == band.Name {
+				return nil, fmt.Errorf("duplicate rating band: %s", band.Name)
+			}
+		}
+		out = append(out, band)
+	}
+
+	// Assign colours to any bands where the colour was not specified.
+	for i := range out {
+		if out[i].Color == "" {
+			ndx := 0
+			if len(out) > 1 {
+				ndx = (i*(len(defaultRatingColors)-1) + (len(out)-1)/2) / (len(out) - 1)
+			}
+			out[i].Color = defaultRatingColors[ndx]
+		}
+	}
+	return out, nil
+}
+
+func parseRatingBand(spec string) (RatingBand, error) {
+	fields := strings.Split(spec, ":")
+	if len(fields) < 2 || len(fields) > 3 {
+		return RatingBand{}, fmt.Errorf("could not parse rating band: %s", spec)
+	}
+
+	if !isRatingName(fields[0]) {
+		return RatingBand{}, fmt.Errorf("invalid name for rating band: %s", fields[0])
+	}
+	threshold, err := strconv.ParseFloat(fields[1], 32)
+	if err != nil || threshold < 0 || threshold > 100 {
+		return RatingBand{}, fmt.Errorf("invalid threshold for rating band: %s", fields[1])
+	}
+	band := RatingBand{Name: fields[0], Threshold: float32(threshold)}
+	if len(fields) == 3 {
+		if _, ok := ratingColors[fields[2]]; !ok {
+			return RatingBand{}, fmt.Errorf("unknown colour for rating band: %s", fields[2])
+		}
+		band.Color = fields[2]
+	}
+	return band, nil
+}
+
+// isRatingName checks that the name can be used as a class in the HTML
+// reports.
+func isRatingName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') && r != '-' && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// Ratings contains the rating schemes for each of the metrics.
+type Ratings struct {
+	Lines    RatingScheme
+	Funcs    RatingScheme
+	Branches RatingScheme
+	Regions  RatingScheme
+}
+
+// DefaultRatings returns the default rating scheme for all metrics.
+func DefaultRatings() Ratings {
+	rs := DefaultRatingScheme()
+	return Ratings{rs, rs, rs, rs}
+}
+
+// parseRatings creates the rating schemes from the command-line.  The
+// scheme all is used for any metric whose scheme is empty.  If all is also
+// empty, the default scheme is used.
+func parseRatings(all, lines, funcs, branches, regions string) (Ratings, error) {
+	base := DefaultRatingScheme()
+	if all != "" {
+		tmp, err := parseRatingScheme(all)
+		if err != nil {
+			return Ratings{}, err
+		}
+		base = tmp
+	}
+
+	out := Ratings{base, base, base, base}
+	for _, v := range []struct {
+		spec   string
+		scheme *RatingScheme
+	}{
+		{lines, &out.Lines},
+		{funcs, &out.Funcs},
+		{branches, &out.Branches},
+		{regions, &out.Regions},
+	} {
+		if v.spec == "" {
+			continue
+		}
+		tmp, err := parseRatingScheme(v.spec)
+		if err != nil {
+			return Ratings{}, err
+		}
+		*v.scheme = tmp
+	}
+
+	// The bands are identified by name in the HTML reports, so the same
+	// name cannot be used with different colours.
+	if _, err := out.bands(); err != nil {
+		return Ratings{}, err
+	}
+	return out, nil
+}
+
+// bands returns the bands used by all of the metrics, without duplicates.
+func (r Ratings) bands() ([]RatingBand, error) {
+	out := []RatingBand(nil)
+	for _, rs := range []RatingScheme{r.Lines, r.Funcs, r.Branches, r.Regions} {
+	next:
+		for _, v := range rs {
+			for _, prev := range out {
+				if prev.Name == v.Name {
+					if prev.Color != v.Color {
+						return nil, fmt.Errorf("rating band %s has different colours for different metrics, specify the colours explicitly", v.Name)
+					}
+					continue next
+				}
+			}
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+// CSS returns the style rules for the sparkbars in the HTML reports.
+func (r Ratings) CSS() template.CSS {
+	bands, _ := r.bands()
+
+	w := bytes.Buffer{}
+	for _, v := range bands {
+		fmt.Fprintf(&w, ".sparkbar .%s { background-color:%s; }\n", v.Name, v.colors().CSS)
+	}
+	return template.CSS(w.String())
+}
+
+// ratedCoverage is the coverage for a scope, along with its rating.
+type ratedCoverage struct {
+	Coverage
+	Rating RatingBand
+}
+
+func rateCoverage(rs RatingScheme, c Coverage) ratedCoverage {
+	return ratedCoverage{c, rs.Rate(c)}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRatingScheme_Rate(t *testing.T) {
+	cases := []struct {
+		hits     int
+		count    int
+		expected string
+	}{
+		{0, 0, "low"},
+		{0, 100, "low"},
+		{50, 100, "low"},
+		{74, 100, "low"},
+		{75, 100, "medium"},
+		{89, 100, "medium"},
+		{90, 100, "high"},
+		{45, 50, "high"},
+		{1000000, 1000000, "high"},
+	}
+
+	rs := DefaultRatingScheme()
+	for _, v := range cases {
+		cov := Coverage{v.hits, v.count}
+		t.Run(cov.String(), func(t *testing.T) {
+			if out := rs.Rate(cov).String(); out != v.expected {
+				LogNE(t, "rating", v.expected, out)
+			}
+		})
+	}
+
+	// Full coverage must always reach a threshold of 100, even when the
+	// percentage cannot be represented exactly.
+	rs = RatingScheme{{"full", 100, "green"}, {"partial", 0, "red"}}
+	for _, v := range []Coverage{{1, 1}, {671089, 671089}, {1000000, 1000000}} {
+		if out := rs.Rate(v).String(); out != "full" {
+			LogNE(t, "rating", "full", out)
+		}
+	}
+	if out := rs.Rate(Coverage{999999, 1000000}).String(); out != "partial" {
+		LogNE(t, "rating", "partial", out)
+	}
+}
+
+func TestParseRatingScheme(t *testing.T) {
+	cases := []struct {
+		in       string
+		expected RatingScheme
+	}{
+		{"high:90,medium:75,low:0", RatingScheme{
+			{"high", 90, "green"},
+			{"medium", 75, "yellow"},
+			{"low", 0, "red"},
+		}},
+		{"pass:100:blue, fail:0", RatingScheme{
+			{"pass", 100, "blue"},
+			{"fail", 0, "red"},
+		}},
+		{"a:100,b:95,c:80,d:50,e:0", RatingScheme{
+			{"a", 100, "green"},
+			{"b", 95, "yellowgreen"},
+			{"c", 80, "yellow"},
+			{"d", 50, "orange"},
+			{"e", 0, "red"},
+		}},
+		{"only:0", RatingScheme{
+			{"only", 0, "green"},
+		}},
+		{"", nil},
+		{"high", nil},
+		{"high:90:green:x", nil},
+		{"high:abc", nil},
+		{"high:101", nil},
+		{"high:-1", nil},
+		{"high:90:purple", nil},
+		{"9high:90", nil},
+		{"hi gh:90", nil},
+		{"low:0,high:90", nil},
+		{"high:90,high:80", nil},
+	}
+
+	for _, v := range cases {
+		t.Run(v.in, func(t *testing.T) {
+			out, err := parseRatingScheme(v.in)
+			if (err == nil) != (v.expected != nil) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(out, v.expected) {
+				LogNE(t, "scheme", v.expected, out)
+			}
+		})
+	}
+}
+
+func TestParseRatings(t *testing.T) {
+	out, err := parseRatings("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(out, DefaultRatings()) {
+		LogNE(t, "ratings", DefaultRatings(), out)
+	}
+
+	out, err = parseRatings("high:100:green,low:0:red", "", "", "high:95:green,medium:80:yellow,low:0:red", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out.Lines.Names() != "high low" || out.Funcs.Names() != "high low" || out.Regions.Names() != "high low" {
+		t.Errorf("global scheme not applied")
+	}
+	if out.Branches.Names() != "high medium low" {
+		LogNE(t, "branch bands", "high medium low", out.Branches.Names())
+	}
+	if rb := out.Branches.Rate(Coverage{96, 100}); rb.Name != "high" {
+		LogNE(t, "rating", "high", rb.Name)
+	}
+	if rb := out.Lines.Rate(Coverage{96, 100}); rb.Name != "low" {
+		LogNE(t, "rating", "low", rb.Name)
+	}
+
+	// Errors in any of the schemes are reported.
+	for _, v := range [][5]string{
+		{"bad", "", "", "", ""},
+		{"", "bad", "", "", ""},
+		{"", "", "bad", "", ""},
+		{"", "", "", "bad", ""},
+		{"", "", "", "", "bad"},
+		{"high:90:green,low:0", "high:90:blue,low:0", "", "", ""},
+	} {
+		_, err := parseRatings(v[0], v[1], v[2], v[3], v[4])
+		if err == nil {
+			t.Errorf("unexpected success: %q", v)
+		}
+	}
+}
+
+func TestRatings_CSS(t *testing.T) {
+	const expected = `.sparkbar .high { background-color:lightgreen; }
+.sparkbar .medium { background-color:yellow; }
+.sparkbar .low { background-color:red; }
+`
+
+	if out := DefaultRatings().CSS(); string(out) != expected {
+		LogNE(t, "css", expected, out)
+	}
+
+	ratings := DefaultRatings()
+	ratings.Branches = RatingScheme{{"perfect", 100, "blue"}, {"low", 0, "red"}}
+	const expected2 = expected + `.sparkbar .perfect { background-color:lightblue; }
+`
+	if out := ratings.CSS(); string(out) != expected2 {
+		LogNE(t, "css", expected2, out)
+	}
+}
+
+func TestRatingBand_Colors(t *testing.T) {
+	rb := RatingBand{"high", 90, "green"}
+	if out := rb.colors(); out.Badge != "#4c1" || out.Shields != "brightgreen" {
+		LogNE(t, "colours", ratingColors["green"], out)
+	}
+
+	rb = RatingBand{"unknown", 90, ""}
+	if out := rb.colors(); out.Shields != "lightgrey" {
+		LogNE(t, "colours", "lightgrey", out.Shields)
+	}
+}
@@ -12,33 +12,51 @@ type Report struct {
 	TestID     string
 	SrcID      string
 	SrcDir     string
+	SrcPath    []string // Additional directories to search for source files.
 	ProjectURL string
 
 	// Configuration
 	AllowHTMLScripting bool
+	HTMLJobs           int     // Number of source pages rendered in parallel.
+	SkipMissingSources bool    // Skip the pages for missing source files, instead of writing a summary.
+	MarkdownDirs       bool    // Include the coverage by directory in the markdown report.
+	TextDepth          int     // Depth limit for directories in the text report.
+	Ratings            Ratings // Bands used to rate the coverage for each metric.
+	HeatMap            bool    // Colour the source listings by hit count.
+	Hotspots           int     // Number of lines and functions listed as hotspots.
 
-	LCoverage Coverage
-	FCoverage Coverage
-	BCoverage Coverage
-	RCoverage Coverage
-	Files     []FileStatistics
-	Funcs     []FuncStatistics
-	Date      time.Time
+	LCoverage  Coverage
+	FCoverage  Coverage
+	BCoverage  Coverage
+	RCoverage  Coverage
+	Files      []FileStatistics
+	Funcs      []FuncStatistics
+	HotLines   []HotLine       // Lines with the highest hit counts.
+	History    []HistoryRecord // Summaries of recent runs, oldest first, including this run.
+	Dirs       *DirStatistics
+	Components []GroupStatistics
+	Owners     []GroupStatistics
+	Date       time.Time
+
+	// Source files that could not be found when writing the HTML report.
+	MissingSources map[string]bool
 }
 
 // NewReport initializes a new report.
 func NewReport(title string) *Report {
 	return &Report{
-		Title: title,
-		Date:  time.Now().UTC(),
+		Title:   title,
+		Ratings: DefaultRatings(),
+		Date:    time.Now().UTC(),
 	}
 }
 
 // NewTestReport initializes a new report for use in testing.
 func NewTestReport() *Report {
 	return &Report{
-		Title: "SCov",
-		Date:  time.Date(2006, 01, 02, 15, 4, 5, 6, time.UTC),
+		Title:   "SCov",
+		Ratings: DefaultRatings(),
+		Date:    time.Date(2006, 01, 02, 15, 4, 5, 6, time.UTC),
 	}
 }
 
@@ -49,6 +67,7 @@ type FileStatistics struct {
 	FCoverage Coverage
 	BCoverage Coverage
 	RCoverage Coverage
+	FirstMiss int // First line that was not executed, or zero.
 }
 
 // FuncStatistics is used to capture data for a function.
@@ -56,57 +75,93 @@ type FuncStatistics struct {
 	Name      string
 	Filename  string
 	StartLine int
+	EndLine   int
 	HitCount  uint64
+	LCoverage Coverage // Line coverage for the body of the function.
 }
 
 // CollectStatistics iterates over the file data, and assembles coverage
 // statistics for the set.  It also assembles coverage statistics for each
 // source file, and each function.
 func (r *Report) CollectStatistics(data map[string]*FileData) {
-	// Preallocate space for our statistics
-	files := make([]FileStatistics, 0, len(data))
-	funcs := make([]FuncStatistics, 0, len(data))
-
-	LCov := Coverage{}
-	FCov := Coverage{}
-	BCov := Coverage{}
-	RCov := Coverage{}
+	c := newStatisticsCollector(len(data), r.Hotspots)
 	for filename, data := range data {
-		stats := FileStatistics{Name: filename}
-
-		stats.LCoverage = data.LineCoverage()
-		LCov = LCov.Add(stats.LCoverage)
-		stats.FCoverage = data.FuncCoverage()
-		FCov = FCov.Add(stats.FCoverage)
-		stats.BCoverage = data.BranchCoverage()
-		BCov = BCov.Add(stats.BCoverage)
-		stats.RCoverage = data.RegionCoverage()
-		RCov = RCov.Add(stats.RCoverage)
-
-		files = append(files, stats)
-
-		for name, data := range data.FuncData {
-			funcs = append(funcs, FuncStatistics{
-				Name:      name,
-				Filename:  filename,
-				StartLine: data.StartLine,
-				HitCount:  data.HitCount,
-			})
-		}
+		c.Add(filename, data)
+	}
+	c.Finish(r)
+}
+
+// CollectCompactStatistics is equivalent to CollectStatistics, but reads the
+// data from a CompactFileDataSet.  Only a single file is expanded at a time.
+func (r *Report) CollectCompactStatistics(data *CompactFileDataSet) {
+	c := newStatisticsCollector(data.Len(), r.Hotspots)
+	for _, filename := range data.Filenames() {
+		c.Add(filename, data.Lookup(filename))
 	}
-	sort.Slice(files, func(i, j int) bool {
-		return files[i].Name < files[j].Name
+	c.Finish(r)
+}
+
+// statisticsCollector accumulates coverage statistics one file at a time, so
+// that the data for each file can be discarded once it has been added.
+type statisticsCollector struct {
+	files []FileStatistics
+	funcs []FuncStatistics
+	hot   []HotLine
+	limit int // Maximum number of hot lines.
+	lcov  Coverage
+	fcov  Coverage
+	bcov  Coverage
+	rcov  Coverage
+}
+
+func newStatisticsCollector(capacity int, hotspots int) *statisticsCollector {
+	// Preallocate space for our statistics
+	return &statisticsCollector{
+		files: make([]FileStatistics, 0, capacity),
+		funcs: make([]FuncStatistics, 0, capacity),
+		limit: hotspots,
+	}
+}
+
+// Add calculates the coverage statistics for a single file.
+func (c *statisticsCollector) Add(filename string, data *FileData) {
+	stats := FileStatistics{Name: filename, FirstMiss: data.FirstMiss()}
+
+	stats.LCoverage = data.LineCoverage()
+	c.lcov = c.lcov.Add(stats.LCoverage)
+	stats.FCoverage = data.FuncCoverage()
+	c.fcov = c.fcov.Add(stats.FCoverage)
+	stats.BCoverage = data.BranchCoverage()
+	c.bcov = c.bcov.Add(stats.BCoverage)
+	stats.RCoverage = data.RegionCoverage()
+	c.rcov = c.rcov.Add(stats.RCoverage)
+
+	c.files = append(c.files, stats)
+
+	c.funcs = append(c.funcs, data.FuncStatistics(filename)...)
+	c.hot = addHotLines(c.hot, filename, data, c.limit)
+}
+
+// Finish sorts the statistics, and stores them in the report.
+func (c *statisticsCollector) Finish(r *Report) {
+	sort.Slice(c.files, func(i, j int) bool {
+		return c.files[i].Name < c.files[j].Name
 	})
-	sort.Slice(funcs, func(i, j int) bool {
-		return funcs[i].Name < funcs[j].Name
+	sort.Slice(c.funcs, func(i, j int) bool {
+		if c.funcs[i].Name != c.funcs[j].Name {
+			return c.funcs[i].Name < c.funcs[j].Name
+		}
+		return c.funcs[i].Filename < c.funcs[j].Filename
 	})
 
-	r.LCoverage = LCov
-	r.FCoverage = FCov
-	r.BCoverage = BCov
-	r.RCoverage = RCov
-	r.Files = files
-	r.Funcs = funcs
+	r.LCoverage = c.lcov
+	r.FCoverage = c.fcov
+	r.BCoverage = c.bcov
+	r.RCoverage = c.rcov
+	r.Files = c.files
+	r.Funcs = c.funcs
+	r.HotLines = c.hot
+	r.Dirs = NewDirTree(c.files)
 }
 
 // UnixDate returns the date of the report formatted to the format time.UnixDate.
@@ -48,7 +48,7 @@ func TestReportCollectStatistics(t *testing.T) {
 		t.Run(v.filename, func(t *testing.T) {
 			data := make(FileDataSet)
 
-			err := loadFile(data, filepath.Join("./testdata", v.filename))
+			err := loadFile(data, filepath.Join("./testdata", v.filename), loadOptions{})
 			if err != nil {
 				t.Fatalf("could not read file: %s", err)
 			}
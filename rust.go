@@ -0,0 +1,701 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// rustExternalPath matches source files that belong to third-party crates or
+// to the standard library.  Crates downloaded by cargo are stored under
+// CARGO_HOME, in the registry or in git checkouts, and the directories
+// include a hash of the source.  The standard library is reported either
+// with the remapped prefix /rustc/<commit>, or under the toolchain
+// installed by rustup.
+var rustExternalPath = regexp.MustCompile(`(^|/)\.cargo/(registry|git)/` +
+	`|(^|/)registry/src/[^/]+-[0-9a-f]{16}/` +
+	`|(^|/)git/checkouts/[^/]+-[0-9a-f]{16}/` +
+	`|^/rustc/[0-9a-f]+/` +
+	`|(^|/)lib/rustlib/src/rust/`)
+
+// isRustExternalFile returns true if the file belongs to a third-party
+// crate or to the standard library.  Those files can appear with relative
+// paths when CARGO_HOME is inside the source directory, which is common for
+// CI jobs.
+func isRustExternalFile(filename string) bool {
+	return rustExternalPath.MatchString(filepath.ToSlash(filename))
+}
+
+// demangleRust converts Rust symbol names to a readable form.  Both the
+// legacy mangling scheme and the v0 mangling scheme are supported.  Hashes
+// and crate disambiguators are dropped, so that the names match the source.
+// If the name is not a Rust symbol, or cannot be parsed, the name is
+// returned unchanged.
+func demangleRust(name string) string {
+	if out, ok := demangleRustLegacy(name); ok {
+		return out
+	}
+	if out, ok := demangleRustV0(name); ok {
+		return out
+	}
+	return name
+}
+
+// demangleRustLegacy demangles symbols using the legacy scheme.  The scheme
+// is based on the mangling for C++, but the path always ends with a hash.
+func demangleRustLegacy(name string) (string, bool) {
+	switch {
+	case strings.HasPrefix(name, "_ZN"):
+		name = name[3:]
+	case strings.HasPrefix(name, "__ZN"):
+		name = name[4:]
+	case strings.HasPrefix(name, "ZN"):
+		name = name[2:]
+	default:
+		return "", false
+	}
+
+	parts := []string(nil)
+	for {
+		if name == "" {
+			return "", false
+		}
+		if name[0] == 'E' {
+			name = name[1:]
+			break
+		}
+
+		n, i := 0, 0
+		for ; i < len(name) && isDigit(name[i]); i++ {
+			n = n*10 + int(name[i]-'0')
+			if n > len(name) {
+				return "", false
+			}
+		}
+		if i == 0 || n > len(name)-i {
+			return "", false
+		}
+		parts = append(parts, name[i:i+n])
+		name = name[i+n:]
+	}
+	// LLVM may add a suffix, such as .llvm.<number>, to local symbols.
+	if name != "" && name[0] != '.' {
+		return "", false
+	}
+	if len(parts) < 2 || !isRustHash(parts[len(parts)-1]) {
+		return "", false
+	}
+	parts = parts[:len(parts)-1]
+
+	for i, v := range parts {
+		tmp, ok := unescapeRustLegacy(v)
+		if !ok {
+			return "", false
+		}
+		parts[i] = tmp
+	}
+	return strings.Join(parts, "::"), true
+}
+
+// isRustHash checks for the hash that ends symbols using the legacy scheme.
+func isRustHash(s string) bool {
+	if len(s) != 17 || s[0] != 'h' {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isDigit(s[i]) && (s[i] < 'a' || s[i] > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// rustLegacyEscapes contains the escapes used by the legacy scheme for
+// punctuation.
+var rustLegacyEscapes = map[string]string{
+	"SP": "@",
+	"BP": "*",
+	"RF": "&",
+	"LT": "<",
+	"GT": ">",
+	"LP": "(",
+	"RP": ")",
+	"C":  ",",
+}
+
+func unescapeRustLegacy(s string) (string, bool) {
+	if strings.HasPrefix(s, "_$") {
+		s = s[1:]
+	}
+
+	out := make([]byte, 0, len(s))
+	for len(s) > 0 {
+		switch {
+		case strings.HasPrefix(s, ".."):
+			out = append(out, "::"...)
+			s = s[2:]
+
+		case s[0] == '$':
+			end := strings.IndexByte(s[1:], '$')
+			if end < 0 {
+				return "", false
+			}
+			escape := s[1 : end+1]
+			s = s[end+2:]
+
+			if v, ok := rustLegacyEscapes[escape]; ok {
+				out = append(out, v...)
+			} else if strings.HasPrefix(escape, "u") {
+				r, err := strconv.ParseUint(escape[1:], 16, 32)
+				if err != nil {
+					return "", false
+				}
+				out = append(out, string(rune(r))...)
+			} else {
+				return "", false
+			}
+
+		default:
+			out = append(out, s[0])
+			s = s[1:]
+		}
+	}
+	return string(out), true
+}
+
+// demangleRustV0 demangles symbols using the v0 scheme.  See RFC 2603 for
+// the grammar.
+func demangleRustV0(name string) (string, bool) {
+	switch {
+	case strings.HasPrefix(name, "_R"):
+		name = name[2:]
+	case strings.HasPrefix(name, "__R"):
+		name = name[3:]
+	default:
+		return "", false
+	}
+	// Drop any vendor-specific suffix.
+	if i := strings.IndexAny(name, ".$"); i >= 0 {
+		name = name[:i]
+	}
+
+	p := rustV0Parser{s: name}
+	out, err := p.path(true)
+	if err != nil {
+		return "", false
+	}
+	if p.pos < len(p.s) {
+		// The instantiating crate is not shown.
+		if _, err := p.path(false); err != nil {
+			return "", false
+		}
+	}
+	if p.pos != len(p.s) {
+		return "", false
+	}
+	return out, true
+}
+
+var errRustSymbol = errors.New("invalid Rust symbol")
+
+// rustV0Basic contains the names of the basic types.
+var rustV0Basic = map[byte]string{
+	'a': "i8",
+	'b': "bool",
+	'c': "char",
+	'd': "f64",
+	'e': "str",
+	'f': "f32",
+	'h': "u8",
+	'i': "isize",
+	'j': "usize",
+	'l': "i32",
+	'm': "u32",
+	'n': "i128",
+	'o': "u128",
+	's': "i16",
+	't': "u16",
+	'u': "()",
+	'v': "...",
+	'x': "i64",
+	'y': "u64",
+	'z': "!",
+	'p': "_",
+}
+
+// rustV0Parser demangles a symbol using the v0 scheme.  The symbol does not
+// include the prefix, so that positions match those used by backrefs.
+type rustV0Parser struct {
+	s     string
+	pos   int
+	depth int
+}
+
+func (p *rustV0Parser) next() (byte, error) {
+	if p.pos >= len(p.s) {
+		return 0, errRustSymbol
+	}
+	p.pos++
+	return p.s[p.pos-1], nil
+}
+
+func (p *rustV0Parser) eat(c byte) bool {
+	if p.pos < len(p.s) && p.s[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// base62 parses a base-62 number, which is terminated by an underscore.
+func (p *rustV0Parser) base62() (uint64, error) {
+	if p.eat('_') {
+		return 0, nil
+	}
+
+	value := uint64(0)
+	for {
+		c, err := p.next()
+		if err != nil {
+			return 0, err
+		}
+
+		var digit byte
+		switch {
+		case c == '_':
+			return value + 1, nil
+		case isDigit(c):
+			digit = c - '0'
+		case c >= 'a' && c <= 'z':
+			digit = c - 'a' + 10
+		case c >= 'A' && c <= 'Z':
+			digit = c - 'A' + 36
+		default:
+			return 0, errRustSymbol
+		}
+		if value > (^uint64(0)-uint64(digit))/62 {
+			return 0, errRustSymbol
+		}
+		value = value*62 + uint64(digit)
+	}
+}
+
+// optBase62 parses an optional base-62 number, which is identified by the
+// tag.  If the tag is missing, the value is zero.
+func (p *rustV0Parser) optBase62(tag byte) (uint64, error) {
+	if !p.eat(tag) {
+		return 0, nil
+	}
+	value, err := p.base62()
+	return value + 1, err
+}
+
+// decimal parses a decimal number.  Leading zeros are not allowed, so a zero
+// is always a single digit.
+func (p *rustV0Parser) decimal() (int, error) {
+	if p.eat('0') {
+		return 0, nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.s) && isDigit(p.s[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start {
+		return 0, errRustSymbol
+	}
+	return strconv.Atoi(p.s[start:p.pos])
+}
+
+// ident parses an identifier, returning the name and the disambiguator.
+func (p *rustV0Parser) ident() (string, uint64, error) {
+	dis, err := p.optBase62('s')
+	if err != nil {
+		return "", 0, err
+	}
+	name, err := p.undisambiguatedIdent()
+	return name, dis, err
+}
+
+func (p *rustV0Parser) undisambiguatedIdent() (string, error) {
+	if p.eat('u') {
+		// Identifiers with non-ASCII characters use punycode, which is not
+		// supported.
+		return "", errRustSymbol
+	}
+	n, err := p.decimal()
+	if err != nil {
+		return "", err
+	}
+	p.eat('_')
+	if n > len(p.s)-p.pos {
+		return "", errRustSymbol
+	}
+	p.pos += n
+	return p.s[p.pos-n : p.pos], nil
+}
+
+// backref parses the target of a backref, and then calls fn to parse the
+// data at that position.
+func (p *rustV0Parser) backref(fn func() (string, error)) (string, error) {
+	start := p.pos - 1
+	target, err := p.base62()
+	if err != nil {
+		return "", err
+	}
+	if target >= uint64(start) {
+		return "", errRustSymbol
+	}
+
+	saved := p.pos
+	p.pos = int(target)
+	out, err := fn()
+	p.pos = saved
+	return out, err
+}
+
+// enter guards against deeply nested symbols.
+func (p *rustV0Parser) enter() error {
+	p.depth++
+	if p.depth > 100 {
+		return errRustSymbol
+	}
+	return nil
+}
+
+func (p *rustV0Parser) path(inValue bool) (string, error) {
+	if err := p.enter(); err != nil {
+		return "", err
+	}
+	defer func() { p.depth-- }()
+
+	tag, err := p.next()
+	if err != nil {
+		return "", err
+	}
+
+	switch tag {
+	case 'C': // Crate root
+		name, _, err := p.ident()
+		return name, err
+
+	case 'N': // Nested path
+		ns, err := p.next()
+		if err != nil {
+			return "", err
+		}
+		prefix, err := p.path(inValue)
+		if err != nil {
+			return "", err
+		}
+		name, dis, err := p.ident()
+		if err != nil {
+			return "", err
+		}
+
+		switch {
+		case ns >= 'A' && ns <= 'Z':
+			kind := string(ns)
+			if ns == 'C' {
+				kind = "closure"
+			} else if ns == 'S' {
+				kind = "shim"
+			}
+			if name != "" {
+				kind += ":" + name
+			}
+			return prefix + "::{" + kind + "#" + strconv.FormatUint(dis, 10) + "}", nil
+		case ns >= 'a' && ns <= 'z':
+			if name == "" {
+				return prefix, nil
+			}
+			return prefix + "::" + name, nil
+		}
+		return "", errRustSymbol
+
+	case 'M': // Inherent impl
+		if err := p.implPath(); err != nil {
+			return "", err
+		}
+		t, err := p.typ()
+		if err != nil {
+			return "", err
+		}
+		return "<" + t + ">", nil
+
+	case 'X': // Trait impl
+		if err := p.implPath(); err != nil {
+			return "", err
+		}
+		fallthrough
+
+	case 'Y': // Trait definition
+		t, err := p.typ()
+		if err != nil {
+			return "", err
+		}
+		trait, err := p.path(false)
+		if err != nil {
+			return "", err
+		}
+		return "<" + t + " as " + trait + ">", nil
+
+	case 'I': // Generic arguments
+		prefix, err := p.path(inValue)
+		if err != nil {
+			return "", err
+		}
+		args, err := p.list(p.genericArg)
+		if err != nil {
+			return "", err
+		}
+		if inValue {
+			prefix += "::"
+		}
+		return prefix + "<" + strings.Join(args, ", ") + ">", nil
+
+	case 'B':
+		return p.backref(func() (string, error) {
+			return p.path(inValue)
+		})
+	}
+	return "", errRustSymbol
+}
+
+// implPath parses the path for an impl, which is not shown.
+func (p *rustV0Parser) implPath() error {
+	if _, err := p.optBase62('s'); err != nil {
+		return err
+	}
+	_, err := p.path(false)
+	return err
+}
+
+// list calls fn until the list is terminated by an E.
+func (p *rustV0Parser) list(fn func() (string, error)) ([]string, error) {
+	out := []string(nil)
+	for !p.eat('E') {
+		v, err := fn()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func (p *rustV0Parser) genericArg() (string, error) {
+	if p.eat('L') {
+		_, err := p.base62()
+		return "'_", err
+	}
+	if p.eat('K') {
+		return p.konst()
+	}
+	return p.typ()
+}
+
+func (p *rustV0Parser) typ() (string, error) {
+	if err := p.enter(); err != nil {
+		return "", err
+	}
+	defer func() { p.depth-- }()
+
+	tag, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	if name, ok := rustV0Basic[tag]; ok {
+		return name, nil
+	}
+
+	switch tag {
+	case 'R', 'Q': // References
+		if p.eat('L') {
+			if _, err := p.base62(); err != nil {
+				return "", err
+			}
+		}
+		t, err := p.typ()
+		if tag == 'Q' {
+			return "&mut " + t, err
+		}
+		return "&" + t, err
+
+	case 'P':
+		t, err := p.typ()
+		return "*const " + t, err
+
+	case 'O':
+		t, err := p.typ()
+		return "*mut " + t, err
+
+	case 'A':
+		t, err := p.typ()
+		if err != nil {
+			return "", err
+		}
+		n, err := p.konst()
+		return "[" + t + "; " + n + "]", err
+
+	case 'S':
+		t, err := p.typ()
+		return "[" + t + "]", err
+
+	case 'T':
+		elems, err := p.list(p.typ)
+		if len(elems) == 1 {
+			return "(" + elems[0] + ",)", err
+		}
+		return "(" + strings.Join(elems, ", ") + ")", err
+
+	case 'F':
+		return p.fnSig()
+
+	case 'D':
+		return p.dynBounds()
+
+	case 'B':
+		return p.backref(p.typ)
+
+	case 'C', 'N', 'M', 'X', 'Y', 'I':
+		p.pos--
+		return p.path(false)
+	}
+	return "", errRustSymbol
+}
+
+func (p *rustV0Parser) fnSig() (string, error) {
+	if _, err := p.optBase62('G'); err != nil {
+		return "", err
+	}
+
+	prefix := ""
+	if p.eat('U') {
+		prefix = "unsafe "
+	}
+	if p.eat('K') {
+		abi := "C"
+		if !p.eat('C') {
+			tmp, err := p.undisambiguatedIdent()
+			if err != nil {
+				return "", err
+			}
+			abi = strings.Replace(tmp, "_", "-", -1)
+		}
+		prefix += "extern \"" + abi + "\" "
+	}
+
+	params, err := p.list(p.typ)
+	if err != nil {
+		return "", err
+	}
+	ret, err := p.typ()
+	if err != nil {
+		return "", err
+	}
+
+	out := prefix + "fn(" + strings.Join(params, ", ") + ")"
+	if ret != "()" {
+		out += " -> " + ret
+	}
+	return out, nil
+}
+
+func (p *rustV0Parser) dynBounds() (string, error) {
+	if _, err := p.optBase62('G'); err != nil {
+		return "", err
+	}
+
+	traits, err := p.list(func() (string, error) {
+		trait, err := p.path(false)
+		if err != nil {
+			return "", err
+		}
+
+		bindings := []string(nil)
+		for p.eat('p') {
+			name, err := p.undisambiguatedIdent()
+			if err != nil {
+				return "", err
+			}
+			t, err := p.typ()
+			if err != nil {
+				return "", err
+			}
+			bindings = append(bindings, name+" = "+t)
+		}
+		if bindings == nil {
+			return trait, nil
+		}
+		if strings.HasSuffix(trait, ">") {
+			return trait[:len(trait)-1] + ", " + strings.Join(bindings, ", ") + ">", nil
+		}
+		return trait + "<" + strings.Join(bindings, ", ") + ">", nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// The lifetime for the trait object is not shown.
+	if !p.eat('L') {
+		return "", errRustSymbol
+	}
+	if _, err := p.base62(); err != nil {
+		return "", err
+	}
+	return "dyn " + strings.Join(traits, " + "), nil
+}
+
+// konst parses a constant, which are used for array lengths and const
+// generics.
+func (p *rustV0Parser) konst() (string, error) {
+	tag, err := p.next()
+	if err != nil {
+		return "", err
+	}
+
+	switch tag {
+	case 'p':
+		return "_", nil
+	case 'B':
+		return p.backref(p.konst)
+	case 'a', 'h', 'i', 'j', 'l', 'm', 'n', 'o', 's', 't', 'x', 'y':
+		neg := p.eat('n')
+		value, err := p.constData()
+		if neg {
+			return "-" + strconv.FormatUint(value, 10), err
+		}
+		return strconv.FormatUint(value, 10), err
+	case 'b':
+		value, err := p.constData()
+		if err != nil || value > 1 {
+			return "", errRustSymbol
+		}
+		return strconv.FormatBool(value == 1), nil
+	case 'c':
+		value, err := p.constData()
+		if err != nil || value > 0x10ffff {
+			return "", errRustSymbol
+		}
+		return strconv.QuoteRune(rune(value)), nil
+	}
+	return "", errRustSymbol
+}
+
+// constData parses the value of a constant, which is written in hex and
+// terminated by an underscore.
+func (p *rustV0Parser) constData() (uint64, error) {
+	end := strings.IndexByte(p.s[p.pos:], '_')
+	if end < 0 {
+		return 0, errRustSymbol
+	}
+	data := p.s[p.pos : p.pos+end]
+	p.pos += end + 1
+	if data == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(data, 16, 64)
+}
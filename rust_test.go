@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDemangleRust(t *testing.T) {
+	cases := []struct {
+		in       string
+		expected string
+	}{
+		// Legacy mangling
+		{"_ZN4core3fmt5write17h0123456789abcdefE", "core::fmt::write"},
+		{"__ZN4core3fmt5write17h0123456789abcdefE", "core::fmt::write"},
+		{"_ZN4core3fmt5write17h0123456789abcdefE.llvm.1234", "core::fmt::write"},
+		{"_ZN71_$LT$Test$u20$$u2b$$u20$$u27$static$u20$as$u20$foo..Bar$LT$Test$GT$$GT$3bar17h930b740aa94f1d3aE", "<Test + 'static as foo::Bar<Test>>::bar"},
+		{"_ZN4test1a2bc17h0123456789abcdefE", "test::a::bc"},
+		{"_ZN53_$LT$example..Point$u20$as$u20$core..fmt..Display$GT$3fmt17hcafebabecafebabeE", "<example::Point as core::fmt::Display>::fmt"},
+		{"_ZN4test4$RF$17h0123456789abcdefE", "test::&"},
+		// v0 mangling
+		{"_RNvCs15kBYyAo9fc_7mycrate7example", "mycrate::example"},
+		{"_RNvC6_123foo3bar", "123foo::bar"},
+		{"_RNCNCNgCs6DXkGYLi8lr_2cc5spawn00B5_", "cc::spawn::{closure#0}::{closure#0}"},
+		{"_RINbNbCskIICzLVDPPb_5alloc5alloc8box_freeDINbNiB4_5boxed5FnBoxuEp6OutputuEL_ECs1iopQbuBiw2_3std", "alloc::alloc::box_free::<dyn alloc::boxed::FnBox<(), Output = ()>>"},
+		{"_RNvMNtCs1234_7example5shapeNtB2_5Point3new", "<example::shape::Point>::new"},
+		{"_RNvXCs1234_7exampleNtB2_5PointNtNtCs5678_4core3fmt7Display3fmt", "<example::Point as core::fmt::Display>::fmt"},
+		{"_RINvCs1234_7example4showRShEB2_", "example::show::<&[u8]>"},
+		{"_RINvCs1234_7example3sumKj3_EB2_", "example::sum::<3>"},
+		{"_RINvCs1234_7example5applyFmEuEB2_", "example::apply::<fn(u32)>"},
+		{"_RINvCs1234_7example4pairTlbEEB2_", "example::pair::<(i32, bool)>"},
+		{"_RNvCs1234_7example3foo.llvm.1234", "example::foo"},
+		// Names that are not mangled, or that are not Rust, are unchanged.
+		{"main", "main"},
+		{"gauss_get_sum", "gauss_get_sum"},
+		{"_ZN3foo3barEv", "_ZN3foo3barEv"},
+		{"_ZN3foo3barE", "_ZN3foo3barE"},
+		{"_ZN4core3fmt5write17h0123456789abcdef", "_ZN4core3fmt5write17h0123456789abcdef"},
+		{"_ZN4core3fm", "_ZN4core3fm"},
+		{"_ZN4core$u$17h0123456789abcdefE", "_ZN4core$u$17h0123456789abcdefE"},
+		{"_R", "_R"},
+		{"_RNvCs1234_7example3fooZ", "_RNvCs1234_7example3fooZ"},
+		{"_RNvB_3foo", "_RNvB_3foo"},
+		{"_RNvCs1234_7example99foo", "_RNvCs1234_7example99foo"},
+		{"_RNvCs1234_7exampleu3foo", "_RNvCs1234_7exampleu3foo"},
+	}
+
+	for _, v := range cases {
+		t.Run(v.in, func(t *testing.T) {
+			if out := demangleRust(v.in); out != v.expected {
+				LogNE(t, "name", v.expected, out)
+			}
+		})
+	}
+}
+
+func TestIsRustExternalFile(t *testing.T) {
+	cases := []struct {
+		in       string
+		expected bool
+	}{
+		{"src/main.rs", false},
+		{"src/registry/mod.rs", false},
+		{"/home/person/.cargo/registry/src/index.crates.io-6f17d22bba15001f/memchr-2.7.1/src/lib.rs", true},
+		{".cargo/registry/src/index.crates.io-6f17d22bba15001f/memchr-2.7.1/src/lib.rs", true},
+		{".cargo/git/checkouts/serde-1234567890abcdef/abc1234/src/lib.rs", true},
+		{"cargo_home/registry/src/index.crates.io-6f17d22bba15001f/memchr-2.7.1/src/lib.rs", true},
+		{"cargo_home/git/checkouts/serde-1234567890abcdef/abc1234/src/lib.rs", true},
+		{"/rustc/90b35a6239c3d8bdabc530a6a0816f7ff89a0aaf/library/core/src/fmt/mod.rs", true},
+		{"/home/person/.rustup/toolchains/stable-x86_64-unknown-linux-gnu/lib/rustlib/src/rust/library/std/src/io/mod.rs", true},
+	}
+
+	for _, v := range cases {
+		if out := isRustExternalFile(v.in); out != v.expected {
+			t.Errorf("%s: expected %v, got %v", v.in, v.expected, out)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// findSourceFile locates a source file.  The source directory is searched
+// first, then the name itself if it is absolute, and finally the directories
+// in the search path.  If the file is not found, the return is the filename
+// within the source directory.
+func findSourceFile(srcdir string, srcpath []string, sourcename string) (string, bool) {
+	candidates := make([]string, 0, len(srcpath)+2)
+	candidates = append(candidates, filepath.Join(srcdir, sourcename))
+	if filepath.IsAbs(sourcename) {
+		candidates = append(candidates, sourcename)
+	}
+	for _, v := range srcpath {
+		candidates = append(candidates, filepath.Join(v, sourcename))
+	}
+
+	for _, v := range candidates {
+		if info, err := os.Stat(v); err == nil && info.Mode().IsRegular() {
+			return v, true
+		}
+	}
+	return candidates[0], false
+}
+
+// scanSourceLines reads the source, and calls fn with the code on each line.
+// Comments and preprocessor directives are removed from the code, as is any
+// leading or trailing whitespace.  The lexing rules are selected based on the
+// file's extension.
+func scanSourceLines(r io.Reader, filename string, fn func(lineNo int, code string)) error {
+	h := newHighlighter(filename)
+	code := []byte(nil)
+
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+
+		code = code[:0]
+		for _, v := range h.tokens(line) {
+			if v.Class != hlComment && v.Class != hlPreprocessor {
+				code = append(code, line[v.Start:v.End]...)
+			}
+		}
+		fn(lineNo, strings.TrimSpace(string(code)))
+	}
+	return scanner.Err()
+}
+
+// estimateExecutableLines returns the line numbers of the lines in the source
+// that might contain executable code.  Without a compiler, this can only be
+// an estimate, so any line that is not blank, a comment, or a preprocessor
+// directive is counted.
+func estimateExecutableLines(r io.Reader, filename string) ([]int, error) {
+	out := []int(nil)
+	err := scanSourceLines(r, filename, func(lineNo int, code string) {
+		if code != "" {
+			out = append(out, lineNo)
+		}
+	})
+	return out, err
+}
+
+// readCodeLines returns the set of lines in the source that contain code.
+// This is stricter than estimateExecutableLines, as lines that only contain
+// braces or similar punctuation are also skipped.  The result is used to
+// decide which lines are covered by a region, so that the line coverage
+// inferred from regions is comparable with the line coverage from gcov.
+func readCodeLines(r io.Reader, filename string) (map[int]bool, error) {
+	out := make(map[int]bool)
+	err := scanSourceLines(r, filename, func(lineNo int, code string) {
+		if code != "" && !isBraceOnly(code) {
+			out[lineNo] = true
+		}
+	})
+	return out, err
+}
+
+// isBraceOnly returns true if the code only contains braces, brackets, and
+// separators, such as the closing brace of a block.
+func isBraceOnly(code string) bool {
+	return strings.Trim(code, "{}()[];, \t") == ""
+}
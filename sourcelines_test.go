@@ -0,0 +1,87 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEstimateExecutableLines(t *testing.T) {
+	cases := []struct {
+		filename string
+		source   string
+		expected []int
+	}{
+		{"a.c", "", nil},
+		{"a.c", "int a;\n\n  \nint b;\n", []int{1, 4}},
+		{"a.c", "// comment\nint a; // trailing\n", []int{2}},
+		{"a.c", "/* one\n two\n */ int a;\n", []int{3}},
+		{"a.c", "#include <stdio.h>\n#define A \\\n  1\nint a;\n", []int{4}},
+		{"a.c", "char *s = \"/* no comment\";\nint a;\n", []int{1, 2}},
+		{"a.cpp", "  # if 0\nint a;\n#endif\n", []int{2}},
+		{"a.go", "package main\n\n// Comment\nvar s = `\n// raw\n`\n", []int{1, 4, 5, 6}},
+		{"a.go", "#notpreprocessor\n", []int{1}},
+		{"a.txt", "// text\n\nhello\n", []int{1, 3}},
+	}
+
+	for _, v := range cases {
+		t.Run(v.filename, func(t *testing.T) {
+			out, err := estimateExecutableLines(strings.NewReader(v.source), v.filename)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(out, v.expected) {
+				LogNE(t, "lines", v.expected, out)
+			}
+		})
+	}
+}
+
+func TestReadCodeLines(t *testing.T) {
+	cases := []struct {
+		filename string
+		source   string
+		expected map[int]bool
+	}{
+		{"a.c", "", map[int]bool{}},
+		{"a.c", "int main() {\n\n\t// comment\n\treturn 0;\n}\n", map[int]bool{1: true, 4: true}},
+		{"a.c", "#ifdef A\nf(a,\n  b\n);\n#endif\n", map[int]bool{2: true, 3: true}},
+		{"a.c", "if (a) {\n} else {\n}\n", map[int]bool{1: true, 2: true}},
+		{"a.go", "func f() {\n\tg(func() {\n\t})\n}\n", map[int]bool{1: true, 2: true}},
+	}
+
+	for _, v := range cases {
+		t.Run(v.source, func(t *testing.T) {
+			out, err := readCodeLines(strings.NewReader(v.source), v.filename)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(out, v.expected) {
+				LogNE(t, "lines", v.expected, out)
+			}
+		})
+	}
+}
+
+func TestIsBraceOnly(t *testing.T) {
+	cases := []struct {
+		code     string
+		expected bool
+	}{
+		{"", true},
+		{"{", true},
+		{"}", true},
+		{"};", true},
+		{"})", true},
+		{"} else {", false},
+		{"return;", false},
+	}
+
+	for _, v := range cases {
+		t.Run(v.code, func(t *testing.T) {
+			if out := isBraceOnly(v.code); out != v.expected {
+				LogNE(t, "brace only", v.expected, out)
+			}
+		})
+	}
+}
@@ -11,13 +11,26 @@ import (
 func writeStdoutReport(w io.Writer, report *Report) {
 	f := sgr.NewFormatterForWriter(w)
 
-	writeStdoutCoverage(w, f, "Line coverage", report.LCoverage)
-	writeStdoutCoverage(w, f, "Func coverage", report.FCoverage)
-	writeStdoutCoverage(w, f, "Branch coverage", report.BCoverage)
-	writeStdoutCoverage(w, f, "Region coverage", report.RCoverage)
+	writeStdoutCoverage(w, f, "Line coverage", report.LCoverage, report.Ratings.Lines)
+	writeStdoutCoverage(w, f, "Func coverage", report.FCoverage, report.Ratings.Funcs)
+	writeStdoutCoverage(w, f, "Branch coverage", report.BCoverage, report.Ratings.Branches)
+	writeStdoutCoverage(w, f, "Region coverage", report.RCoverage, report.Ratings.Regions)
+
+	if len(report.Components) > 0 {
+		fmt.Fprintf(w, "\nLine coverage by component:\n")
+		for _, v := range report.Components {
+			writeStdoutCoverage(w, f, v.Name, v.LCoverage, report.Ratings.Lines)
+		}
+	}
+	if len(report.Owners) > 0 {
+		fmt.Fprintf(w, "\nLine coverage by owner:\n")
+		for _, v := range report.Owners {
+			writeStdoutCoverage(w, f, v.Name, v.LCoverage, report.Ratings.Lines)
+		}
+	}
 }
 
-func writeStdoutCoverage(w io.Writer, f *sgr.Formatter, name string, cov Coverage) {
+func writeStdoutCoverage(w io.Writer, f *sgr.Formatter, name string, cov Coverage, rs RatingScheme) {
 	if !cov.Valid() {
 		fmt.Fprintf(w, "%15s:  No data\n", name)
 		return
@@ -28,21 +41,8 @@ func writeStdoutCoverage(w io.Writer, f *sgr.Formatter, name string, cov Coverag
 		plot.HorizontalBar(
 			f,
 			float64(cov.P()*0.01),
-			ratingToColor(cov.Rating())),
+			rs.Rate(cov).colors().Term),
 		cov.P(),
 		cov.Hits,
 		cov.Total)
 }
-
-func ratingToColor(r CoverageRating) sgr.Color {
-	switch r {
-	case LowCoverage:
-		return sgr.Red
-	case MediumCoverage:
-		return sgr.BrightYellow
-	case HighCoverage:
-		return sgr.BrightGreen
-	default:
-		return sgr.Default
-	}
-}
@@ -21,7 +21,7 @@ func TestWriteStdoutReport(t *testing.T) {
 		v := v
 		t.Run(v.filename, func(t *testing.T) {
 			data := make(map[string]*FileData)
-			err := loadFile(data, filepath.Join("./testdata", v.filename))
+			err := loadFile(data, filepath.Join("./testdata", v.filename), loadOptions{})
 			if err != nil {
 				t.Fatalf("could not read file: %s", err)
 			}
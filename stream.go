@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// summaryStream calculates coverage statistics while the data is being
+// loaded.  Once the statistics for a file have been calculated, the per-line
+// data for that file is discarded.  This limits the memory required for very
+// large data sets, but only summary reports can be created.
+//
+// Since the per-line data is discarded, data for a source file cannot be
+// merged across records.  Tracefiles should be combined before streaming,
+// for example using 'lcov -a'.
+type summaryStream struct {
+	filter    fileFilter
+	collector *statisticsCollector
+	seen      map[string]bool
+}
+
+func (s *summaryStream) flush(fds FileDataSet) error {
+	fds, err := s.filter.apply(fds)
+	if err != nil {
+		return err
+	}
+	fds.ConvertRegionToCodeLines(s.filter.codeLines)
+
+	for filename, data := range fds {
+		if s.seen[filename] {
+			return fmt.Errorf("data for %s is split across multiple records, which is not supported when streaming", filename)
+		}
+		s.seen[filename] = true
+		s.collector.Add(filename, data)
+	}
+	return nil
+}
+
+// streamStatistics loads the coverage data from the named files, and
+// collects the statistics into the report.
+func streamStatistics(report *Report, filenames []string, opts loadOptions, filter fileFilter) error {
+	s := summaryStream{
+		filter:    filter,
+		collector: newStatisticsCollector(0, report.Hotspots),
+		seen:      make(map[string]bool),
+	}
+
+	profile, err := walkProfiles(filenames, opts, func(parser Parser, file *os.File) error {
+		return parser.streamFile(file, opts, s.flush)
+	})
+	if err != nil {
+		return err
+	}
+	if !profile.empty() {
+		fds := make(FileDataSet)
+		err := loadLLVMProfile(fds, profile, opts)
+		if err != nil {
+			return err
+		}
+		err = s.flush(fds)
+		if err != nil {
+			return err
+		}
+	}
+
+	extra, err := filter.addUninstrumented(func(name string) bool {
+		return s.seen[name]
+	})
+	if err != nil {
+		return err
+	}
+	for filename, data := range extra {
+		s.collector.Add(filename, data)
+	}
+
+	s.collector.Finish(report)
+	return nil
+}
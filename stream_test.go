@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStreamStatistics(t *testing.T) {
+	cases := []struct {
+		filename string
+		ok       bool
+	}{
+		{"example-7.4.0-branches", true},
+		{"example-9.1.0.c.gcov.json.gz", true},
+		{"example-lcov-1.13.info", true},
+		{"example-llvm-8.0.1.info", true},
+		{"example-llvm-8.0.1.json", true},
+		{"scov-1.10.4.out", true},
+	}
+
+	for _, v := range cases {
+		t.Run(v.filename, func(t *testing.T) {
+			filter := newFileFilter(bytes.NewBuffer(nil), "/example/", nil, true, "", nil)
+
+			expected := NewTestReport()
+			data, err := loadFileData([]string{filepath.Join("./testdata", v.filename)}, loadOptions{}, filter)
+			if err != nil {
+				t.Fatalf("could not read file: %s", err)
+			}
+			data.ConvertRegionToLineData()
+			expected.CollectStatistics(data)
+
+			out := NewTestReport()
+			err = streamStatistics(out, []string{filepath.Join("./testdata", v.filename)}, loadOptions{}, filter)
+			if err != nil {
+				t.Fatalf("could not stream file: %s", err)
+			}
+
+			if !reflect.DeepEqual(expected, out) {
+				t.Errorf("report does not match")
+			}
+		})
+	}
+}
+
+func TestStreamStatisticsFail(t *testing.T) {
+	filter := newFileFilter(bytes.NewBuffer(nil), ".", nil, true, "", nil)
+
+	// The same source files appear in both tracefiles, which cannot be
+	// merged when streaming.
+	out := NewTestReport()
+	err := streamStatistics(out, []string{
+		"./testdata/example-lcov-1.13.info",
+		"./testdata/example-lcov-1.13.info",
+	}, loadOptions{}, filter)
+	if err == nil {
+		t.Errorf("unexpected success")
+	}
+}
+
+func TestStreamStatisticsProfiles(t *testing.T) {
+	// The profiles must be merged before the counters are mapped to
+	// regions, so the results should match the merged profile.
+	filter := newFileFilter(bytes.NewBuffer(nil), "/example/", nil, true, "", nil)
+	expected := NewTestReport()
+	data, err := loadFileData([]string{"./testdata/example-rustc-1.90.0/merged.profdata"}, testProfileOptions, filter)
+	if err != nil {
+		t.Fatalf("could not read file: %s", err)
+	}
+	data.ConvertRegionToLineData()
+	expected.CollectStatistics(data)
+
+	out := NewTestReport()
+	err = streamStatistics(out, []string{
+		"./testdata/example-rustc-1.90.0/a.profraw",
+		"./testdata/example-rustc-1.90.0/b.profraw",
+	}, testProfileOptions, filter)
+	if err != nil {
+		t.Fatalf("could not stream file: %s", err)
+	}
+	if !reflect.DeepEqual(expected, out) {
+		t.Errorf("report does not match")
+	}
+}
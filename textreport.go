@@ -31,7 +31,11 @@ func writeTextReport(writer io.Writer, report *Report) error {
 		f.Dim("------\t------\t------\t------"))
 
 	// Body
-	for _, i := range report.Files {
+	files := report.Files
+	if report.TextDepth > 0 && report.Dirs != nil {
+		files = report.Dirs.Flatten(report.TextDepth)
+	}
+	for _, i := range files {
 		fmt.Fprintf(w, "%6.1f%%\t%5.1f%%\t%5.1f%%\t%5.1f%%\t%s\n",
 			i.LCoverage,
 			i.FCoverage,
@@ -49,5 +53,31 @@ func writeTextReport(writer io.Writer, report *Report) error {
 			report.BCoverage,
 			report.RCoverage))
 
+	// Components and owners
+	writeTextGroups(w, f, "Component", report.Components)
+	writeTextGroups(w, f, "Owner", report.Owners)
+
 	return w.Flush()
 }
+
+func writeTextGroups(w io.Writer, f *sgr.Formatter, heading string, groups []GroupStatistics) {
+	if len(groups) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\n%v\n%v\n",
+		f.Boldf(" Lines\t Funcs\tBranch\tRegion\t%s", heading),
+		f.Dim("------\t------\t------\t------"))
+	for _, i := range groups {
+		fmt.Fprintf(w, "%6.1f%%\t%5.1f%%\t%5.1f%%\t%5.1f%%\t%s",
+			i.LCoverage,
+			i.FCoverage,
+			i.BCoverage,
+			i.RCoverage,
+			i.Name)
+		if i.BelowThreshold() {
+			fmt.Fprintf(w, " (below threshold of %.1f%%)", i.Threshold)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
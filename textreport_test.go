@@ -6,6 +6,8 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -44,7 +46,7 @@ func TestCreateTextReport(t *testing.T) {
 		v := v
 		t.Run(v.filename, func(t *testing.T) {
 			data := make(map[string]*FileData)
-			err := loadFile(data, filepath.Join("./testdata", v.filename))
+			err := loadFile(data, filepath.Join("./testdata", v.filename), loadOptions{})
 			if err != nil {
 				t.Fatalf("could not read file: %s", err)
 			}
@@ -82,6 +84,92 @@ func TestCreateTextReport(t *testing.T) {
 	}
 }
 
+func TestCreateTextReportDepth(t *testing.T) {
+	cases := []struct {
+		depth int
+	}{
+		{0},
+		{1},
+	}
+
+	for _, v := range cases {
+		v := v
+		t.Run(strconv.Itoa(v.depth), func(t *testing.T) {
+			data := make(map[string]*FileData)
+			err := loadFile(data, "./testdata/example-7.4.0-branches", loadOptions{})
+			if err != nil {
+				t.Fatalf("could not read file: %s", err)
+			}
+
+			report := NewTestReport()
+			report.CollectStatistics(data)
+			report.TextDepth = v.depth
+
+			buffer := bytes.NewBuffer(nil)
+			err = writeTextReport(buffer, report)
+			if err != nil {
+				t.Fatalf("could not write output: %s", err)
+			}
+
+			if *update {
+				err := ioutil.WriteFile(filepath.Join("./testdata", t.Name()+".golden"), buffer.Bytes(), 0600)
+				if err != nil {
+					t.Fatalf("could not write golden file: %s", err)
+				}
+			}
+
+			expected, err := ioutil.ReadFile(filepath.Join("./testdata", t.Name()+".golden"))
+			if err != nil {
+				t.Fatalf("could not read golden file: %s", err)
+			}
+			if !bytes.Equal(expected, buffer.Bytes()) {
+				t.Errorf("output does not match golden file")
+			}
+		})
+	}
+}
+
+func TestWriteTextReportGroups(t *testing.T) {
+	data := make(map[string]*FileData)
+	err := loadFile(data, "./testdata/example-7.4.0-branches", loadOptions{})
+	if err != nil {
+		t.Fatalf("could not read file: %s", err)
+	}
+	cm, err := parseComponentMap(strings.NewReader(testComponentMap))
+	if err != nil {
+		t.Fatalf("could not parse components: %s", err)
+	}
+	co, err := parseCodeOwners(strings.NewReader(testCodeOwners))
+	if err != nil {
+		t.Fatalf("could not parse code owners: %s", err)
+	}
+
+	report := NewTestReport()
+	report.CollectStatistics(data)
+	report.CollectGroups(cm, co)
+
+	buffer := bytes.NewBuffer(nil)
+	err = writeTextReport(buffer, report)
+	if err != nil {
+		t.Fatalf("could not write output: %s", err)
+	}
+
+	if *update {
+		err := ioutil.WriteFile(filepath.Join("./testdata", t.Name()+".golden"), buffer.Bytes(), 0600)
+		if err != nil {
+			t.Fatalf("could not write golden file: %s", err)
+		}
+	}
+
+	expected, err := ioutil.ReadFile(filepath.Join("./testdata", t.Name()+".golden"))
+	if err != nil {
+		t.Fatalf("could not read golden file: %s", err)
+	}
+	if !bytes.Equal(expected, buffer.Bytes()) {
+		t.Errorf("output does not match golden file")
+	}
+}
+
 func TestCreateTextReportFail(t *testing.T) {
 	report := NewTestReport()
 	report.CollectStatistics(map[string]*FileData{})
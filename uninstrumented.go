@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// findUninstrumentedFiles walks the source directory, and returns the names of
+// any source files that match one of the patterns, but for which there is no
+// coverage data.  These are files that were never loaded by the tests, and so
+// do not appear in the output from the coverage tools.  Names are relative to
+// the source directory, to match the normalized names of the coverage data.
+// Files and directories that cannot be read are skipped, and a warning is
+// written to warnings.
+func findUninstrumentedFiles(warnings io.Writer, srcdir string, patterns []string, exclude *regexp.Regexp, known func(string) bool) ([]string, error) {
+	out := []string(nil)
+
+	err := filepath.Walk(srcdir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == srcdir {
+				return err
+			}
+			fmt.Fprintf(warnings, "warning: skipping unreadable path: %s\n", err)
+			return nil
+		}
+		if info.IsDir() {
+			// Skip hidden directories, such as those used by version
+			// control.
+			if path != srcdir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		name, err := filepath.Rel(srcdir, path)
+		if err != nil {
+			return err
+		}
+		if !matchAnyPathPattern(patterns, name) || known(name) {
+			return nil
+		}
+		if exclude != nil && exclude.FindString(name) != "" {
+			return nil
+		}
+		out = append(out, name)
+		return nil
+	})
+	return out, err
+}
+
+func matchAnyPathPattern(patterns []string, filename string) bool {
+	for _, v := range patterns {
+		if matchPathPattern(v, filename) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadUninstrumentedFile creates the coverage data for a source file that was
+// never loaded by the tests.  All of the executable lines are reported as not
+// executed.
+func loadUninstrumentedFile(srcdir, filename string) (*FileData, error) {
+	file, err := os.Open(filepath.Join(srcdir, filename))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	lines, err := estimateExecutableLines(file, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	data := NewFileData(filename)
+	for _, v := range lines {
+		data.LineData[v] = 0
+	}
+	return data, nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestFindUninstrumentedFiles(t *testing.T) {
+	dir, cleanup := TempDirectory(t)
+	defer cleanup()
+
+	files := []string{
+		"main.c",
+		"util.c",
+		"util.h",
+		"README.md",
+		"sub/other.c",
+		"sub/test_other.c",
+		".git/hooks.c",
+	}
+	for _, v := range files {
+		name := filepath.Join(dir, filepath.FromSlash(v))
+		err := os.MkdirAll(filepath.Dir(name), 0700)
+		if err != nil {
+			t.Fatalf("could not create directory: %s", err)
+		}
+		err = ioutil.WriteFile(name, []byte("int a;\n"), 0600)
+		if err != nil {
+			t.Fatalf("could not write file: %s", err)
+		}
+	}
+
+	known := func(name string) bool {
+		return name == "main.c"
+	}
+
+	cases := []struct {
+		patterns []string
+		exclude  *regexp.Regexp
+		expected []string
+	}{
+		{nil, nil, nil},
+		{[]string{"*.c"}, nil, []string{"sub/other.c", "sub/test_other.c", "util.c"}},
+		{[]string{"*.c", "*.h"}, nil, []string{"sub/other.c", "sub/test_other.c", "util.c", "util.h"}},
+		{[]string{"/*.c"}, nil, []string{"util.c"}},
+		{[]string{"sub/"}, nil, []string{"sub/other.c", "sub/test_other.c"}},
+		{[]string{"*.c"}, regexp.MustCompile("test_"), []string{"sub/other.c", "util.c"}},
+	}
+
+	for _, v := range cases {
+		t.Run(strings.Join(v.patterns, ","), func(t *testing.T) {
+			out, err := findUninstrumentedFiles(bytes.NewBuffer(nil), dir, v.patterns, v.exclude, known)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			for i := range out {
+				out[i] = filepath.ToSlash(out[i])
+			}
+			if !reflect.DeepEqual(out, v.expected) {
+				LogNE(t, "files", v.expected, out)
+			}
+		})
+	}
+}
+
+func TestFindUninstrumentedFilesUnreadable(t *testing.T) {
+	dir, cleanup := TempDirectory(t)
+	defer cleanup()
+
+	for _, v := range []string{"main.c", "private/secret.c"} {
+		name := filepath.Join(dir, filepath.FromSlash(v))
+		err := os.MkdirAll(filepath.Dir(name), 0700)
+		if err != nil {
+			t.Fatalf("could not create directory: %s", err)
+		}
+		err = ioutil.WriteFile(name, []byte("int a;\n"), 0600)
+		if err != nil {
+			t.Fatalf("could not write file: %s", err)
+		}
+	}
+	private := filepath.Join(dir, "private")
+	if err := os.Chmod(private, 0); err != nil {
+		t.Fatalf("could not change permissions: %s", err)
+	}
+	defer os.Chmod(private, 0700)
+	if _, err := ioutil.ReadDir(private); err == nil {
+		t.Skip("permissions are not enforced")
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	out, err := findUninstrumentedFiles(buffer, dir, []string{"*.c"}, nil, func(string) bool { return false })
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := []string{"main.c"}; !reflect.DeepEqual(out, expected) {
+		LogNE(t, "files", expected, out)
+	}
+	if !strings.Contains(buffer.String(), "warning: skipping unreadable path") {
+		t.Errorf("missing warning: %q", buffer.String())
+	}
+}
+
+func TestLoadUninstrumentedFile(t *testing.T) {
+	data, err := loadUninstrumentedFile("./example", "example.c")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if data.Filename != "example.c" {
+		LogNE(t, "filename", "example.c", data.Filename)
+	}
+	lcov := data.LineCoverage()
+	if lcov.Hits != 0 || lcov.Total == 0 {
+		t.Errorf("unexpected line coverage: %v", lcov)
+	}
+
+	_, err = loadUninstrumentedFile("./example", "missing.c")
+	if err == nil {
+		t.Errorf("unexpected success")
+	}
+}
+
+func TestLoadFileDataUninstrumented(t *testing.T) {
+	dir, cleanup := TempDirectory(t)
+	defer cleanup()
+
+	for _, v := range []string{"example.c", "extra.c"} {
+		err := ioutil.WriteFile(filepath.Join(dir, v), []byte("int main() {\n\treturn 0;\n}\n"), 0600)
+		if err != nil {
+			t.Fatalf("could not write file: %s", err)
+		}
+	}
+
+	// The coverage data in the tracefile is for example.c, which is not
+	// relative to the source directory.
+	filter := newFileFilter(bytes.NewBuffer(nil), dir, nil, true, "", []string{"*.c"})
+	data, err := loadFileData([]string{"./testdata/example-lcov-1.13.info"}, loadOptions{}, filter)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := data["extra.c"]; !ok {
+		t.Errorf("missing data for extra.c")
+	} else if lcov := data["extra.c"].LineCoverage(); lcov != (Coverage{0, 3}) {
+		LogNE(t, "line coverage", Coverage{0, 3}, lcov)
+	}
+
+	compact, err := loadCompactFileData([]string{"./testdata/example-lcov-1.13.info"}, loadOptions{}, filter)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !compact.Contains("extra.c") {
+		t.Errorf("missing compact data for extra.c")
+	}
+
+	report := NewTestReport()
+	err = streamStatistics(report, []string{"./testdata/example-lcov-1.13.info"}, loadOptions{}, filter)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	found := false
+	for _, v := range report.Files {
+		found = found || v.Name == "extra.c"
+	}
+	if !found {
+		t.Errorf("missing statistics for extra.c")
+	}
+}
+
+func TestSplitPatterns(t *testing.T) {
+	cases := []struct {
+		in       string
+		expected []string
+	}{
+		{"", nil},
+		{"*.c", []string{"*.c"}},
+		{"*.c, *.h,,", []string{"*.c", "*.h"}},
+	}
+
+	for _, v := range cases {
+		t.Run(v.in, func(t *testing.T) {
+			out := splitPatterns(v.in)
+			if !reflect.DeepEqual(out, v.expected) {
+				LogNE(t, "patterns", v.expected, out)
+			}
+		})
+	}
+}